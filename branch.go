@@ -0,0 +1,288 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ---------- Per-branch DBs (BRANCH_MODE=1: <PROJECT>-<branch>) ----------
+
+func branchMode() bool { return os.Getenv("BRANCH_MODE") == "1" }
+
+// git runs a git command in APP_DIR and returns its trimmed stdout.
+func git(args ...string) (string, error) {
+	dir := os.Getenv("APP_DIR")
+	if dir == "" {
+		dir = "."
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, "git", append([]string{"-C", dir}, args...)...).Output()
+	return strings.TrimSpace(string(out)), err
+}
+
+// currentBranch is APP_DIR's checked-out branch ("" when detached or not a repo).
+func currentBranch() string {
+	b, err := git("rev-parse", "--abbrev-ref", "HEAD")
+	if err != nil || b == "HEAD" {
+		return ""
+	}
+	return b
+}
+
+// mainBranch is BRANCH_MAIN, else whichever of main/master exists.
+func mainBranch() string {
+	if b := os.Getenv("BRANCH_MAIN"); b != "" {
+		return b
+	}
+	if _, err := git("rev-parse", "--verify", "--quiet", "refs/heads/master"); err == nil {
+		if _, err := git("rev-parse", "--verify", "--quiet", "refs/heads/main"); err != nil {
+			return "master"
+		}
+	}
+	return "main"
+}
+
+func localBranches() ([]string, error) {
+	out, err := git("for-each-ref", "--format=%(refname:short)", "refs/heads/")
+	if err != nil {
+		return nil, fmt.Errorf("list git branches in APP_DIR: %w", err)
+	}
+	return strings.Fields(out), nil
+}
+
+var slugInvalid = regexp.MustCompile(`[^a-z0-9_-]+`)
+
+// branchSlug makes a branch usable in a compose project name ("feature/Login" -> "feature-login").
+func branchSlug(branch string) string {
+	s := slugInvalid.ReplaceAllString(strings.ToLower(branch), "-")
+	s = strings.Trim(s, "-_")
+	if len(s) > 40 {
+		s = strings.TrimRight(s[:40], "-_")
+	}
+	return s
+}
+
+// branchProject maps a branch to its compose project; the main branch (and a
+// detached HEAD) keep the base project, so its existing DB stays in place.
+func branchProject(base, branch, main string) string {
+	if branch == "" || branch == main || branchSlug(branch) == "" {
+		return base
+	}
+	return base + "-" + branchSlug(branch)
+}
+
+// currentProject is PROJECT, or in branch mode the project of APP_DIR's branch.
+func currentProject() string {
+	p := os.Getenv("PROJECT")
+	if p == "" || !branchMode() {
+		return p
+	}
+	return branchProject(p, currentBranch(), mainBranch())
+}
+
+// branchLabel marks the services and DB volume of a branch DB with its base
+// project. gc only removes projects carrying it, never one that merely shares
+// the <PROJECT>- prefix.
+const branchLabel = "compose-db-agent.branch"
+
+// branchOverridePath is the compose override that labels a branch project's
+// services; composeFileArgs includes it while it exists.
+func branchOverridePath(project string) string {
+	return filepath.Join(snapshotDir(project), "branch.override.yml")
+}
+
+// markBranchProject labels a branch DB before it is brought up: the DB volume
+// is created with the label if it doesn't exist yet (compose reuses it), and
+// the override labels every service.
+func markBranchProject(extra map[string]string, base string, t dbTarget) error {
+	if t.Volume != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), defaultAPITimeout)
+		defer cancel()
+		vol := dbVolumeName(t.Project, t.Volume)
+		_, err := engine.VolumeInspect(ctx, vol)
+		if isNotFound(err) {
+			labels := map[string]string{
+				"com.docker.compose.project": t.Project,
+				"com.docker.compose.volume":  t.Volume,
+				branchLabel:                  base,
+			}
+			err = engine.VolumeCreate(ctx, vol, labels)
+		}
+		if err != nil {
+			return fmt.Errorf("volume %s: %w", vol, err)
+		}
+	}
+	out, err := runComposeWithEnv(extra, "-p", t.Project, "-f", t.ComposeFile, "config", "--services")
+	if err != nil {
+		return err
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "# written by compose-db-agent: %s is a branch DB of %s\nservices:\n", t.Project, base)
+	for _, svc := range strings.Fields(out) {
+		fmt.Fprintf(&sb, "  %s:\n    labels:\n      %s: %q\n", svc, branchLabel, base)
+	}
+	path := branchOverridePath(t.Project)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(sb.String()), 0o644)
+}
+
+// markIfBranch is markBranchProject for tools that bring up the current
+// project: in branch mode that is the checked-out branch's DB.
+func markIfBranch(extra map[string]string, t dbTarget) error {
+	base := os.Getenv("PROJECT")
+	if !branchMode() || base == "" || t.Project == base || t.Project != currentProject() {
+		return nil
+	}
+	return markBranchProject(extra, base, t)
+}
+
+type branchDB struct {
+	Branch  string `json:"branch,omitempty"` // empty: no local branch maps to this project any more
+	Project string `json:"project"`
+	Volume  string `json:"volume,omitempty"`
+	Exists  bool   `json:"exists"` // the DB volume exists
+	Running bool   `json:"running"`
+	Current bool   `json:"current,omitempty"`
+	Stale   bool   `json:"stale,omitempty"`
+	Labeled bool   `json:"labeled,omitempty"` // the volume carries branchLabel for this base
+}
+
+// listBranchDBs combines local branches with the DB volumes of <base> and its
+// branch projects. Only labeled volumes whose branch is gone are stale; an
+// unlabeled <base>-* project is listed only while a local branch maps to it.
+func listBranchDBs(base, service, volKey string) ([]branchDB, error) {
+	branches, err := localBranches()
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), defaultAPITimeout)
+	defer cancel()
+	vols, err := engine.VolumeList(ctx, "com.docker.compose.volume="+volKey)
+	if err != nil {
+		return nil, err
+	}
+
+	byProject := map[string]*branchDB{}
+	cur, main := currentProject(), mainBranch()
+	for _, b := range branches {
+		p := branchProject(base, b, main)
+		if byProject[p] == nil || b == main {
+			byProject[p] = &branchDB{Branch: b, Project: p}
+		}
+	}
+	for _, v := range vols {
+		p := v.Labels["com.docker.compose.project"]
+		labeled := p != base && v.Labels[branchLabel] == base
+		d := byProject[p]
+		if d == nil {
+			if p != base && !labeled {
+				continue // not ours: e.g. an unrelated <base>-admin project
+			}
+			d = &branchDB{Project: p, Stale: p != base}
+			byProject[p] = d
+		}
+		d.Volume, d.Exists, d.Labeled = v.Name, true, labeled
+	}
+
+	out := []branchDB{}
+	for p, d := range byProject {
+		if id, err := containerID(p, service); err == nil {
+			if info, err := engine.ContainerInspect(ctx, id); err == nil {
+				d.Running = info.State.Running
+			}
+		}
+		d.Current = p == cur
+		out = append(out, *d)
+	}
+	sort.Slice(out, func(i, k int) bool { return out[i].Project < out[k].Project })
+	return out, nil
+}
+
+// copyVolume streams the contents of one volume into another through two helper
+// containers (same archive layout as snapshots). Both DBs must be stopped.
+func copyVolume(ctx context.Context, image, from, to string) error {
+	src, err := helperContainer(ctx, image, from, true)
+	if err != nil {
+		return fmt.Errorf("create helper container: %w", err)
+	}
+	defer engine.ContainerRemove(context.Background(), src)
+	dst, err := helperContainer(ctx, image, to, false)
+	if err != nil {
+		return fmt.Errorf("create helper container: %w", err)
+	}
+	defer engine.ContainerRemove(context.Background(), dst)
+
+	rc, err := engine.CopyFromContainer(ctx, src, snapshotMount)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return engine.CopyToContainer(ctx, dst, "/", rc)
+}
+
+// cloneDB replaces dst's DB volume with a copy of src's and starts dst's DB.
+// src is stopped for the copy, which also makes dst the active branch DB.
+func cloneDB(src, dst dbTarget) (healthResult, error) {
+	var hr healthResult
+	if dst.Volume == "" {
+		return hr, errors.New("DB_VOLUME is not set; don't know which volume to clone")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	srcVol := dbVolumeName(src.Project, src.Volume)
+	if _, err := engine.VolumeInspect(ctx, srcVol); err != nil {
+		return hr, fmt.Errorf("volume %s: %w", srcVol, err)
+	}
+	id, err := containerID(src.Project, src.Service)
+	if err != nil {
+		return hr, fmt.Errorf("%s: %w (start it once so its image can be reused)", src.Project, err)
+	}
+	info, err := engine.ContainerInspect(ctx, id)
+	if err != nil {
+		return hr, err
+	}
+
+	extra := readDotenv(os.Getenv("APP_ENV_FILE"))
+	if _, err := stopServices(extra, dst.Project, dst.ComposeFile, []string{dst.Service}); err != nil {
+		return hr, err
+	}
+	dstVol := dbVolumeName(dst.Project, dst.Volume)
+	if _, err := removeDBVolume(dst.Project, dst.Volume); err != nil {
+		return hr, err
+	}
+	if err := markBranchProject(extra, src.Project, dst); err != nil {
+		return hr, err
+	}
+
+	// src stays stopped: branch DBs share the compose file, and so its host ports
+	if info.State.Running {
+		if _, err := runComposeWithEnv(extra, "-p", src.Project, "-f", src.ComposeFile, "stop", src.Service); err != nil {
+			return hr, err
+		}
+	}
+	if err := copyVolume(ctx, info.Config.Image, srcVol, dstVol); err != nil {
+		return hr, err
+	}
+
+	if _, err := runComposeLive(extra, append(composeFileArgs(dst.Project, dst.ComposeFile), "up", "-d", dst.Service)...); err != nil {
+		return hr, err
+	}
+	if id, err = containerID(dst.Project, dst.Service); err != nil {
+		return hr, err
+	}
+	wctx, wcancel := context.WithTimeout(context.Background(), 180*time.Second)
+	defer wcancel()
+	return waitForHealth(wctx, id)
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ---------- Subcommands (tools without the LLM) ----------
+
+// subcommand maps a CLI verb onto a tool, with an optional positional
+// parameter and preset arguments.
+type subcommand struct {
+	Tool       string
+	Positional string         // e.g. `snapshot demo-ready` sets name
+	Preset     map[string]any // overridable by flags
+}
+
+var subcommands = map[string]subcommand{
+	"up":        {Tool: "composeUp"},
+	"down":      {Tool: "composeDown"},
+	"reset":     {Tool: "dbReset"},
+	"logs":      {Tool: "serviceLogs"},
+	"wait":      {Tool: "waitHealthy"},
+	"status":    {Tool: "waitHealthy", Preset: map[string]any{"timeout_sec": float64(1)}},
+	"snapshot":  {Tool: "dbSnapshot", Positional: "name"},
+	"snapshots": {Tool: "dbSnapshotList"},
+	"restore":   {Tool: "dbRestore", Positional: "name"},
+	"undo":      {Tool: "undo"},
+	"dump":      {Tool: "dbDump", Positional: "file"},
+	"load":      {Tool: "dbLoad", Positional: "file"},
+	"migrate":   {Tool: "dbMigrate", Positional: "action", Preset: map[string]any{"action": "up"}},
+	"seed":      {Tool: "dbSeed"},
+	"query":     {Tool: "dbQuery", Positional: "sql"},
+	"schema":    {Tool: "dbSchema"},
+	"diff":      {Tool: "dbSchemaDiff", Positional: "against"},
+	"clone":     {Tool: "dbClone", Positional: "name"},
+	"drop":      {Tool: "dbDrop", Positional: "name"},
+	"dbs":       {Tool: "dbList"},
+	"branch":    {Tool: "branchDB", Positional: "action", Preset: map[string]any{"action": "list"}},
+	"engine":    {Tool: "dbEngine"},
+	"user":      {Tool: "dbUser", Positional: "action", Preset: map[string]any{"action": "list"}},
+	"conn":      {Tool: "dbConnectionInfo"},
+	"validate":  {Tool: "validate"},
+	"profiles":  {Tool: "listProfiles"},
+	"docker":    {Tool: "ensureDocker"},
+}
+
+// lookupSubcommand resolves a verb or a tool name (`dbQuery` works too).
+func lookupSubcommand(name string) (subcommand, bool) {
+	if sc, ok := subcommands[name]; ok {
+		return sc, true
+	}
+	if _, ok := tools[name]; ok {
+		return subcommand{Tool: name}, true
+	}
+	return subcommand{}, false
+}
+
+// schemaFlag is a flag generated from one InputSchema property; it writes the
+// value into args with the type the tool expects from JSON.
+type schemaFlag struct {
+	name string
+	prop map[string]any
+	args map[string]any
+}
+
+func (f *schemaFlag) String() string { return "" }
+
+func (f *schemaFlag) IsBoolFlag() bool { return f.prop["type"] == "boolean" }
+
+func (f *schemaFlag) Set(s string) error {
+	switch f.prop["type"] {
+	case "boolean":
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		f.args[f.name] = b
+	case "integer", "number":
+		n, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return fmt.Errorf("not a number: %q", s)
+		}
+		f.args[f.name] = n
+	case "array": // repeatable, or comma-separated
+		l, _ := f.args[f.name].([]any)
+		for _, v := range strings.Split(s, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				l = append(l, v)
+			}
+		}
+		f.args[f.name] = l
+	default:
+		if err := checkEnum(f.name, f.prop, s); err != nil {
+			return err
+		}
+		f.args[f.name] = s
+	}
+	return nil
+}
+
+func checkEnum(name string, prop map[string]any, s string) error {
+	enum, ok := prop["enum"].([]string)
+	if !ok {
+		return nil
+	}
+	for _, e := range enum {
+		if e == s {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s must be one of %s", name, strings.Join(enum, ", "))
+}
+
+// toolFlags builds a FlagSet from the tool's InputSchema. Every property is a
+// flag under its own name and with dashes (--confirm_phrase / --confirm-phrase).
+func toolFlags(verb string, t Tool, args map[string]any, out io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet(verb, flag.ContinueOnError)
+	fs.SetOutput(out)
+	props, _ := t.Decl.InputSchema["properties"].(map[string]any)
+	names := make([]string, 0, len(props))
+	for name, p := range props {
+		prop, _ := p.(map[string]any)
+		f := &schemaFlag{name: name, prop: prop, args: args}
+		fs.Var(f, name, "")
+		if dashed := strings.ReplaceAll(name, "_", "-"); dashed != name {
+			fs.Var(f, dashed, "")
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fs.Usage = func() {
+		fmt.Fprintf(out, "usage: compose-db-agent [--profile name] %s [flags]", verb)
+		if sc, _ := lookupSubcommand(verb); sc.Positional != "" {
+			fmt.Fprintf(out, " [%s]", sc.Positional)
+		}
+		fmt.Fprintf(out, "\n\n%s\n\nflags:\n", t.Decl.Description)
+		for _, name := range names {
+			prop, _ := props[name].(map[string]any)
+			typ := fmt.Sprint(prop["type"])
+			if enum, ok := prop["enum"].([]string); ok {
+				typ = strings.Join(enum, "|")
+			}
+			switch typ {
+			case "boolean":
+				typ = ""
+			case "array":
+				typ = "a,b,..."
+			}
+			fmt.Fprintf(out, "  --%s %s\n", strings.ReplaceAll(name, "_", "-"), typ)
+		}
+	}
+	return fs
+}
+
+// runSubcommand runs argv[0] as a subcommand. ok is false when it isn't one
+// (the caller then treats argv as a natural-language prompt).
+func runSubcommand(argv []string) (code int, ok bool) {
+	if argv[0] == "help" {
+		printSubcommands(os.Stdout)
+		return 0, true
+	}
+	sc, ok := lookupSubcommand(argv[0])
+	if !ok {
+		return 0, false
+	}
+	t := tools[sc.Tool]
+	args := map[string]any{}
+	for k, v := range sc.Preset {
+		args[k] = v
+	}
+	fs := toolFlags(argv[0], t, args, os.Stderr)
+	if err := fs.Parse(argv[1:]); err != nil {
+		if err == flag.ErrHelp {
+			return 0, true
+		}
+		return 2, true
+	}
+	rest := fs.Args()
+	switch {
+	case len(rest) == 0:
+	case sc.Positional != "" && len(rest) == 1:
+		props, _ := t.Decl.InputSchema["properties"].(map[string]any)
+		prop, _ := props[sc.Positional].(map[string]any)
+		if err := checkEnum(sc.Positional, prop, rest[0]); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return 2, true
+		}
+		args[sc.Positional] = rest[0]
+	default:
+		fmt.Fprintf(os.Stderr, "Error: unexpected arguments %q (flags go before them; see %s -h)\n", rest, argv[0])
+		return 2, true
+	}
+
+	toolDefaults(sc.Tool, args)
+	out, isErr, err := callTool(sc.Tool, args)
+	if out != "" {
+		fmt.Println(out)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+	}
+	if err != nil || isErr {
+		return 1, true
+	}
+	return 0, true
+}
+
+// toolDefaults is fillDefaults plus service (logs, waitHealthy) = DB_SERVICE,
+// for calls that don't come from the model.
+func toolDefaults(tool string, args map[string]any) {
+	fillDefaults(args)
+	if props, _ := tools[tool].Decl.InputSchema["properties"].(map[string]any); props["service"] != nil {
+		if _, ok := args["service"]; !ok {
+			args["service"] = os.Getenv("DB_SERVICE")
+		}
+	}
+}
+
+func printSubcommands(w io.Writer) {
+	fmt.Fprintln(w, "usage: compose-db-agent [--profile name] <command> [flags]   (or a quoted natural-language prompt)")
+	fmt.Fprintln(w, "\ncommands:")
+	verbs := make([]string, 0, len(subcommands))
+	for v := range subcommands {
+		verbs = append(verbs, v)
+	}
+	sort.Strings(verbs)
+	for _, v := range verbs {
+		sc := subcommands[v]
+		pos := ""
+		if sc.Positional != "" {
+			pos = " [" + sc.Positional + "]"
+		}
+		fmt.Fprintf(w, "  %-28s %s\n", v+pos, sc.Tool)
+	}
+	fmt.Fprintf(w, "  %-28s %s\n", "repl [session id]", "interactive session (needs the model; /help inside)")
+	fmt.Fprintln(w, "\nAny tool name works as a command too. `<command> -h` lists its flags.")
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var fakeToolSchema = map[string]any{
+	"type": "object",
+	"properties": map[string]any{
+		"name":           map[string]any{"type": "string"},
+		"mode":           map[string]any{"type": "string", "enum": []string{"fast", "slow"}},
+		"force":          map[string]any{"type": "boolean"},
+		"steps":          map[string]any{"type": "integer"},
+		"tags":           map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+		"confirm_phrase": map[string]any{"type": "string"},
+	},
+}
+
+func TestSchemaFlagSet(t *testing.T) {
+	tests := []struct {
+		typ     string
+		enum    []string
+		in      []string
+		want    any
+		wantErr string
+	}{
+		{"boolean", nil, []string{"true"}, true, ""},
+		{"boolean", nil, []string{"0"}, false, ""},
+		{"boolean", nil, []string{"yes"}, nil, "invalid syntax"},
+		{"integer", nil, []string{"3"}, 3.0, ""},
+		{"number", nil, []string{"1.5"}, 1.5, ""},
+		{"integer", nil, []string{"three"}, nil, `not a number: "three"`},
+		{"array", nil, []string{"a,b", "c"}, []any{"a", "b", "c"}, ""},
+		{"array", nil, []string{" a , ,b "}, []any{"a", "b"}, ""},
+		{"string", nil, []string{"a,b"}, "a,b", ""},
+		{"string", nil, []string{"first", "second"}, "second", ""},
+		{"string", []string{"up", "down"}, []string{"down"}, "down", ""},
+		{"string", []string{"up", "down"}, []string{"sideways"}, nil, "x must be one of up, down"},
+	}
+	for _, tt := range tests {
+		prop := map[string]any{"type": tt.typ}
+		if tt.enum != nil {
+			prop["enum"] = tt.enum
+		}
+		args := map[string]any{}
+		f := &schemaFlag{name: "x", prop: prop, args: args}
+		var err error
+		for _, s := range tt.in {
+			if err = f.Set(s); err != nil {
+				break
+			}
+		}
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s %q: err = %v, want %q", tt.typ, tt.in, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(args["x"], tt.want) {
+			t.Errorf("%s %q = %#v, %v; want %#v", tt.typ, tt.in, args["x"], err, tt.want)
+		}
+	}
+}
+
+func TestToolFlags(t *testing.T) {
+	tool := Tool{Decl: ToolDecl{Name: "fakeTool", Description: "A fake.", InputSchema: fakeToolSchema}}
+	tests := []struct {
+		argv    []string
+		want    map[string]any
+		rest    []string
+		wantErr string
+	}{
+		{[]string{"--confirm-phrase", "RESET shop", "--force", "--steps=2", "--tags", "a,b", "-tags", "c", "--mode", "slow"},
+			map[string]any{"confirm_phrase": "RESET shop", "force": true, "steps": 2.0, "tags": []any{"a", "b", "c"}, "mode": "slow"}, nil, ""},
+		{[]string{"--confirm_phrase=x", "--force=false"}, map[string]any{"confirm_phrase": "x", "force": false}, nil, ""},
+		{[]string{"--force", "false"}, map[string]any{"force": true}, []string{"false"}, ""}, // bool flags take no separate value
+		{[]string{"--name", "demo", "extra", "--force"}, map[string]any{"name": "demo"}, []string{"extra", "--force"}, ""},
+		{[]string{"--", "--force"}, map[string]any{}, []string{"--force"}, ""},
+		{[]string{"--mode", "warp"}, nil, nil, "mode must be one of fast, slow"},
+		{[]string{"--steps", "many"}, nil, nil, "not a number"},
+		{[]string{"--verbose"}, nil, nil, "flag provided but not defined: -verbose"},
+		{[]string{"--name"}, nil, nil, "flag needs an argument: -name"},
+	}
+	for _, tt := range tests {
+		args := map[string]any{}
+		var out bytes.Buffer
+		fs := toolFlags("fake", tool, args, &out)
+		err := fs.Parse(tt.argv)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%q: err = %v, want %q", tt.argv, err, tt.wantErr)
+			}
+			continue
+		}
+		rest := fs.Args()
+		if len(rest) == 0 {
+			rest = nil
+		}
+		if err != nil || !reflect.DeepEqual(args, tt.want) || !reflect.DeepEqual(rest, tt.rest) {
+			t.Errorf("%q = %v, rest %q, %v; want %v, rest %q", tt.argv, args, rest, err, tt.want, tt.rest)
+		}
+	}
+
+	var out bytes.Buffer
+	fs := toolFlags("fake", tool, map[string]any{}, &out)
+	fs.Usage()
+	for _, want := range []string{"fake [flags]\n", "A fake.", "--confirm-phrase string\n", "--force \n", "--mode fast|slow\n", "--steps integer\n", "--tags a,b,...\n"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("usage is missing %q:\n%s", want, out.String())
+		}
+	}
+	if strings.Contains(out.String(), "--confirm_phrase") {
+		t.Errorf("usage lists the underscore alias:\n%s", out.String())
+	}
+}
+
+func TestRunSubcommand(t *testing.T) {
+	var calls []map[string]any
+	isErr := false
+	oldTool, hadTool := tools["fakeTool"]
+	tools["fakeTool"] = Tool{Decl: ToolDecl{Name: "fakeTool", InputSchema: fakeToolSchema}, Call: func(args map[string]any) (string, bool, error) {
+		calls = append(calls, args)
+		return `{"ok": true}`, isErr, nil
+	}}
+	subcommands["fake"] = subcommand{Tool: "fakeTool", Positional: "mode", Preset: map[string]any{"mode": "fast", "steps": 1.0}}
+	t.Cleanup(func() {
+		delete(subcommands, "fake")
+		if hadTool {
+			tools["fakeTool"] = oldTool
+		} else {
+			delete(tools, "fakeTool")
+		}
+	})
+	// the tool's output and usage errors go to stdout/stderr
+	devnull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout, stderr := os.Stdout, os.Stderr
+	os.Stdout, os.Stderr = devnull, devnull
+	t.Cleanup(func() { os.Stdout, os.Stderr = stdout, stderr; devnull.Close() })
+
+	tests := []struct {
+		argv   []string
+		isErr  bool
+		code   int
+		ok     bool
+		called map[string]any // the tool's own args, nil if it must not run
+	}{
+		{[]string{"fake"}, false, 0, true, map[string]any{"mode": "fast", "steps": 1.0}},
+		{[]string{"fake", "slow"}, false, 0, true, map[string]any{"mode": "slow", "steps": 1.0}},
+		{[]string{"fake", "--steps", "3", "--force", "--tags=a,b", "slow"}, false, 0, true,
+			map[string]any{"mode": "slow", "steps": 3.0, "force": true, "tags": []any{"a", "b"}}},
+		{[]string{"fake", "--mode", "slow"}, false, 0, true, map[string]any{"mode": "slow", "steps": 1.0}},
+		{[]string{"fake", "--mode", "slow", "fast"}, false, 0, true, map[string]any{"mode": "fast", "steps": 1.0}}, // the positional wins
+		{[]string{"fakeTool", "--name", "x"}, false, 0, true, map[string]any{"name": "x"}},                         // tool names work, without presets
+		{[]string{"fake", "slow", "--force"}, false, 2, true, nil},                                                 // flags go before the positional
+		{[]string{"fake", "slow", "fast"}, false, 2, true, nil},
+		{[]string{"fake", "warp"}, false, 2, true, nil},
+		{[]string{"fakeTool", "x"}, false, 2, true, nil}, // no positional
+		{[]string{"fake", "--nope"}, false, 2, true, nil},
+		{[]string{"fake", "-h"}, false, 0, true, nil},
+		{[]string{"fake"}, true, 1, true, map[string]any{"mode": "fast", "steps": 1.0}},
+		{[]string{"start the db please"}, false, 0, false, nil},
+	}
+	defaults := map[string]bool{"project": true, "compose_file": true, "db_service": true, "db_volume": true}
+	for _, tt := range tests {
+		calls, isErr = nil, tt.isErr
+		code, ok := runSubcommand(tt.argv)
+		if code != tt.code || ok != tt.ok {
+			t.Errorf("runSubcommand(%q) = %d, %v; want %d, %v", tt.argv, code, ok, tt.code, tt.ok)
+		}
+		if tt.called == nil {
+			if len(calls) != 0 {
+				t.Errorf("runSubcommand(%q) called the tool with %v", tt.argv, calls[0])
+			}
+			continue
+		}
+		if len(calls) != 1 {
+			t.Errorf("runSubcommand(%q): %d tool calls, want 1", tt.argv, len(calls))
+			continue
+		}
+		got := map[string]any{}
+		for k, v := range calls[0] {
+			if !defaults[k] {
+				got[k] = v
+			} else if _, ok := v.(string); !ok {
+				t.Errorf("runSubcommand(%q): default %s = %#v", tt.argv, k, v)
+			}
+		}
+		if !reflect.DeepEqual(got, tt.called) {
+			t.Errorf("runSubcommand(%q) called the tool with %v, want %v", tt.argv, got, tt.called)
+		}
+	}
+}
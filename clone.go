@@ -0,0 +1,110 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ---------- Database forks inside the running Postgres (CREATE DATABASE ... TEMPLATE) ----------
+
+var dbNameRe = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_-]{0,62}$`)
+
+// systemDBs are never cloned over or dropped.
+var systemDBs = []string{"postgres", "template0", "template1"}
+
+type databaseInfo struct {
+	Name        string `json:"name"`
+	SizeBytes   int64  `json:"size_bytes"`
+	Connections int    `json:"connections"`
+	IsTemplate  bool   `json:"is_template,omitempty"`
+	App         bool   `json:"app,omitempty"` // the database from APP_ENV_FILE
+}
+
+func safeDBName(name string) error {
+	if !dbNameRe.MatchString(name) {
+		return fmt.Errorf("invalid database name: %q", name)
+	}
+	return nil
+}
+
+func quoteIdent(name string) string { return `"` + strings.ReplaceAll(name, `"`, `""`) + `"` }
+
+func quoteLiteral(s string) string { return "'" + strings.ReplaceAll(s, "'", "''") + "'" }
+
+// adminCreds connects to a maintenance DB, since a session inside the template
+// (or the DB being dropped) would block the operation.
+func adminCreds(c dbCreds, avoid ...string) (dbCreds, error) {
+	if c.Kind != "postgres" {
+		return c, errors.New("database cloning needs Postgres (CREATE DATABASE ... TEMPLATE)")
+	}
+	for _, db := range []string{"postgres", "template1"} {
+		if !contains(avoid, db) {
+			c.Database = db
+			return c, nil
+		}
+	}
+	return c, errors.New("no maintenance database to connect to")
+}
+
+func listDatabases(t dbTarget, c dbCreds) ([]databaseInfo, error) {
+	admin, err := adminCreds(c)
+	if err != nil {
+		return nil, err
+	}
+	out, err := runSQL(t, admin, `SELECT d.datname, pg_database_size(d.datname),
+       (SELECT count(*) FROM pg_stat_activity a WHERE a.datname = d.datname AND a.pid <> pg_backend_pid()),
+       d.datistemplate
+FROM pg_database d WHERE d.datallowconn ORDER BY d.datname;`)
+	if err != nil {
+		return nil, err
+	}
+	dbs := []databaseInfo{}
+	for _, l := range sqlLines(out) {
+		f := strings.Split(l, "\t")
+		if len(f) != 4 {
+			return nil, fmt.Errorf("unexpected pg_database row %q", l)
+		}
+		size, _ := strconv.ParseInt(f[1], 10, 64)
+		conns, _ := strconv.Atoi(f[2])
+		dbs = append(dbs, databaseInfo{Name: f[0], SizeBytes: size, Connections: conns, IsTemplate: f[3] == "t", App: f[0] == c.Database})
+	}
+	return dbs, nil
+}
+
+// cloneDatabase forks source into target. Postgres refuses while anyone else is
+// connected to source; disconnect terminates those sessions first (the app's too).
+func cloneDatabase(t dbTarget, c dbCreds, source, target string, disconnect bool) error {
+	admin, err := adminCreds(c, source, target)
+	if err != nil {
+		return err
+	}
+	var sb strings.Builder
+	if disconnect {
+		fmt.Fprintf(&sb, "SELECT count(pg_terminate_backend(pid)) FROM pg_stat_activity WHERE datname = %s AND pid <> pg_backend_pid();\n", quoteLiteral(source))
+	}
+	fmt.Fprintf(&sb, "CREATE DATABASE %s TEMPLATE %s;\n", quoteIdent(target), quoteIdent(source))
+	if _, err := runSQL(t, admin, sb.String()); err != nil {
+		if strings.Contains(err.Error(), "being accessed by other users") {
+			return fmt.Errorf("others are connected to %q; stop the app or pass disconnect=true: %w", source, err)
+		}
+		return err
+	}
+	return nil
+}
+
+// dropDatabase drops name; force (Postgres 13+) disconnects remaining sessions.
+func dropDatabase(t dbTarget, c dbCreds, name string, force bool) error {
+	admin, err := adminCreds(c, name)
+	if err != nil {
+		return err
+	}
+	stmt := "DROP DATABASE " + quoteIdent(name)
+	if force {
+		stmt += " WITH (FORCE)"
+	}
+	_, err = runSQL(t, admin, stmt+";\n")
+	return err
+}
@@ -0,0 +1,590 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ---------- Compose file parsing and validation ----------
+
+// composeFinding is one problem (or note) about the compose file, for the model
+// to explain. Level is error (compose would fail or the DB can't work),
+// warning (works, but the agent can't do its job well) or info.
+type composeFinding struct {
+	Level   string `json:"level"`
+	Code    string `json:"code"`
+	Service string `json:"service,omitempty"`
+	Path    string `json:"path,omitempty"` // e.g. services.db.environment.POSTGRES_PASSWORD
+	Message string `json:"message"`
+	Fix     string `json:"fix,omitempty"`
+}
+
+// composeProject is a loaded compose file: interpolated, extends resolved.
+type composeProject struct {
+	File     string
+	Services map[string]map[string]any
+	Volumes  map[string]any
+	Profiles []string // active profiles (COMPOSE_PROFILES)
+	Findings []composeFinding
+}
+
+// composeEnv is what compose interpolates with, lowest precedence first:
+// APP_DIR/.env, our process env, then APP_ENV_FILE (which we inject into every call).
+func composeEnv() map[string]string {
+	env := readDotenv(filepath.Join(os.Getenv("APP_DIR"), ".env"))
+	for _, kv := range os.Environ() {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			env[k] = v
+		}
+	}
+	for k, v := range readDotenv(os.Getenv("APP_ENV_FILE")) {
+		env[k] = v
+	}
+	return env
+}
+
+// loadCompose parses path with env and resolves extends; problems are collected
+// as findings, only unreadable or unparsable files are errors.
+func loadCompose(path string, env map[string]string) (*composeProject, error) {
+	doc, err := readComposeYAML(path)
+	if err != nil {
+		return nil, err
+	}
+	p := &composeProject{File: path, Services: map[string]map[string]any{}}
+	in := &interpolator{env: env}
+	doc = in.walk(doc, "").(map[string]any)
+
+	services, _ := doc["services"].(map[string]any)
+	if len(services) == 0 {
+		p.Findings = append(p.Findings, composeFinding{Level: "error", Code: "no-services", Message: "the compose file defines no services"})
+	}
+	for name := range services {
+		svc, err := resolveExtends(path, name, services, in, nil)
+		if err != nil {
+			p.Findings = append(p.Findings, composeFinding{Level: "error", Code: "bad-extends", Service: name, Path: "services." + name + ".extends", Message: err.Error()})
+			svc, _ = services[name].(map[string]any)
+		}
+		p.Services[name] = svc
+	}
+	p.Findings = append(p.Findings, in.findings...)
+	p.Volumes, _ = doc["volumes"].(map[string]any)
+	for _, prof := range strings.Split(env["COMPOSE_PROFILES"], ",") {
+		if prof = strings.TrimSpace(prof); prof != "" {
+			p.Profiles = append(p.Profiles, prof)
+		}
+	}
+	return p, nil
+}
+
+// sortedFindings orders findings by severity, then code and path, without
+// repeating the same message (an unset variable used in several places).
+func (p *composeProject) sortedFindings() []composeFinding {
+	rank := map[string]int{"error": 0, "warning": 1, "info": 2}
+	out := []composeFinding{}
+	seen := map[string]bool{}
+	for _, f := range p.Findings {
+		if k := f.Level + f.Code + f.Message; !seen[k] {
+			seen[k] = true
+			out = append(out, f)
+		}
+	}
+	sort.SliceStable(out, func(i, k int) bool {
+		if rank[out[i].Level] != rank[out[k].Level] {
+			return rank[out[i].Level] < rank[out[k].Level]
+		}
+		if out[i].Code != out[k].Code {
+			return out[i].Code < out[k].Code
+		}
+		return out[i].Path < out[k].Path
+	})
+	return out
+}
+
+func readComposeYAML(path string) (map[string]any, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var doc map[string]any
+	if err := yaml.Unmarshal(b, &doc); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if doc == nil {
+		doc = map[string]any{}
+	}
+	return doc, nil
+}
+
+// resolveExtends merges the service's extends chain (same file or another one,
+// relative to the extending file) under its own keys. Other files are
+// interpolated by in as well, so their findings are kept.
+func resolveExtends(path, name string, services map[string]any, in *interpolator, seen []string) (map[string]any, error) {
+	key := path + "#" + name
+	for _, s := range seen {
+		if s == key {
+			return nil, fmt.Errorf("extends cycle: %s", strings.Join(append(seen, key), " -> "))
+		}
+	}
+	svc, ok := services[name].(map[string]any)
+	if !ok {
+		if _, exists := services[name]; exists {
+			return map[string]any{}, nil // `db:` with no body
+		}
+		return nil, fmt.Errorf("service %q not found in %s", name, path)
+	}
+	ext, ok := svc["extends"]
+	if !ok {
+		return svc, nil
+	}
+
+	baseFile, baseName := path, ""
+	switch e := ext.(type) {
+	case string:
+		baseName = e
+	case map[string]any:
+		baseName, _ = e["service"].(string)
+		if f, _ := e["file"].(string); f != "" {
+			baseFile = filepath.Join(filepath.Dir(path), f)
+		}
+	}
+	if baseName == "" {
+		return nil, errors.New("extends needs a service")
+	}
+	baseServices := services
+	if baseFile != path {
+		doc, err := readComposeYAML(baseFile)
+		if err != nil {
+			return nil, err
+		}
+		doc = in.walk(doc, filepath.Base(baseFile)+":").(map[string]any)
+		baseServices, _ = doc["services"].(map[string]any)
+	}
+	base, err := resolveExtends(baseFile, baseName, baseServices, in, append(seen, key))
+	if err != nil {
+		return nil, err
+	}
+	merged := mergeCompose(base, svc).(map[string]any)
+	delete(merged, "extends")
+	return merged, nil
+}
+
+// mergeCompose overlays b on a: mappings merge per key, sequences append
+// (command/entrypoint, like scalars, are replaced).
+func mergeCompose(a, b any) any {
+	am, aok := a.(map[string]any)
+	bm, bok := b.(map[string]any)
+	if aok && bok {
+		out := map[string]any{}
+		for k, v := range am {
+			out[k] = v
+		}
+		for k, v := range bm {
+			if k == "command" || k == "entrypoint" {
+				out[k] = v
+			} else if old, ok := out[k]; ok {
+				out[k] = mergeCompose(old, v)
+			} else {
+				out[k] = v
+			}
+		}
+		return out
+	}
+	as, aok := a.([]any)
+	bs, bok := b.([]any)
+	if aok && bok {
+		return append(append([]any{}, as...), bs...)
+	}
+	return b
+}
+
+// ---------- ${VAR} interpolation ----------
+
+// interpolator expands ${VAR}, $VAR, ${VAR:-default}, ${VAR-default},
+// ${VAR:?err}, ${VAR?err}, ${VAR:+alt}, ${VAR+alt} and $$ in every string,
+// recording unset variables as findings.
+type interpolator struct {
+	env      map[string]string
+	findings []composeFinding
+}
+
+func (in *interpolator) walk(v any, path string) any {
+	switch t := v.(type) {
+	case map[string]any:
+		for k, x := range t {
+			t[k] = in.walk(x, joinPath(path, k))
+		}
+		return t
+	case []any:
+		for i, x := range t {
+			t[i] = in.walk(x, fmt.Sprintf("%s[%d]", path, i))
+		}
+		return t
+	case string:
+		return in.expand(t, path)
+	}
+	return v
+}
+
+func joinPath(path, k string) string {
+	if path == "" || strings.HasSuffix(path, ":") {
+		return path + k
+	}
+	return path + "." + k
+}
+
+func (in *interpolator) expand(s, path string) string {
+	lookup := func(name string) (string, bool) { v, ok := in.env[name]; return v, ok }
+	return expandVars(s, lookup, func(name, msg string, required bool) {
+		switch {
+		case name == "":
+			in.findings = append(in.findings, composeFinding{Level: "warning", Code: "bad-interpolation", Path: path,
+				Message: msg + "; it is left as is here, and compose may reject it",
+				Fix:     "use ${VAR}, ${VAR:-default} and the like, or $$ for a literal $"})
+		case required:
+			in.findings = append(in.findings, composeFinding{Level: "error", Code: "required-var", Path: path,
+				Message: fmt.Sprintf("${%s}: %s", name, msg), Fix: "set " + name + " in APP_ENV_FILE"})
+		default:
+			in.findings = append(in.findings, composeFinding{Level: "warning", Code: "unset-var", Path: path,
+				Message: fmt.Sprintf("%s is not set; compose substitutes an empty string", name),
+				Fix:     fmt.Sprintf("set %s in APP_ENV_FILE or use ${%s:-default}", name, name)})
+		}
+	})
+}
+
+// expandVars does compose's variable substitution on s; defaults may nest
+// (${A:-${B:-x}}). missing is called for a plain unset variable (required=false),
+// a failed ${VAR:?msg} / ${VAR?msg}, or with an empty name for an expression it
+// can't parse, which is kept literally.
+func expandVars(s string, lookup func(string) (string, bool), missing func(name, msg string, required bool)) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '$' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		switch c := s[i+1]; {
+		case c == '$':
+			b.WriteByte('$')
+			i++
+		case c == '{':
+			end := closingBrace(s, i+2)
+			if end < 0 {
+				missing("", fmt.Sprintf("unterminated %q", s[i:]), false)
+				b.WriteString(s[i:])
+				return b.String()
+			}
+			b.WriteString(expandExpr(s[i+2:end], lookup, missing))
+			i = end
+		case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+			n := varNameLen(s[i+1:])
+			name := s[i+1 : i+1+n]
+			val, set := lookup(name)
+			if !set {
+				missing(name, "", false)
+			}
+			b.WriteString(val)
+			i += n
+		default:
+			b.WriteByte('$')
+		}
+	}
+	return b.String()
+}
+
+// closingBrace returns the index of the } closing a ${ whose body starts at
+// from, skipping nested ${...} and $$, or -1.
+func closingBrace(s string, from int) int {
+	depth := 1
+	for i := from; i < len(s); i++ {
+		switch {
+		case s[i] == '$' && i+1 < len(s) && s[i+1] == '$':
+			i++
+		case s[i] == '$' && i+1 < len(s) && s[i+1] == '{':
+			depth++
+			i++
+		case s[i] == '}':
+			if depth--; depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+func varNameLen(s string) int {
+	n := 0
+	for n < len(s) && (s[n] == '_' || s[n] >= 'a' && s[n] <= 'z' || s[n] >= 'A' && s[n] <= 'Z' || s[n] >= '0' && s[n] <= '9') {
+		n++
+	}
+	return n
+}
+
+// expandExpr evaluates the inside of one ${...}.
+func expandExpr(expr string, lookup func(string) (string, bool), missing func(name, msg string, required bool)) string {
+	n := varNameLen(expr)
+	name, op, arg := expr[:n], "", ""
+	for _, o := range []string{":-", ":?", ":+", "-", "?", "+"} {
+		if strings.HasPrefix(expr[n:], o) {
+			op, arg = o, expr[n+len(o):]
+			break
+		}
+	}
+	if name == "" || name[0] >= '0' && name[0] <= '9' || op == "" && n < len(expr) {
+		missing("", fmt.Sprintf("invalid interpolation ${%s}", expr), false)
+		return "${" + expr + "}"
+	}
+	val, set := lookup(name)
+	empty := val == ""
+	switch op {
+	case ":-":
+		if empty {
+			return expandVars(arg, lookup, missing)
+		}
+	case "-":
+		if !set {
+			return expandVars(arg, lookup, missing)
+		}
+	case ":+":
+		if !empty {
+			return expandVars(arg, lookup, missing)
+		}
+		return ""
+	case "+":
+		if set {
+			return expandVars(arg, lookup, missing)
+		}
+		return ""
+	case ":?", "?":
+		if (op == ":?" && empty) || (op == "?" && !set) {
+			msg := arg
+			if msg == "" {
+				msg = "required variable " + name + " is missing a value"
+			}
+			missing(name, msg, true)
+		}
+	default:
+		if !set {
+			missing(name, "", false)
+		}
+	}
+	return val
+}
+
+// ---------- DB service checks ----------
+
+// validateDB checks what the agent relies on: the DB service exists and is
+// active, has a healthcheck, keeps its data in the named volume DB_VOLUME,
+// and gets the credentials its image needs.
+func (p *composeProject) validateDB(service, volKey string) {
+	add := func(f composeFinding) { p.Findings = append(p.Findings, f) }
+	svc, ok := p.Services[service]
+	if !ok {
+		names := make([]string, 0, len(p.Services))
+		for n := range p.Services {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		add(composeFinding{Level: "error", Code: "db-service-missing", Service: service,
+			Message: fmt.Sprintf("service %q is not in %s (services: %s)", service, p.File, strings.Join(names, ", ")),
+			Fix:     "set DB_SERVICE to one of the services above"})
+		return
+	}
+	sp := "services." + service
+
+	if profs := stringList(svc["profiles"]); len(profs) > 0 && !overlaps(profs, p.Profiles) {
+		add(composeFinding{Level: "warning", Code: "db-service-profile", Service: service, Path: sp + ".profiles",
+			Message: fmt.Sprintf("%s only starts with profile %s, which is not active", service, strings.Join(profs, " or ")),
+			Fix:     "set COMPOSE_PROFILES=" + profs[0] + " in APP_ENV_FILE, or drop profiles from the DB service"})
+	}
+	if _, ok := svc["image"]; !ok {
+		if _, ok := svc["build"]; !ok {
+			add(composeFinding{Level: "error", Code: "no-image", Service: service, Path: sp,
+				Message: service + " has neither image nor build", Fix: "add image: (e.g. postgres:16)"})
+		}
+	}
+
+	hc, _ := svc["healthcheck"].(map[string]any)
+	switch {
+	case hc == nil:
+		add(composeFinding{Level: "warning", Code: "no-healthcheck", Service: service, Path: sp + ".healthcheck",
+			Message: service + " has no healthcheck; readiness falls back to a probe (see READY_PROBE_<SERVICE>)",
+			Fix:     "add a healthcheck, e.g. test: [\"CMD-SHELL\", \"pg_isready -U $${POSTGRES_USER}\"]"})
+	case hc["disable"] == true:
+		add(composeFinding{Level: "warning", Code: "healthcheck-disabled", Service: service, Path: sp + ".healthcheck.disable",
+			Message: service + "'s healthcheck is disabled", Fix: "remove disable: true"})
+	}
+
+	p.validateVolume(service, svc, volKey)
+	p.validateCredentials(service, svc)
+}
+
+func (p *composeProject) validateVolume(service string, svc map[string]any, volKey string) {
+	add := func(f composeFinding) { p.Findings = append(p.Findings, f) }
+	sp := "services." + service
+	if volKey == "" {
+		add(composeFinding{Level: "warning", Code: "db-volume-unset", Service: service,
+			Message: "DB_VOLUME is not set, so reset and snapshots can't tell which volume holds the data",
+			Fix:     "set DB_VOLUME to the named volume mounted at the data directory"})
+		return
+	}
+	if _, ok := p.Volumes[volKey]; !ok {
+		add(composeFinding{Level: "error", Code: "db-volume-undeclared", Path: "volumes." + volKey,
+			Message: fmt.Sprintf("volume %q is not declared under top-level volumes:", volKey),
+			Fix:     fmt.Sprintf("add `volumes: {%s: {}}` at the top level", volKey)})
+	}
+	mounted, binds := false, []string{}
+	for _, v := range asSlice(svc["volumes"]) {
+		src, typ := "", ""
+		switch m := v.(type) {
+		case string:
+			src, _, _ = strings.Cut(m, ":")
+			typ = "volume"
+			if strings.HasPrefix(src, ".") || strings.HasPrefix(src, "/") || strings.HasPrefix(src, "~") {
+				typ = "bind"
+			}
+		case map[string]any:
+			src, _ = m["source"].(string)
+			typ, _ = m["type"].(string)
+		}
+		if typ == "volume" && src == volKey {
+			mounted = true
+		}
+		if typ == "bind" {
+			binds = append(binds, src)
+		}
+	}
+	if !mounted {
+		f := composeFinding{Level: "error", Code: "db-volume-not-mounted", Service: service, Path: sp + ".volumes",
+			Message: fmt.Sprintf("%s doesn't mount the named volume %q", service, volKey),
+			Fix:     fmt.Sprintf("mount it at the data directory, e.g. - %s:/var/lib/postgresql/data", volKey)}
+		if len(binds) > 0 {
+			f.Message += fmt.Sprintf(" (it uses bind mounts %s, which snapshots and resets don't cover)", strings.Join(binds, ", "))
+		}
+		add(f)
+	}
+}
+
+// validateCredentials checks the env the official image needs to initialise.
+func (p *composeProject) validateCredentials(service string, svc map[string]any) {
+	image, _ := svc["image"].(string)
+	kind, err := normalizeDBKind(image)
+	if err != nil {
+		return
+	}
+	env := serviceEnv(svc)
+	need := ""
+	switch kind {
+	case "postgres":
+		if env["POSTGRES_PASSWORD"] == "" && env["POSTGRES_HOST_AUTH_METHOD"] != "trust" {
+			need = "POSTGRES_PASSWORD"
+		}
+	case "mysql":
+		if env["MYSQL_ROOT_PASSWORD"] == "" && env["MARIADB_ROOT_PASSWORD"] == "" &&
+			env["MYSQL_ALLOW_EMPTY_PASSWORD"] == "" && env["MARIADB_ALLOW_EMPTY_ROOT_PASSWORD"] == "" &&
+			env["MYSQL_RANDOM_ROOT_PASSWORD"] == "" && env["MARIADB_RANDOM_ROOT_PASSWORD"] == "" {
+			need = "MYSQL_ROOT_PASSWORD"
+		}
+	}
+	if need != "" && svc["env_file"] == nil { // with env_file we can't tell
+		p.Findings = append(p.Findings, composeFinding{Level: "error", Code: "db-credentials", Service: service, Path: "services." + service + ".environment",
+			Message: fmt.Sprintf("%s (%s) won't initialise without %s", service, image, need),
+			Fix:     fmt.Sprintf("add %s: ${%s} under environment and set it in APP_ENV_FILE", need, need)})
+	}
+}
+
+// serviceEnv reads environment: as a mapping or a KEY=VALUE list.
+func serviceEnv(svc map[string]any) map[string]string {
+	env := map[string]string{}
+	switch e := svc["environment"].(type) {
+	case map[string]any:
+		for k, v := range e {
+			if v != nil {
+				env[k] = fmt.Sprint(v)
+			}
+		}
+	case []any:
+		for _, x := range e {
+			if k, v, ok := strings.Cut(fmt.Sprint(x), "="); ok {
+				env[k] = v
+			}
+		}
+	}
+	return env
+}
+
+func asSlice(v any) []any {
+	if s, ok := v.([]any); ok {
+		return s
+	}
+	return nil
+}
+
+func stringList(v any) []string {
+	var out []string
+	for _, x := range asSlice(v) {
+		out = append(out, fmt.Sprint(x))
+	}
+	return out
+}
+
+func overlaps(a, b []string) bool {
+	for _, x := range a {
+		if contains(b, x) {
+			return true
+		}
+	}
+	return false
+}
+
+// validateServices checks that services exist before `up`/`stop`.
+func (p *composeProject) validateServices(services []string) {
+	for _, s := range services {
+		if _, ok := p.Services[s]; !ok {
+			p.Findings = append(p.Findings, composeFinding{Level: "error", Code: "service-missing", Service: s,
+				Message: fmt.Sprintf("service %q is not in %s", s, p.File)})
+		}
+	}
+}
+
+// validateEnvFiles reports APP_ENV_FILE lines the dotenv parser rejected.
+// They are warnings: the lines are skipped, so their variables end up unset,
+// and compose may read them differently.
+func (p *composeProject) validateEnvFiles() {
+	_, err := loadDotenv(os.Getenv("APP_ENV_FILE"))
+	for _, e := range dotenvErrors(err) {
+		p.Findings = append(p.Findings, composeFinding{Level: "warning", Code: "env-file",
+			Message: e.Error(), Fix: "fix the line (quote values containing spaces, # or $; close multi-line quotes)"})
+	}
+}
+
+// composeErrors returns the error-level findings as one error, or nil.
+func composeErrors(findings []composeFinding) error {
+	var msgs []string
+	for _, f := range findings {
+		if f.Level == "error" {
+			msgs = append(msgs, f.Message)
+		}
+	}
+	if len(msgs) == 0 {
+		return nil
+	}
+	return fmt.Errorf("compose file problems (run validate for details): %s", strings.Join(msgs, "; "))
+}
+
+// precheckCompose validates the file before compose runs, so mistakes come
+// back as findings instead of compose's stderr.
+func precheckCompose(composeFile string, services []string) error {
+	p, err := loadCompose(composeFile, composeEnv())
+	if err != nil {
+		return err
+	}
+	p.validateServices(services)
+	p.validateEnvFiles()
+	return composeErrors(p.Findings)
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestExpandVars(t *testing.T) {
+	env := map[string]string{"A": "1", "EMPTY": ""}
+	lookup := func(name string) (string, bool) { v, ok := env[name]; return v, ok }
+	tests := []struct {
+		in, want string
+		missing  []string // name, or name! when required, or "" for unparseable
+	}{
+		{"$A ${A}x $$A", "1 1x $A", nil},
+		{"${A}${A}", "11", nil},
+		{"x${NOPE}y$NOPE", "xy", []string{"NOPE", "NOPE"}},
+		{"${NOPE:-d} ${EMPTY:-d} ${A:-d}", "d d 1", nil},
+		{"${NOPE-d} ${EMPTY-d}", "d ", nil},
+		{"${A:+alt} ${EMPTY:+alt} ${EMPTY+alt} ${NOPE+alt}", "alt  alt ", nil},
+		{"${NOPE:-${A}}", "1", nil},
+		{"${NOPE:-${NADA:-deep}}/x", "deep/x", nil},
+		{"${NOPE:-pre-${A}-post}", "pre-1-post", nil},
+		{"${A:+${NOPE:-b}}", "b", nil},
+		{"${NOPE:-$${A}}", "${A}", nil},
+		{"${NOPE:-${NADA}}", "", []string{"NADA"}},
+		{"${NOPE:-a}}", "a}", nil},
+		{"${NOPE:?set it} ${EMPTY:?} ${EMPTY?x}", "  ", []string{"NOPE!", "EMPTY!"}},
+		{"$1 cost $ and $-", "$1 cost $ and $-", nil},
+		{"${A B}", "${A B}", []string{""}},
+		{"${1X}", "${1X}", []string{""}},
+		{"${}", "${}", []string{""}},
+		{"x ${A", "x ${A", []string{""}},
+		{"${NOPE:-${A}", "${NOPE:-${A}", []string{""}},
+	}
+	for _, tt := range tests {
+		var missing []string
+		got := expandVars(tt.in, lookup, func(name, msg string, required bool) {
+			if required {
+				name += "!"
+			}
+			missing = append(missing, name)
+		})
+		if got != tt.want || !reflect.DeepEqual(missing, tt.missing) {
+			t.Errorf("expandVars(%q) = %q, missing %q; want %q, missing %q", tt.in, got, missing, tt.want, tt.missing)
+		}
+	}
+}
+
+// writeCompose writes a compose file into a temp dir and returns its path.
+func writeCompose(t *testing.T, src string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "compose.yml")
+	if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestValidateDB(t *testing.T) {
+	const good = `
+services:
+  db:
+    image: postgres:16
+    environment:
+      POSTGRES_PASSWORD: secret
+    healthcheck:
+      test: ["CMD", "pg_isready"]
+    volumes:
+      - db_data:/var/lib/postgresql/data
+volumes:
+  db_data: {}
+`
+	tests := []struct {
+		name, src, service, volume string
+		want                       []string // finding codes
+	}{
+		{"ok", good, "db", "db_data", nil},
+		{"missing service", good, "database", "db_data", []string{"db-service-missing"}},
+		{"volume unset", good, "db", "", []string{"db-volume-unset"}},
+		{"other volume", good, "db", "pg_data", []string{"db-volume-not-mounted", "db-volume-undeclared"}},
+		{"bare minimum", `
+services:
+  db:
+    image: postgres:16
+`, "db", "db_data", []string{"db-credentials", "db-volume-not-mounted", "db-volume-undeclared", "no-healthcheck"}},
+		{"bind mount", `
+services:
+  db:
+    image: mysql:8
+    environment: ["MYSQL_ROOT_PASSWORD=x"]
+    healthcheck: {disable: true}
+    volumes:
+      - ./data:/var/lib/mysql
+volumes:
+  db_data:
+`, "db", "db_data", []string{"db-volume-not-mounted", "healthcheck-disabled"}},
+		{"long volume syntax", `
+services:
+  db:
+    image: postgres:16
+    env_file: db.env
+    healthcheck: {test: ["CMD", "pg_isready"]}
+    volumes:
+      - {type: volume, source: db_data, target: /var/lib/postgresql/data}
+volumes:
+  db_data:
+`, "db", "db_data", nil},
+		{"inactive profile", `
+services:
+  db:
+    build: .
+    profiles: [database]
+    healthcheck: {test: ["CMD", "true"]}
+    volumes: [db_data:/data]
+volumes:
+  db_data:
+`, "db", "db_data", []string{"db-service-profile"}},
+		{"no image", `
+services:
+  db:
+    healthcheck: {test: ["CMD", "true"]}
+    volumes: [db_data:/data]
+volumes:
+  db_data:
+`, "db", "db_data", []string{"no-image"}},
+		{"extends", `
+services:
+  base:
+    image: postgres:16
+    environment: {POSTGRES_HOST_AUTH_METHOD: trust}
+    healthcheck: {test: ["CMD", "pg_isready"]}
+  db:
+    extends: base
+    volumes: [db_data:/var/lib/postgresql/data]
+volumes:
+  db_data:
+`, "db", "db_data", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := loadCompose(writeCompose(t, tt.src), map[string]string{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			p.validateDB(tt.service, tt.volume)
+			var got []string
+			for _, f := range p.Findings {
+				got = append(got, f.Code)
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("findings = %q, want %q\n%+v", got, tt.want, p.Findings)
+			}
+		})
+	}
+}
+
+func TestPrecheckCompose(t *testing.T) {
+	tests := []struct {
+		name, compose, envFile string
+		services               []string
+		wantErr                string
+	}{
+		{"ok", "image: postgres:${PG_VERSION}", "PG_VERSION=16", []string{"db"}, ""},
+		{"unset is a warning", "image: postgres:${PG_VERSION}", "", []string{"db"}, ""},
+		{"nested default", "image: postgres:${PG_VERSION:-${PG_MAJOR:-16}}", "", []string{"db"}, ""},
+		{"bad interpolation is a warning", "image: postgres:${PG VERSION}", "", []string{"db"}, ""},
+		{"env lines compose accepts", "image: postgres:${PG_VERSION}", "PG_VERSION: 16\nHOME\nexport X=1", []string{"db"}, ""},
+		{"bad env line is a warning", "image: postgres:${PG_VERSION}", "PG_VERSION=16\nnot a line\nY='open", []string{"db"}, ""},
+		{"required var", "image: postgres:${PG_VERSION:?set PG_VERSION}", "", []string{"db"}, "set PG_VERSION"},
+		{"unknown service", "image: postgres:16", "", []string{"db", "cache"}, `service "cache" is not in`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			compose := writeCompose(t, "services:\n  db:\n    "+tt.compose+"\n")
+			envFile := filepath.Join(filepath.Dir(compose), "app.env")
+			if err := os.WriteFile(envFile, []byte(tt.envFile), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			t.Setenv("APP_DIR", filepath.Dir(compose))
+			t.Setenv("APP_ENV_FILE", envFile)
+			for _, k := range []string{"PG_VERSION", "PG_MAJOR"} {
+				t.Setenv(k, "") // restored afterwards
+				os.Unsetenv(k)
+			}
+
+			err := precheckCompose(compose, tt.services)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("precheckCompose: %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("precheckCompose = %v, want error %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ---------- Config file (named profiles) ----------
+
+// configNames are looked up in the working directory, then its parents.
+var configNames = []string{"compose-db-agent.yaml", "compose-db-agent.yml", ".compose-db-agent.yaml", ".compose-db-agent.yml"}
+
+// agentProfile is one app the agent can target; every setting maps to the env
+// var the tools already read.
+type agentProfile struct {
+	Project       string            `yaml:"project" json:"project,omitempty"`
+	ComposeFile   string            `yaml:"compose_file" json:"compose_file,omitempty"`
+	DBService     string            `yaml:"db_service" json:"db_service,omitempty"`
+	DBVolume      string            `yaml:"db_volume" json:"db_volume,omitempty"`
+	AppDir        string            `yaml:"app_dir" json:"app_dir,omitempty"`
+	AppEnvFile    string            `yaml:"app_env_file" json:"app_env_file,omitempty"`
+	SeedFile      string            `yaml:"seed_file" json:"seed_file,omitempty"`
+	MigrationsDir string            `yaml:"migrations_dir" json:"migrations_dir,omitempty"`
+	SnapshotDir   string            `yaml:"snapshot_dir" json:"snapshot_dir,omitempty"`
+	Env           map[string]string `yaml:"env" json:"-"` // any other setting (DB_ENGINE, PORT_REMAP, READY_PROBE_DB, ...)
+}
+
+type agentConfig struct {
+	Path     string                   `yaml:"-"`
+	Default  string                   `yaml:"default"`
+	Profiles map[string]*agentProfile `yaml:"profiles"`
+}
+
+// activeConfig and activeProfile are set by loadProfile; replacedEnv holds the
+// env values the active profile overwrote (nil: was unset), so a switch can undo them.
+var (
+	activeConfig  *agentConfig
+	activeProfile string
+	replacedEnv   map[string]*string
+)
+
+// findConfig returns AGENT_CONFIG, else the first config file in dir or a parent.
+func findConfig(dir string) string {
+	if p := os.Getenv("AGENT_CONFIG"); p != "" {
+		return p
+	}
+	for {
+		for _, n := range configNames {
+			p := filepath.Join(dir, n)
+			if st, err := os.Stat(p); err == nil && !st.IsDir() {
+				return p
+			}
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+func readConfig(path string) (*agentConfig, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &agentConfig{Path: path}
+	// unknown keys are errors: a misspelled compose_file would silently target another project
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true)
+	if err := dec.Decode(cfg); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if cfg.Default != "" && cfg.Profiles[cfg.Default] == nil {
+		return nil, fmt.Errorf("%s: default profile %q is not defined", path, cfg.Default)
+	}
+	for name, p := range cfg.Profiles {
+		if p == nil {
+			cfg.Profiles[name] = &agentProfile{}
+		}
+	}
+	return cfg, nil
+}
+
+// profileNames returns the profile names, sorted.
+func (c *agentConfig) profileNames() []string {
+	names := make([]string, 0, len(c.Profiles))
+	for n := range c.Profiles {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// pick chooses the profile: the requested name, else the config's default,
+// else the only one. Empty means none (plain env).
+func (c *agentConfig) pick(name string) (string, error) {
+	if name == "" {
+		name = c.Default
+	}
+	if name == "" && len(c.Profiles) == 1 {
+		name = c.profileNames()[0]
+	}
+	if name != "" && c.Profiles[name] == nil {
+		return "", fmt.Errorf("no profile %q in %s (have: %s)", name, c.Path, strings.Join(c.profileNames(), ", "))
+	}
+	return name, nil
+}
+
+// settings maps the profile to env vars. Paths are relative to the config file,
+// except seed_file and migrations_dir, which stay relative to APP_DIR.
+func (p *agentProfile) settings(base string) map[string]string {
+	rel := func(path string) string {
+		if path == "" || filepath.IsAbs(path) {
+			return path
+		}
+		return filepath.Join(base, path)
+	}
+	env := map[string]string{}
+	for k, v := range p.Env {
+		env[k] = v
+	}
+	files := envFiles(p.AppEnvFile)
+	for i, f := range files {
+		files[i] = rel(f)
+	}
+	for k, v := range map[string]string{
+		"PROJECT":        p.Project,
+		"COMPOSE_FILE":   rel(p.ComposeFile),
+		"DB_SERVICE":     p.DBService,
+		"DB_VOLUME":      p.DBVolume,
+		"APP_DIR":        rel(p.AppDir),
+		"APP_ENV_FILE":   strings.Join(files, ","),
+		"SEED_FILE":      p.SeedFile,
+		"MIGRATIONS_DIR": p.MigrationsDir,
+		"SNAPSHOT_DIR":   rel(p.SnapshotDir),
+	} {
+		if v != "" {
+			env[k] = v
+		}
+	}
+	return env
+}
+
+// loadProfile finds the config file and applies the selected profile (flag,
+// else AGENT_PROFILE, else the default) over the process env, replacing the
+// previous one. No config file is fine unless a profile was asked for.
+func loadProfile(name string) error {
+	if name == "" {
+		name = os.Getenv("AGENT_PROFILE")
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	path := findConfig(wd)
+	if path == "" {
+		if name != "" {
+			return fmt.Errorf("profile %q requested but no %s found in %s or its parents", name, configNames[0], wd)
+		}
+		return nil
+	}
+	cfg, err := readConfig(path)
+	if err != nil {
+		return err
+	}
+	picked, err := cfg.pick(name)
+	if err != nil {
+		return err
+	}
+	host, cmd := os.Getenv("DOCKER_HOST"), os.Getenv("COMPOSE_CMD")
+	restoreEnv()
+	activeConfig, activeProfile = cfg, picked
+	if picked != "" {
+		for k, v := range cfg.Profiles[picked].settings(filepath.Dir(path)) {
+			if old, ok := os.LookupEnv(k); ok {
+				replacedEnv[k] = &old
+			} else {
+				replacedEnv[k] = nil
+			}
+			os.Setenv(k, v)
+		}
+	}
+	dryRun = os.Getenv("DRY_RUN") == "1" // read at startup, before the profile applied
+	reloadClients(host, cmd)
+	return nil
+}
+
+// reloadClients rebuilds the Docker client and re-detects the compose command
+// if DOCKER_HOST or COMPOSE_CMD changed from host and cmd.
+func reloadClients(host, cmd string) {
+	if os.Getenv("DOCKER_HOST") != host {
+		engine = dockerFromEnv()
+	}
+	if os.Getenv("COMPOSE_CMD") != cmd {
+		composeBase = detectCompose()
+	}
+}
+
+// restoreEnv undoes the active profile's settings.
+func restoreEnv() {
+	for k, v := range replacedEnv {
+		if v == nil {
+			os.Unsetenv(k)
+		} else {
+			os.Setenv(k, *v)
+		}
+	}
+	replacedEnv = map[string]*string{}
+}
+
+// profileEnv returns another profile's settings without applying them, from
+// the active config or else the one found from the working directory.
+func profileEnv(name string) (map[string]string, error) {
+	cfg := activeConfig
+	if cfg == nil {
+		wd, err := os.Getwd()
+		if err != nil {
+			return nil, err
+		}
+		path := findConfig(wd)
+		if path == "" {
+			return nil, fmt.Errorf("profile %q requested but no %s found in %s or its parents", name, configNames[0], wd)
+		}
+		if cfg, err = readConfig(path); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.Profiles[name] == nil {
+		return nil, fmt.Errorf("no profile %q in %s (have: %s)", name, cfg.Path, strings.Join(cfg.profileNames(), ", "))
+	}
+	return cfg.Profiles[name].settings(filepath.Dir(cfg.Path)), nil
+}
+
+// withProfileEnv runs fn with the named profile applied in place of the active
+// one (compose project directory, env file, DB_ENGINE, ...), then switches back.
+func withProfileEnv(name string, fn func() error) error {
+	env, err := profileEnv(name)
+	if err != nil {
+		return err
+	}
+	saved := map[string]*string{}
+	set := func(k string, v *string) {
+		if _, ok := saved[k]; !ok {
+			if old, ok := os.LookupEnv(k); ok {
+				saved[k] = &old
+			} else {
+				saved[k] = nil
+			}
+		}
+		if v == nil {
+			os.Unsetenv(k)
+		} else {
+			os.Setenv(k, *v)
+		}
+	}
+	host, cmd := os.Getenv("DOCKER_HOST"), os.Getenv("COMPOSE_CMD")
+	for k, v := range replacedEnv {
+		set(k, v) // the env without the active profile
+	}
+	for k, v := range env {
+		set(k, &v)
+	}
+	reloadClients(host, cmd)
+	defer func() {
+		host, cmd := os.Getenv("DOCKER_HOST"), os.Getenv("COMPOSE_CMD")
+		for k, v := range saved {
+			if v == nil {
+				os.Unsetenv(k)
+			} else {
+				os.Setenv(k, *v)
+			}
+		}
+		reloadClients(host, cmd)
+	}()
+	return fn()
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadConfig(t *testing.T) {
+	tests := []struct {
+		name, yaml, wantErr string
+	}{
+		{"ok", "default: shop\nprofiles:\n  shop:\n    project: shop\n    compose_file: docker-compose.yml\n    env:\n      DB_ENGINE: postgres\n", ""},
+		{"empty", "", ""},
+		{"misspelled key", "profiles:\n  shop:\n    compose_fle: docker-compose.yml\n", "field compose_fle not found"},
+		{"unknown top-level key", "profile:\n  shop: {}\n", "field profile not found"},
+		{"missing default", "default: blog\nprofiles:\n  shop: {}\n", `default profile "blog" is not defined`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "compose-db-agent.yaml")
+			if err := os.WriteFile(path, []byte(tt.yaml), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			cfg, err := readConfig(path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.name == "ok" && (cfg.Profiles["shop"].ComposeFile != "docker-compose.yml" || cfg.Profiles["shop"].Env["DB_ENGINE"] != "postgres") {
+				t.Errorf("profile = %+v", cfg.Profiles["shop"])
+			}
+		})
+	}
+}
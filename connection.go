@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ---------- Connection info (DSNs for the published DB port) ----------
+
+type connectionInfo struct {
+	Engine      string `json:"engine"`
+	Host        string `json:"host"`
+	Port        int    `json:"port"`
+	User        string `json:"user,omitempty"`
+	Database    string `json:"database"`
+	URL         string `json:"url"`
+	InternalURL string `json:"internal_url"` // from other containers on the compose network
+	Libpq       string `json:"libpq,omitempty"`
+	JDBC        string `json:"jdbc,omitempty"`
+	Env         string `json:"env"`
+	// RemappedFrom is the compose file's host port when a port override moved it
+	RemappedFrom int    `json:"remapped_from,omitempty"`
+	Redacted     bool   `json:"password_redacted,omitempty"`
+	File         string `json:"file,omitempty"`
+}
+
+// passwordMask stands in for the password in redacted output.
+const passwordMask = "****"
+
+// unmaskEscapes undoes URL escaping of passwordMask, so redacted URLs read as ****.
+func unmaskEscapes(s string) string {
+	return strings.ReplaceAll(s, url.QueryEscape(passwordMask), passwordMask)
+}
+
+// redacted is connectionFor with the password masked.
+func redacted(t dbTarget, c dbCreds, host string, port int) connectionInfo {
+	c.Password = passwordMask
+	ci := connectionFor(t, c, host, port)
+	ci.URL, ci.InternalURL, ci.JDBC, ci.Env = unmaskEscapes(ci.URL), unmaskEscapes(ci.InternalURL), unmaskEscapes(ci.JDBC), unmaskEscapes(ci.Env)
+	ci.Redacted = true
+	return ci
+}
+
+// publishedAddr returns the host address DB_SERVICE publishes the engine's port on.
+func publishedAddr(t dbTarget, port int) (string, int, error) {
+	id, err := containerID(t.Project, t.Service)
+	if err != nil {
+		return "", 0, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), defaultAPITimeout)
+	defer cancel()
+	info, err := engine.ContainerInspect(ctx, id)
+	if err != nil {
+		return "", 0, err
+	}
+	for _, pp := range publishedPorts(info) {
+		if pp[0] != strconv.Itoa(port)+"/tcp" {
+			continue
+		}
+		host, p, _ := net.SplitHostPort(pp[1])
+		n, _ := strconv.Atoi(p)
+		return host, n, nil
+	}
+	return "", 0, fmt.Errorf("%s doesn't publish port %d to the host (add it under ports: in the compose file)", t.Service, port)
+}
+
+// connectionFor renders every DSN format for c at host:port.
+func connectionFor(t dbTarget, c dbCreds, host string, port int) connectionInfo {
+	d := driverFor(c.Kind)
+	ci := connectionInfo{
+		Engine: c.Kind, Host: host, Port: port, User: c.User, Database: c.Database,
+		URL:         d.URL(c, host, port),
+		InternalURL: d.URL(c, t.Service, d.DefaultPort()),
+	}
+	switch c.Kind {
+	case "postgres":
+		ci.Libpq = libpqDSN(map[string]string{"host": host, "port": strconv.Itoa(port), "user": c.User, "password": c.Password, "dbname": c.Database})
+		ci.JDBC = jdbcURL("postgresql", c, host, port)
+	case "mysql":
+		ci.JDBC = jdbcURL("mysql", c, host, port)
+	}
+	ci.Env = envBlock(connectionEnv(ci, c))
+	return ci
+}
+
+// libpqDSN renders keyword=value pairs (fixed order), quoting values as libpq expects.
+func libpqDSN(kv map[string]string) string {
+	var parts []string
+	for _, k := range []string{"host", "port", "user", "password", "dbname"} {
+		v := kv[k]
+		if v == "" {
+			continue
+		}
+		if strings.ContainsAny(v, ` '\`) {
+			v = "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(v) + "'"
+		}
+		parts = append(parts, k+"="+v)
+	}
+	return strings.Join(parts, " ")
+}
+
+func jdbcURL(sub string, c dbCreds, host string, port int) string {
+	q := url.Values{}
+	if c.User != "" {
+		q.Set("user", c.User)
+	}
+	if c.Password != "" {
+		q.Set("password", c.Password)
+	}
+	u := "jdbc:" + sub + "://" + net.JoinHostPort(host, strconv.Itoa(port)) + "/" + url.PathEscape(c.Database)
+	if len(q) > 0 {
+		u += "?" + q.Encode()
+	}
+	return u
+}
+
+// connectionEnv is the env block: DATABASE_URL plus its parts, in a stable order.
+func connectionEnv(ci connectionInfo, c dbCreds) [][2]string {
+	return [][2]string{
+		{"DATABASE_URL", ci.URL},
+		{"DB_HOST", ci.Host},
+		{"DB_PORT", strconv.Itoa(ci.Port)},
+		{"DB_USER", c.User},
+		{"DB_PASSWORD", c.Password},
+		{"DB_NAME", c.Database},
+	}
+}
+
+func envBlock(kv [][2]string) string {
+	var b strings.Builder
+	for _, p := range kv {
+		b.WriteString(p[0] + "=" + dotenvValue(p[1]) + "\n")
+	}
+	return b.String()
+}
+
+// dotenvValue quotes values that a dotenv loader would otherwise mangle:
+// single quotes (literal) when possible, else double quotes with escapes.
+func dotenvValue(v string) string {
+	if !strings.ContainsAny(v, " #\"'$\\\n") {
+		return v
+	}
+	if !strings.ContainsAny(v, "'\n") {
+		return "'" + v + "'"
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `\$`, "\n", `\n`).Replace(v) + `"`
+}
+
+// writeConnectionFile writes the (unredacted) info for the app: a JSON object for
+// *.json, else the env block, updating existing keys in place and keeping other lines.
+func writeConnectionFile(path string, ci connectionInfo, c dbCreds) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	kv := connectionEnv(ci, c)
+	if strings.HasSuffix(path, ".json") {
+		m := map[string]string{}
+		for _, p := range kv {
+			m[p[0]] = p[1]
+		}
+		b, _ := json.MarshalIndent(m, "", "  ")
+		return os.WriteFile(path, append(b, '\n'), 0o600)
+	}
+
+	var lines []string
+	if f, err := os.Open(path); err == nil {
+		sc := bufio.NewScanner(f)
+		for sc.Scan() {
+			lines = append(lines, sc.Text())
+		}
+		f.Close()
+		if err := sc.Err(); err != nil {
+			return err
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	done := map[string]bool{}
+	for i, l := range lines {
+		key, _, ok := strings.Cut(strings.TrimPrefix(strings.TrimSpace(l), "export "), "=")
+		if !ok {
+			continue
+		}
+		for _, p := range kv {
+			if strings.TrimSpace(key) == p[0] {
+				lines[i] = p[0] + "=" + dotenvValue(p[1])
+				done[p[0]] = true
+			}
+		}
+	}
+	for _, p := range kv {
+		if !done[p[0]] {
+			lines = append(lines, p[0]+"="+dotenvValue(p[1]))
+		}
+	}
+	return os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o600)
+}
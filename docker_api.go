@@ -0,0 +1,510 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ---------- Docker Engine API client (HTTP over the daemon socket) ----------
+
+// Pinned so responses have a stable shape; 1.41 ships with Docker 20.10+.
+const dockerAPIVersion = "v1.41"
+
+// Timeout for short request/response calls (not streams).
+const defaultAPITimeout = 10 * time.Second
+
+type dockerClient struct {
+	http *http.Client
+	base string // e.g. "http://docker" for unix sockets, "http://host:2375" for tcp
+	host string // as configured, for error messages
+}
+
+// dockerError is a non-2xx answer from the daemon ({"message": "..."}).
+type dockerError struct {
+	Status  int
+	Message string
+}
+
+func (e *dockerError) Error() string {
+	return fmt.Sprintf("docker api: %d %s", e.Status, e.Message)
+}
+
+func isNotFound(err error) bool {
+	var de *dockerError
+	return errors.As(err, &de) && de.Status == http.StatusNotFound
+}
+
+var engine *dockerClient
+
+func init() {
+	engine = dockerFromEnv()
+}
+
+// dockerFromEnv builds the client for the current DOCKER_HOST, falling back to
+// the default socket if it is unusable.
+func dockerFromEnv() *dockerClient {
+	c, err := newDockerClient(os.Getenv("DOCKER_HOST"))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "warning:", err, "(falling back to default socket)")
+		c, _ = newDockerClient("")
+	}
+	return c
+}
+
+// newDockerClient builds a client for DOCKER_HOST (unix:// or tcp://).
+// Empty host means /var/run/docker.sock, or Colima's socket if that is missing.
+func newDockerClient(host string) (*dockerClient, error) {
+	if host == "" {
+		host = "unix:///var/run/docker.sock"
+		if _, err := os.Stat("/var/run/docker.sock"); err != nil {
+			if home, _ := os.UserHomeDir(); home != "" {
+				colima := filepath.Join(home, ".colima", "default", "docker.sock")
+				if _, err := os.Stat(colima); err == nil {
+					host = "unix://" + colima
+				}
+			}
+		}
+	}
+	u, err := url.Parse(host)
+	if err != nil {
+		return nil, fmt.Errorf("invalid DOCKER_HOST %q: %w", host, err)
+	}
+
+	tr := &http.Transport{}
+	c := &dockerClient{host: host}
+	switch u.Scheme {
+	case "unix":
+		sock := u.Path
+		tr.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", sock)
+		}
+		c.base = "http://docker"
+	case "tcp", "http":
+		c.base = "http://" + u.Host
+	default:
+		return nil, fmt.Errorf("unsupported DOCKER_HOST scheme %q (want unix:// or tcp://)", u.Scheme)
+	}
+	c.http = &http.Client{Transport: tr}
+	return c, nil
+}
+
+// do sends a request (JSON body, if any) and returns the open response; non-2xx becomes *dockerError.
+func (c *dockerClient) do(ctx context.Context, method, path string, q url.Values, body io.Reader) (*http.Response, error) {
+	return c.send(ctx, method, path, q, "application/json", body)
+}
+
+func (c *dockerClient) send(ctx context.Context, method, path string, q url.Values, ctype string, body io.Reader) (*http.Response, error) {
+	u := c.base + "/" + dockerAPIVersion + path
+	if len(q) > 0 {
+		u += "?" + q.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", ctype)
+	}
+	res, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("docker api (%s): %w", c.host, err)
+	}
+	if res.StatusCode >= 300 {
+		defer res.Body.Close()
+		b, _ := io.ReadAll(res.Body)
+		var m struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(b, &m) != nil || m.Message == "" {
+			m.Message = strings.TrimSpace(string(b))
+		}
+		return nil, &dockerError{Status: res.StatusCode, Message: m.Message}
+	}
+	return res, nil
+}
+
+// getJSON decodes a GET response into out.
+func (c *dockerClient) getJSON(ctx context.Context, path string, q url.Values, out any) error {
+	res, err := c.do(ctx, http.MethodGet, path, q, nil)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	return json.NewDecoder(res.Body).Decode(out)
+}
+
+// ---------- Response types (only the fields we use) ----------
+
+type containerSummary struct {
+	ID     string            `json:"Id"`
+	Names  []string          `json:"Names"`
+	Image  string            `json:"Image"`
+	State  string            `json:"State"`
+	Status string            `json:"Status"`
+	Labels map[string]string `json:"Labels"`
+	Ports  []struct {
+		IP          string `json:"IP"`
+		PrivatePort int    `json:"PrivatePort"`
+		PublicPort  int    `json:"PublicPort"`
+		Type        string `json:"Type"`
+	} `json:"Ports"`
+}
+
+type healthLog struct {
+	Start    time.Time `json:"Start"`
+	End      time.Time `json:"End"`
+	ExitCode int       `json:"ExitCode"`
+	Output   string    `json:"Output"`
+}
+
+type containerState struct {
+	Status     string `json:"Status"` // created | running | restarting | exited | ...
+	Running    bool   `json:"Running"`
+	Restarting bool   `json:"Restarting"`
+	OOMKilled  bool   `json:"OOMKilled"`
+	Dead       bool   `json:"Dead"`
+	ExitCode   int    `json:"ExitCode"`
+	Error      string `json:"Error"`
+	Health     *struct {
+		Status        string      `json:"Status"` // starting | healthy | unhealthy
+		FailingStreak int         `json:"FailingStreak"`
+		Log           []healthLog `json:"Log"`
+	} `json:"Health"`
+}
+
+type containerJSON struct {
+	ID           string         `json:"Id"`
+	Name         string         `json:"Name"`
+	RestartCount int            `json:"RestartCount"`
+	State        containerState `json:"State"`
+	Config       struct {
+		Image  string            `json:"Image"`
+		Tty    bool              `json:"Tty"`
+		Env    []string          `json:"Env"`
+		Labels map[string]string `json:"Labels"`
+	} `json:"Config"`
+	Mounts []struct {
+		Type        string `json:"Type"` // volume | bind | tmpfs
+		Name        string `json:"Name"`
+		Destination string `json:"Destination"`
+	} `json:"Mounts"`
+	NetworkSettings struct {
+		// "5432/tcp" -> host bindings (empty for unpublished ports)
+		Ports map[string][]struct {
+			HostIP   string `json:"HostIp"`
+			HostPort string `json:"HostPort"`
+		} `json:"Ports"`
+	} `json:"NetworkSettings"`
+}
+
+type volume struct {
+	Name       string            `json:"Name"`
+	Driver     string            `json:"Driver"`
+	Mountpoint string            `json:"Mountpoint"`
+	Labels     map[string]string `json:"Labels"`
+}
+
+// dockerEvent is one message from GET /events.
+type dockerEvent struct {
+	Type   string `json:"Type"`
+	Action string `json:"Action"` // e.g. "die", "oom", "health_status: healthy"
+	Actor  struct {
+		ID         string            `json:"ID"`
+		Attributes map[string]string `json:"Attributes"`
+	} `json:"Actor"`
+	TimeNano int64 `json:"timeNano"`
+}
+
+// ---------- Endpoints ----------
+
+func (c *dockerClient) Ping(ctx context.Context) error {
+	res, err := c.do(ctx, http.MethodGet, "/_ping", nil, nil)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	return nil
+}
+
+// ContainerList returns containers matching label filters ("key=value").
+func (c *dockerClient) ContainerList(ctx context.Context, all bool, labels ...string) ([]containerSummary, error) {
+	q := url.Values{}
+	if all {
+		q.Set("all", "1")
+	}
+	if len(labels) > 0 {
+		f, _ := json.Marshal(map[string][]string{"label": labels})
+		q.Set("filters", string(f))
+	}
+	var out []containerSummary
+	return out, c.getJSON(ctx, "/containers/json", q, &out)
+}
+
+func (c *dockerClient) ContainerInspect(ctx context.Context, id string) (*containerJSON, error) {
+	var out containerJSON
+	if err := c.getJSON(ctx, "/containers/"+url.PathEscape(id)+"/json", nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ContainerLogs returns the last tail lines of stdout+stderr, demultiplexed.
+func (c *dockerClient) ContainerLogs(ctx context.Context, id string, tail int) (string, error) {
+	info, err := c.ContainerInspect(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	q := url.Values{"stdout": {"1"}, "stderr": {"1"}, "tail": {fmt.Sprint(tail)}}
+	res, err := c.do(ctx, http.MethodGet, "/containers/"+url.PathEscape(id)+"/logs", q, nil)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if info.Config.Tty {
+		b, err := io.ReadAll(res.Body)
+		return string(b), err
+	}
+	var sb strings.Builder
+	err = demuxStream(res.Body, &sb, &sb)
+	return sb.String(), err
+}
+
+// VolumeList returns volumes matching label filters ("key=value").
+func (c *dockerClient) VolumeList(ctx context.Context, labels ...string) ([]volume, error) {
+	q := url.Values{}
+	if len(labels) > 0 {
+		f, _ := json.Marshal(map[string][]string{"label": labels})
+		q.Set("filters", string(f))
+	}
+	var out struct {
+		Volumes []volume `json:"Volumes"`
+	}
+	err := c.getJSON(ctx, "/volumes", q, &out)
+	return out.Volumes, err
+}
+
+// VolumeRemove deletes a named volume. Honours DRY_RUN.
+func (c *dockerClient) VolumeRemove(ctx context.Context, name string, force bool) error {
+	if dryRun {
+		return nil
+	}
+	q := url.Values{}
+	if force {
+		q.Set("force", "1")
+	}
+	res, err := c.do(ctx, http.MethodDelete, "/volumes/"+url.PathEscape(name), q, nil)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	return nil
+}
+
+// Events streams daemon events matching filters until ctx is cancelled.
+// The error channel receives exactly one value when the stream ends.
+func (c *dockerClient) Events(ctx context.Context, filters map[string][]string) (<-chan dockerEvent, <-chan error) {
+	evc := make(chan dockerEvent)
+	errc := make(chan error, 1)
+	go func() {
+		defer close(evc)
+		q := url.Values{}
+		if len(filters) > 0 {
+			f, _ := json.Marshal(filters)
+			q.Set("filters", string(f))
+		}
+		res, err := c.do(ctx, http.MethodGet, "/events", q, nil)
+		if err != nil {
+			errc <- err
+			return
+		}
+		defer res.Body.Close()
+		dec := json.NewDecoder(res.Body)
+		for {
+			var ev dockerEvent
+			if err := dec.Decode(&ev); err != nil {
+				if ctx.Err() != nil {
+					err = ctx.Err()
+				}
+				errc <- err
+				return
+			}
+			select {
+			case evc <- ev:
+			case <-ctx.Done():
+				errc <- ctx.Err()
+				return
+			}
+		}
+	}()
+	return evc, errc
+}
+
+// ContainerCreate creates (but does not start) a container. Body follows the API's
+// create schema, e.g. {"Image": ..., "Cmd": [...], "HostConfig": {"Binds": [...]}}.
+func (c *dockerClient) ContainerCreate(ctx context.Context, name string, cfg map[string]any) (string, error) {
+	q := url.Values{}
+	if name != "" {
+		q.Set("name", name)
+	}
+	b, _ := json.Marshal(cfg)
+	res, err := c.do(ctx, http.MethodPost, "/containers/create", q, bytes.NewReader(b))
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	var out struct {
+		ID string `json:"Id"`
+	}
+	return out.ID, json.NewDecoder(res.Body).Decode(&out)
+}
+
+func (c *dockerClient) ContainerStart(ctx context.Context, id string) error {
+	res, err := c.do(ctx, http.MethodPost, "/containers/"+url.PathEscape(id)+"/start", nil, nil)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	return nil
+}
+
+// ContainerExec runs cmd in a running container (no stdin, no tty) and returns
+// its demultiplexed output and exit code.
+func (c *dockerClient) ContainerExec(ctx context.Context, id string, cmd, env []string) (stdout, stderr string, exitCode int, err error) {
+	b, _ := json.Marshal(map[string]any{"AttachStdout": true, "AttachStderr": true, "Cmd": cmd, "Env": env})
+	res, err := c.do(ctx, http.MethodPost, "/containers/"+url.PathEscape(id)+"/exec", nil, bytes.NewReader(b))
+	if err != nil {
+		return "", "", 0, err
+	}
+	var created struct {
+		ID string `json:"Id"`
+	}
+	err = json.NewDecoder(res.Body).Decode(&created)
+	res.Body.Close()
+	if err != nil {
+		return "", "", 0, err
+	}
+
+	// without an Upgrade header the daemon streams the output as the response body
+	res, err = c.do(ctx, http.MethodPost, "/exec/"+created.ID+"/start", nil, strings.NewReader(`{"Detach":false,"Tty":false}`))
+	if err != nil {
+		return "", "", 0, err
+	}
+	var out, errOut strings.Builder
+	err = demuxStream(res.Body, &out, &errOut)
+	res.Body.Close()
+	if err != nil {
+		return out.String(), errOut.String(), 0, err
+	}
+
+	var info struct {
+		ExitCode int `json:"ExitCode"`
+	}
+	err = c.getJSON(ctx, "/exec/"+created.ID+"/json", nil, &info)
+	return out.String(), errOut.String(), info.ExitCode, err
+}
+
+// ContainerRemove force-removes a container (anonymous volumes included).
+func (c *dockerClient) ContainerRemove(ctx context.Context, id string) error {
+	q := url.Values{"force": {"1"}, "v": {"1"}}
+	res, err := c.do(ctx, http.MethodDelete, "/containers/"+url.PathEscape(id), q, nil)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	return nil
+}
+
+// CopyFromContainer returns a tar stream of path inside the container (running or not).
+func (c *dockerClient) CopyFromContainer(ctx context.Context, id, path string) (io.ReadCloser, error) {
+	res, err := c.do(ctx, http.MethodGet, "/containers/"+url.PathEscape(id)+"/archive", url.Values{"path": {path}}, nil)
+	if err != nil {
+		return nil, err
+	}
+	return res.Body, nil
+}
+
+// CopyToContainer extracts a tar stream into dir inside the container.
+func (c *dockerClient) CopyToContainer(ctx context.Context, id, dir string, tarball io.Reader) error {
+	res, err := c.send(ctx, http.MethodPut, "/containers/"+url.PathEscape(id)+"/archive", url.Values{"path": {dir}}, "application/x-tar", tarball)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	return nil
+}
+
+// ImagePull pulls ref (name:tag), waiting until the pull has finished. Errors
+// that come after the 200 response, in the progress stream, are returned too.
+func (c *dockerClient) ImagePull(ctx context.Context, ref string) error {
+	res, err := c.do(ctx, http.MethodPost, "/images/create", url.Values{"fromImage": {ref}}, nil)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	dec := json.NewDecoder(res.Body)
+	for {
+		var m struct {
+			Error string `json:"error"`
+		}
+		if err := dec.Decode(&m); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if m.Error != "" {
+			return &dockerError{Status: http.StatusInternalServerError, Message: m.Error}
+		}
+	}
+}
+
+func (c *dockerClient) VolumeInspect(ctx context.Context, name string) (*volume, error) {
+	var out volume
+	if err := c.getJSON(ctx, "/volumes/"+url.PathEscape(name), nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *dockerClient) VolumeCreate(ctx context.Context, name string, labels map[string]string) error {
+	b, _ := json.Marshal(map[string]any{"Name": name, "Labels": labels})
+	res, err := c.do(ctx, http.MethodPost, "/volumes/create", nil, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	return nil
+}
+
+// demuxStream splits Docker's multiplexed stream (8-byte frame headers) into stdout/stderr.
+func demuxStream(r io.Reader, stdout, stderr io.Writer) error {
+	var hdr [8]byte
+	for {
+		if _, err := io.ReadFull(r, hdr[:]); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		w := stdout
+		if hdr[0] == 2 {
+			w = stderr
+		}
+		n := int64(binary.BigEndian.Uint32(hdr[4:]))
+		if _, err := io.CopyN(w, r, n); err != nil {
+			return err
+		}
+	}
+}
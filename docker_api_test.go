@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// fakeDaemon serves handler on a unix socket and returns a client for it.
+func fakeDaemon(t *testing.T, handler http.HandlerFunc) *dockerClient {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "dk") // short: socket paths are limited to ~100 bytes
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	sock := filepath.Join(dir, "docker.sock")
+	l, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewUnstartedServer(handler)
+	srv.Listener = l
+	srv.Start()
+	t.Cleanup(srv.Close)
+
+	c, err := newDockerClient("unix://" + sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestDockerContainerInspect(t *testing.T) {
+	c := fakeDaemon(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.URL.Path != "/"+dockerAPIVersion+"/containers/abc/json" {
+			t.Errorf("request %s %s", r.Method, r.URL.Path)
+		}
+		fmt.Fprint(w, `{
+			"Id": "abc", "Name": "/shop-db-1", "RestartCount": 2,
+			"State": {"Status": "running", "Running": true, "Health": {"Status": "healthy", "FailingStreak": 0,
+				"Log": [{"ExitCode": 0, "Output": "accepting connections"}]}},
+			"Config": {"Image": "postgres:16", "Env": ["POSTGRES_DB=shop"], "Labels": {"com.docker.compose.service": "db"}},
+			"Mounts": [{"Type": "volume", "Name": "shop_db_data", "Destination": "/var/lib/postgresql/data"}],
+			"NetworkSettings": {"Ports": {"5432/tcp": [{"HostIp": "0.0.0.0", "HostPort": "5433"}]}}
+		}`)
+	})
+	info, err := c.ContainerInspect(context.Background(), "abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.State.Running || info.State.Health == nil || info.State.Health.Status != "healthy" {
+		t.Errorf("state = %+v", info.State)
+	}
+	if got := info.State.Health.Log[0].Output; got != "accepting connections" {
+		t.Errorf("health log = %q", got)
+	}
+	if info.Config.Image != "postgres:16" || info.Config.Labels["com.docker.compose.service"] != "db" || info.RestartCount != 2 {
+		t.Errorf("config = %+v", info.Config)
+	}
+	if len(info.Mounts) != 1 || info.Mounts[0].Name != "shop_db_data" {
+		t.Errorf("mounts = %+v", info.Mounts)
+	}
+	if b := info.NetworkSettings.Ports["5432/tcp"]; len(b) != 1 || b[0].HostPort != "5433" {
+		t.Errorf("ports = %+v", info.NetworkSettings.Ports)
+	}
+}
+
+func TestDockerListFilters(t *testing.T) {
+	var gotFilters []map[string][]string
+	c := fakeDaemon(t, func(w http.ResponseWriter, r *http.Request) {
+		var f map[string][]string
+		if err := json.Unmarshal([]byte(r.URL.Query().Get("filters")), &f); err != nil {
+			t.Errorf("filters %q: %v", r.URL.Query().Get("filters"), err)
+		}
+		gotFilters = append(gotFilters, f)
+		switch r.URL.Path {
+		case "/" + dockerAPIVersion + "/containers/json":
+			if r.URL.Query().Get("all") != "1" {
+				t.Errorf("all = %q", r.URL.Query().Get("all"))
+			}
+			fmt.Fprint(w, `[{"Id": "abc", "Names": ["/shop-db-1"], "State": "running",
+				"Labels": {"com.docker.compose.project": "shop"},
+				"Ports": [{"IP": "0.0.0.0", "PrivatePort": 5432, "PublicPort": 5433, "Type": "tcp"}]}]`)
+		case "/" + dockerAPIVersion + "/volumes":
+			fmt.Fprint(w, `{"Volumes": [{"Name": "shop_db_data", "Driver": "local",
+				"Labels": {"com.docker.compose.volume": "db_data"}}], "Warnings": null}`)
+		default:
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+	})
+	ctx := context.Background()
+
+	cs, err := c.ContainerList(ctx, true, "com.docker.compose.project=shop", "com.docker.compose.service=db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cs) != 1 || cs[0].ID != "abc" || cs[0].State != "running" || cs[0].Ports[0].PublicPort != 5433 {
+		t.Errorf("containers = %+v", cs)
+	}
+	vols, err := c.VolumeList(ctx, "com.docker.compose.volume=db_data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vols) != 1 || vols[0].Name != "shop_db_data" || vols[0].Labels["com.docker.compose.volume"] != "db_data" {
+		t.Errorf("volumes = %+v", vols)
+	}
+
+	want := []map[string][]string{
+		{"label": {"com.docker.compose.project=shop", "com.docker.compose.service=db"}},
+		{"label": {"com.docker.compose.volume=db_data"}},
+	}
+	if !reflect.DeepEqual(gotFilters, want) {
+		t.Errorf("filters = %v, want %v", gotFilters, want)
+	}
+}
+
+func TestDockerEvents(t *testing.T) {
+	c := fakeDaemon(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/"+dockerAPIVersion+"/events" {
+			t.Errorf("path %s", r.URL.Path)
+		}
+		fmt.Fprintln(w, `{"Type": "container", "Action": "health_status: starting", "Actor": {"ID": "abc", "Attributes": {"name": "shop-db-1"}}, "timeNano": 1}`)
+		fmt.Fprintln(w, `{"Type": "container", "Action": "health_status: healthy", "Actor": {"ID": "abc"}, "timeNano": 2}`)
+		w.(http.Flusher).Flush()
+		<-r.Context().Done() // the daemon keeps the stream open
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	evc, errc := c.Events(ctx, map[string][]string{"container": {"abc"}})
+
+	var got []string
+	for ev := range evc {
+		got = append(got, ev.Action)
+		if ev.Actor.ID != "abc" {
+			t.Errorf("actor = %+v", ev.Actor)
+		}
+		if len(got) == 2 {
+			cancel()
+		}
+	}
+	if want := []string{"health_status: starting", "health_status: healthy"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("actions = %q, want %q", got, want)
+	}
+	if err := <-errc; !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+}
+
+func TestDockerLogsDemux(t *testing.T) {
+	frame := func(stream byte, s string) []byte {
+		h := make([]byte, 8)
+		h[0] = stream
+		binary.BigEndian.PutUint32(h[4:], uint32(len(s)))
+		return append(h, s...)
+	}
+	c := fakeDaemon(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/"+dockerAPIVersion+"/containers/abc/json" {
+			fmt.Fprint(w, `{"Id": "abc", "Config": {"Tty": false}}`)
+			return
+		}
+		if r.URL.Query().Get("tail") != "50" {
+			t.Errorf("tail = %q", r.URL.Query().Get("tail"))
+		}
+		w.Write(frame(1, "ready\n"))
+		w.Write(frame(2, "warning: x\n"))
+	})
+	out, err := c.ContainerLogs(context.Background(), "abc", 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "ready\nwarning: x\n" {
+		t.Errorf("logs = %q", out)
+	}
+}
+
+func TestDockerErrors(t *testing.T) {
+	c := fakeDaemon(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/" + dockerAPIVersion + "/containers/missing/json":
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"message": "No such container: missing"}`)
+		default:
+			http.Error(w, "daemon exploded", http.StatusInternalServerError)
+		}
+	})
+	ctx := context.Background()
+
+	_, err := c.ContainerInspect(ctx, "missing")
+	var de *dockerError
+	if !errors.As(err, &de) || de.Status != 404 || de.Message != "No such container: missing" {
+		t.Fatalf("err = %#v", err)
+	}
+	if !isNotFound(err) {
+		t.Error("isNotFound = false for a 404")
+	}
+
+	_, err = c.ContainerList(ctx, false)
+	if !errors.As(err, &de) || de.Status != 500 || de.Message != "daemon exploded" {
+		t.Fatalf("err = %#v", err)
+	}
+	if isNotFound(err) {
+		t.Error("isNotFound = true for a 500")
+	}
+	if err := c.Ping(ctx); err == nil {
+		t.Error("Ping: no error for a 500")
+	}
+}
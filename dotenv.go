@@ -0,0 +1,234 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// ---------- Dotenv files (docker compose semantics) ----------
+
+// dotenvError points at the offending line of an env file.
+type dotenvError struct {
+	File string
+	Line int
+	Msg  string
+}
+
+func (e *dotenvError) Error() string { return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Msg) }
+
+var dotenvKey = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]*$`)
+
+// parseDotenv parses env file contents like docker compose does:
+//
+//   - blank lines and lines starting with # are skipped; `export ` is allowed
+//   - KEY=value (or KEY: value) is trimmed, and " #" starts an inline comment
+//   - a bare KEY passes its value through if it is set
+//   - 'single quotes' are literal and may span lines
+//   - "double quotes" may span lines and understand \n \r \t \\ \" \$
+//   - ${VAR} / $VAR (with :- - :? ? :+ + and $$, defaults may nest) expand in
+//     unquoted and double-quoted values, from keys defined above, then lookup
+//
+// Bad lines are skipped; their errors are joined and returned with what parsed.
+func parseDotenv(file, src string, lookup func(string) (string, bool)) (map[string]string, error) {
+	env := map[string]string{}
+	var errs []error
+	fail := func(line int, format string, args ...any) {
+		errs = append(errs, &dotenvError{File: file, Line: line, Msg: fmt.Sprintf(format, args...)})
+	}
+	get := func(name string) (string, bool) {
+		if v, ok := env[name]; ok {
+			return v, true
+		}
+		if lookup != nil {
+			return lookup(name)
+		}
+		return "", false
+	}
+
+	lines := strings.Split(strings.ReplaceAll(src, "\r\n", "\n"), "\n")
+	for i := 0; i < len(lines); i++ {
+		lineNo := i + 1
+		line := strings.TrimSpace(lines[i])
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimSpace(strings.TrimPrefix(line, "export "))
+		sep := strings.IndexAny(line, "=:")
+		if sep < 0 {
+			// a bare KEY takes its value from above or the environment, if set
+			if !dotenvKey.MatchString(line) {
+				fail(lineNo, "expected KEY=value, got %q", line)
+			} else if v, ok := get(line); ok {
+				env[line] = v
+			}
+			continue
+		}
+		key, rest := strings.TrimSpace(line[:sep]), line[sep+1:]
+		if !dotenvKey.MatchString(key) {
+			fail(lineNo, "invalid variable name %q", key)
+			continue
+		}
+		rest = strings.TrimLeft(rest, " \t")
+		missing := func(name, msg string, required bool) {
+			switch {
+			case name == "":
+				fail(lineNo, "%s", msg)
+			case required:
+				fail(lineNo, "${%s}: %s", name, msg)
+			}
+		}
+
+		var val string
+		switch {
+		case strings.HasPrefix(rest, "'") || strings.HasPrefix(rest, `"`):
+			q := rest[0]
+			body := rest[1:]
+			// the closing quote may be on a later line
+			end := closingQuote(body, q)
+			for end < 0 && i+1 < len(lines) {
+				i++
+				body += "\n" + lines[i]
+				end = closingQuote(body, q)
+			}
+			if end < 0 {
+				fail(lineNo, "unterminated %c quote", q)
+				continue
+			}
+			if after := strings.TrimSpace(body[end+1:]); after != "" && !strings.HasPrefix(after, "#") {
+				fail(lineNo, "unexpected %q after closing quote", after)
+				continue
+			}
+			val = body[:end]
+			if q == '"' {
+				val = unescapeDouble(val)
+				val = expandVars(val, get, missing)
+			}
+		default:
+			if i := strings.Index(rest, " #"); i >= 0 {
+				rest = rest[:i]
+			} else if i := strings.Index(rest, "\t#"); i >= 0 {
+				rest = rest[:i]
+			}
+			val = expandVars(strings.TrimSpace(rest), get, missing)
+		}
+		env[key] = val
+	}
+	return env, errors.Join(errs...)
+}
+
+// closingQuote finds the unescaped closing quote in s (backslash escapes only
+// count inside double quotes), or -1.
+func closingQuote(s string, q byte) int {
+	for i := 0; i < len(s); i++ {
+		switch {
+		case q == '"' && s[i] == '\\':
+			i++
+		case s[i] == q:
+			return i
+		}
+	}
+	return -1
+}
+
+func unescapeDouble(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 't':
+			b.WriteByte('\t')
+		case '$':
+			b.WriteString("$$") // survives expandVars as a literal $
+		case '\\', '"':
+			b.WriteByte(s[i])
+		default:
+			b.WriteByte('\\')
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
+
+// envFiles splits a comma-separated list of env files (APP_ENV_FILE=.env,.env.local).
+func envFiles(paths string) []string {
+	var out []string
+	for _, p := range strings.Split(paths, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// loadDotenv layers the env files in order: later files override earlier ones
+// and can reference their values (then the process env). Missing files are
+// skipped; errors are joined and returned with everything that parsed.
+func loadDotenv(paths string) (map[string]string, error) {
+	env := map[string]string{}
+	lookup := func(name string) (string, bool) {
+		if v, ok := env[name]; ok {
+			return v, true
+		}
+		return os.LookupEnv(name)
+	}
+	var errs []error
+	for _, path := range envFiles(paths) {
+		b, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		vals, err := parseDotenv(path, string(b), lookup)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		for k, v := range vals {
+			env[k] = v
+		}
+	}
+	return env, errors.Join(errs...)
+}
+
+// readDotenv loads one env file or a comma-separated list (see loadDotenv).
+// Parse errors are printed once as warnings; the keys that parsed are still used.
+func readDotenv(path string) map[string]string {
+	env, err := loadDotenv(path)
+	for _, e := range dotenvErrors(err) {
+		if _, seen := dotenvWarned.LoadOrStore(e.Error(), true); !seen {
+			fmt.Fprintln(os.Stderr, "warning: env file:", e)
+		}
+	}
+	return env
+}
+
+var dotenvWarned sync.Map
+
+// dotenvErrors flattens the joined errors of loadDotenv.
+func dotenvErrors(err error) []error {
+	if err == nil {
+		return nil
+	}
+	var out []error
+	if j, ok := err.(interface{ Unwrap() []error }); ok {
+		for _, e := range j.Unwrap() {
+			out = append(out, dotenvErrors(e)...)
+		}
+		return out
+	}
+	return []error{err}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseDotenv(t *testing.T) {
+	lookup := func(name string) (string, bool) {
+		v, ok := map[string]string{"HOME": "/home/me", "EMPTY": ""}[name]
+		return v, ok
+	}
+	tests := []struct {
+		name, src string
+		want      map[string]string
+	}{
+		{"comments and blanks", "# c\n\n  # indented\nA=1\n", map[string]string{"A": "1"}},
+		{"export", "export A=1\n  export B = 2", map[string]string{"A": "1", "B": "2"}},
+		{"yaml style", "A: 1\nB:x=y", map[string]string{"A": "1", "B": "x=y"}},
+		{"bare key", "HOME\nNOPE\nexport EMPTY\nA=1\nA", map[string]string{"HOME": "/home/me", "EMPTY": "", "A": "1"}},
+		{"key chars", "a.b-c_1=x", map[string]string{"a.b-c_1": "x"}},
+		{"unquoted trimmed", "A=  x y  ", map[string]string{"A": "x y"}},
+		{"inline comment", "A=x #note\nB=x\t#note", map[string]string{"A": "x", "B": "x"}},
+		{"hash without space", "A=x#y", map[string]string{"A": "x#y"}},
+		{"empty", "A=\nB=''\nC=\"\"", map[string]string{"A": "", "B": "", "C": ""}},
+		{"equals in value", "A=a=b", map[string]string{"A": "a=b"}},
+		{"crlf", "A=1\r\nB=2\r\n", map[string]string{"A": "1", "B": "2"}},
+
+		{"single literal", `A='$HOME \n "x" # y'`, map[string]string{"A": `$HOME \n "x" # y`}},
+		{"single multi-line", "A='one\ntwo'\nB=3", map[string]string{"A": "one\ntwo", "B": "3"}},
+		{"single then comment", "A='x' # c", map[string]string{"A": "x"}},
+		{"double escapes", `A="a\nb\tc\r\\ \"q\" \$HOME \x"`, map[string]string{"A": "a\nb\tc\r\\ \"q\" $HOME \\x"}},
+		{"double multi-line", "A=\"one\ntwo # not a comment\"\nB=3", map[string]string{"A": "one\ntwo # not a comment", "B": "3"}},
+		{"double keeps hash", `A="x # y"`, map[string]string{"A": "x # y"}},
+
+		{"from lookup", "A=$HOME/x\nB=${HOME}y", map[string]string{"A": "/home/me/x", "B": "/home/mey"}},
+		{"from above", "A=1\nB=${A}2\nA=3", map[string]string{"A": "3", "B": "12"}},
+		{"above wins over lookup", "HOME=/h\nB=$HOME", map[string]string{"HOME": "/h", "B": "/h"}},
+		{"in double quotes", `A="$HOME"`, map[string]string{"A": "/home/me"}},
+		{"unset is empty", "A=x${NOPE}y", map[string]string{"A": "xy"}},
+		{"dollar dollar", "A=$$HOME\nB=\"$$\"", map[string]string{"A": "$HOME", "B": "$"}},
+		{":- default", "A=${NOPE:-d}\nB=${EMPTY:-d}\nC=${HOME:-d}", map[string]string{"A": "d", "B": "d", "C": "/home/me"}},
+		{"- default", "A=${NOPE-d}\nB=${EMPTY-d}", map[string]string{"A": "d", "B": ""}},
+		{"nested default", "A=${NOPE:-${HOME}/x}\nB=\"${NOPE:-${NADA:-$$}}\"", map[string]string{"A": "/home/me/x", "B": "$"}},
+		{":+ alternative", "A=${HOME:+alt}\nB=${EMPTY:+alt}\nC=${NOPE:+alt}", map[string]string{"A": "alt", "B": "", "C": ""}},
+		{"+ alternative", "A=${EMPTY+alt}\nB=${NOPE+alt}", map[string]string{"A": "alt", "B": ""}},
+		{"required set", "A=${HOME:?need it}\nB=${EMPTY?need it}", map[string]string{"A": "/home/me", "B": ""}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseDotenv(".env", tt.src, lookup)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseDotenvErrors(t *testing.T) {
+	src := strings.Join([]string{
+		"A=1",                 // 1
+		`B="multi`,            // 2
+		`line"`,               // 3
+		"just words",          // 4
+		"1X=2",                // 5
+		`C="x" y`,             // 6
+		"D=${NOPE:?set NOPE}", // 7
+		"E=${EMPTY:?}",        // 8
+		"F=${NOPE",            // 9
+		"G='never closed",     // 10
+		"H=swallowed by G",    // 11
+		"I=${also swallowed",  // 12
+	}, "\n")
+	lookup := func(name string) (string, bool) {
+		if name == "EMPTY" {
+			return "", true
+		}
+		return "", false
+	}
+	env, err := parseDotenv("app.env", src, lookup)
+	want := []string{
+		`app.env:4: expected KEY=value, got "just words"`,
+		`app.env:5: invalid variable name "1X"`,
+		`app.env:6: unexpected "y" after closing quote`,
+		`app.env:7: ${NOPE}: set NOPE`,
+		`app.env:8: ${EMPTY}: required variable EMPTY is missing a value`,
+		`app.env:9: unterminated "${NOPE"`,
+		`app.env:10: unterminated ' quote`,
+	}
+	var got []string
+	for _, e := range dotenvErrors(err) {
+		var de *dotenvError
+		if !errors.As(e, &de) {
+			t.Errorf("%v is not a *dotenvError", e)
+		}
+		got = append(got, e.Error())
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("errors:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	// bad lines are skipped, the rest still parse
+	wantEnv := map[string]string{"A": "1", "B": "multi\nline", "D": "", "E": "", "F": "${NOPE"}
+	if !reflect.DeepEqual(env, wantEnv) {
+		t.Errorf("env = %q, want %q", env, wantEnv)
+	}
+}
+
+func TestLoadDotenv(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, src string) string {
+		p := filepath.Join(dir, name)
+		if err := os.WriteFile(p, []byte(src), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	t.Setenv("DOTENV_TEST_HOST", "db.internal")
+	base := write(".env", "USER=app\nURL=postgres://$USER@${DOTENV_TEST_HOST}\nPORT=5432\n")
+	local := write(".env.local", "PORT=6543\nURL=${URL}:${PORT}\nbad line\n")
+
+	env, err := loadDotenv(" " + base + " , " + filepath.Join(dir, "missing.env") + "," + local + ",")
+	want := map[string]string{"USER": "app", "URL": "postgres://app@db.internal:6543", "PORT": "6543"}
+	if !reflect.DeepEqual(env, want) {
+		t.Errorf("env = %q, want %q", env, want)
+	}
+	errs := dotenvErrors(err)
+	if len(errs) != 1 || errs[0].Error() != local+`:3: expected KEY=value, got "bad line"` {
+		t.Errorf("errors = %v", errs)
+	}
+
+	if env, err := loadDotenv(""); err != nil || len(env) != 0 {
+		t.Errorf("loadDotenv(\"\") = %q, %v", env, err)
+	}
+}
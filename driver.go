@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// ---------- Engine drivers (postgres, mysql/mariadb, mongo, redis) ----------
+
+// dbDriver holds everything engine-specific. Tools resolve the engine once
+// (detectDBKind) and go through driverFor(c.Kind) from there.
+type dbDriver interface {
+	// Creds reads the official image's env conventions (the app's user);
+	// AdminCreds the superuser, for user management.
+	Creds(env map[string]string) dbCreds
+	AdminCreds(env map[string]string) dbCreds
+	// PasswordEnv is the variable the engine's CLI tools read the password from.
+	PasswordEnv() string
+	DefaultPort() int
+	URL(c dbCreds, host string, port int) string
+	// ReadyCommand exits 0 once the server accepts connections.
+	ReadyCommand(c dbCreds) []string
+	// DumpCommand writes a logical dump to stdout; RestoreCommand reads one from
+	// stdin, picking the client from the dump's first bytes.
+	DumpCommand(c dbCreds, format string) ([]string, error)
+	RestoreCommand(c dbCreds, head []byte) ([]string, error)
+	// CheckQuery validates a query and reports whether read mode may run it;
+	// Query runs it (read mode must not change data).
+	CheckQuery(q string) (stmt string, readOnly bool, err error)
+	Query(t dbTarget, c dbCreds, stmt string, write bool, limit int, timeout time.Duration) (*queryResult, error)
+	// Users lists (action "list"), creates or drops DB users.
+	Users(t dbTarget, admin dbCreds, action string, u dbUser) ([]string, error)
+}
+
+// dbUser is a login managed by dbUser; Role is readwrite or readonly.
+type dbUser struct {
+	Name     string
+	Password string
+	Role     string
+	Database string
+}
+
+var drivers = map[string]dbDriver{
+	"postgres": sqlDriver{kind: "postgres"},
+	"mysql":    sqlDriver{kind: "mysql"},
+	"mongo":    mongoDriver{},
+	"redis":    redisDriver{},
+}
+
+func driverFor(kind string) dbDriver { return drivers[kind] }
+
+func isSQL(kind string) bool { return kind == "postgres" || kind == "mysql" }
+
+// detectDBKind maps the DB container's image to an engine, unless overridden by
+// the engine argument or DB_ENGINE.
+func detectDBKind(t dbTarget, override string) (string, error) {
+	if override == "" {
+		override = os.Getenv("DB_ENGINE")
+	}
+	if override != "" {
+		return normalizeDBKind(override)
+	}
+	id, err := containerID(t.Project, t.Service)
+	if err != nil {
+		return "", err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), defaultAPITimeout)
+	defer cancel()
+	info, err := engine.ContainerInspect(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	if kind, err := normalizeDBKind(info.Config.Image); err == nil {
+		return kind, nil
+	}
+	return "", fmt.Errorf("can't tell the DB engine from image %q; pass engine or set DB_ENGINE (postgres|mysql|mongo|redis)", info.Config.Image)
+}
+
+// detectSQLKind is detectDBKind for tools that only speak SQL.
+func detectSQLKind(t dbTarget, override string) (string, error) {
+	kind, err := detectDBKind(t, override)
+	if err == nil && !isSQL(kind) {
+		err = fmt.Errorf("this needs a SQL engine (postgres|mysql); %s runs %s", t.Service, kind)
+	}
+	return kind, err
+}
+
+func normalizeDBKind(s string) (string, error) {
+	s = strings.ToLower(s)
+	switch {
+	case strings.Contains(s, "postgres"), strings.Contains(s, "postgis"), strings.Contains(s, "timescale"):
+		return "postgres", nil
+	case strings.Contains(s, "mysql"), strings.Contains(s, "mariadb"), strings.Contains(s, "percona"):
+		return "mysql", nil
+	case strings.Contains(s, "mongo"):
+		return "mongo", nil
+	case strings.Contains(s, "redis"), strings.Contains(s, "valkey"), strings.Contains(s, "keydb"):
+		return "redis", nil
+	}
+	return "", fmt.Errorf("unsupported DB engine %q", s)
+}
+
+// credentialsFor reads the engine's env conventions from the app env.
+func credentialsFor(kind string, env map[string]string) dbCreds {
+	return driverFor(kind).Creds(env)
+}
+
+// firstEnv returns the first non-empty value among keys.
+func firstEnv(env map[string]string, keys ...string) string {
+	for _, k := range keys {
+		if v := env[k]; v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,325 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ---------- MongoDB driver (mongosh / mongodump / mongorestore) ----------
+
+type mongoDriver struct{}
+
+// mongoResultMarker prefixes the JSON line our mongosh scripts print.
+const mongoResultMarker = "__compose_db_agent_result "
+
+func (mongoDriver) Creds(env map[string]string) dbCreds {
+	c := dbCreds{Kind: "mongo"}
+	c.User = firstEnv(env, "MONGO_INITDB_ROOT_USERNAME")
+	c.Password = firstEnv(env, "MONGO_INITDB_ROOT_PASSWORD")
+	c.Database = firstEnv(env, "MONGO_INITDB_DATABASE")
+	if c.Database == "" {
+		c.Database = "test"
+	}
+	return c
+}
+
+// AdminCreds: the official image only knows the root user.
+func (d mongoDriver) AdminCreds(env map[string]string) dbCreds { return d.Creds(env) }
+
+// PasswordEnv is our own name: the Mongo tools have no password variable, so
+// mongoAuth expands it inside the container.
+func (mongoDriver) PasswordEnv() string { return "MONGO_PWD" }
+
+func (mongoDriver) DefaultPort() int { return 27017 }
+
+func (mongoDriver) URL(c dbCreds, host string, port int) string {
+	u := url.URL{Scheme: "mongodb", Host: host + ":" + strconv.Itoa(port), Path: "/" + c.Database}
+	if c.User != "" {
+		u.User = url.UserPassword(c.User, c.Password)
+		u.RawQuery = "authSource=admin"
+	}
+	return u.String()
+}
+
+// mongoAuth adds the root login. The password is appended by a shell inside the
+// container from $MONGO_PWD, so it never appears on the host's command line.
+func mongoAuth(c dbCreds, cmd ...string) []string {
+	if c.User == "" {
+		return cmd
+	}
+	cmd = append(cmd, "--username", c.User, "--authenticationDatabase", "admin")
+	if c.Password == "" {
+		return cmd
+	}
+	return append([]string{"sh", "-c", `exec "$@" --password "$MONGO_PWD"`, "sh"}, cmd...)
+}
+
+func (mongoDriver) ReadyCommand(c dbCreds) []string {
+	return []string{"mongosh", "--quiet", "--eval", "db.adminCommand('ping').ok"}
+}
+
+func (mongoDriver) DumpCommand(c dbCreds, format string) ([]string, error) {
+	return mongoAuth(c, "mongodump", "--archive", "--db", c.Database), nil
+}
+
+func (mongoDriver) RestoreCommand(c dbCreds, head []byte) ([]string, error) {
+	return mongoAuth(c, "mongorestore", "--archive", "--drop"), nil
+}
+
+var (
+	mongoReadCall = regexp.MustCompile(`^db(?:\.getCollection\(\s*['"][^'"]+['"]\s*\)|\.[A-Za-z_][\w.]*?)\.(find|findOne|aggregate|countDocuments|estimatedDocumentCount|distinct|count)\(`)
+	// mongoWriteCall catches writes chained or nested after a read call
+	mongoWriteCall = regexp.MustCompile(`\.(insert|update|delete|remove|drop|replace|create|rename|bulkWrite|findOneAnd|findAndModify|runCommand|adminCommand|getSiblingDB|eval)\w*\(|\$out|\$merge|;`)
+)
+
+// CheckQuery takes one mongosh expression, e.g. db.users.find({active: true}).
+// Read mode allows the read helpers only (no writes, no $out/$merge stages).
+func (mongoDriver) CheckQuery(q string) (string, bool, error) {
+	s := strings.TrimSpace(q)
+	for strings.HasSuffix(s, ";") {
+		s = strings.TrimSpace(strings.TrimSuffix(s, ";"))
+	}
+	if s == "" {
+		return "", false, errors.New("empty query")
+	}
+	readOnly := mongoReadCall.MatchString(s) && !mongoWriteCall.MatchString(s) && mongoReadSafe(s)
+	return s, readOnly, nil
+}
+
+var (
+	// mongoChainCalls may be called outside any parentheses: the read helper,
+	// getCollection and cursor methods.
+	mongoChainCalls = map[string]bool{
+		"getCollection": true, "find": true, "findOne": true, "aggregate": true, "countDocuments": true,
+		"estimatedDocumentCount": true, "distinct": true, "count": true, "sort": true, "limit": true,
+		"skip": true, "project": true, "projection": true, "hint": true, "collation": true, "toArray": true,
+		"explain": true, "batchSize": true, "maxTimeMS": true, "comment": true, "pretty": true,
+		"itcount": true, "size": true, "allowDiskUse": true, "min": true, "max": true,
+	}
+	// mongoBSONCalls may be called inside the arguments, e.g. {_id: ObjectId("...")}.
+	mongoBSONCalls = map[string]bool{
+		"ObjectId": true, "ISODate": true, "Date": true, "NumberLong": true, "NumberInt": true,
+		"NumberDecimal": true, "UUID": true, "Timestamp": true, "RegExp": true, "BinData": true,
+	}
+)
+
+// mongoReadSafe scans a read expression outside string and regex literals. It
+// rejects bracket member access, template literals, assignments, comments and
+// any call other than mongoChainCalls (outside parentheses) and mongoBSONCalls
+// (inside), so a write can't be reached indirectly, as in
+// db.users.find(db.users["deleteMany"]({})).
+func mongoReadSafe(s string) bool {
+	isIdent := func(c byte) bool {
+		return c == '_' || c == '$' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+	}
+	depth := 0
+	var last byte // previous significant character
+	ident := ""   // the identifier ending at last, if any
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			continue
+		case c == '`' || c == '=' || c == ';':
+			return false
+		case c == '\'' || c == '"':
+			for i++; i < len(s) && s[i] != c; i++ {
+				if s[i] == '\\' {
+					i++
+				}
+			}
+			if i >= len(s) {
+				return false
+			}
+		case c == '/':
+			if i+1 < len(s) && (s[i+1] == '/' || s[i+1] == '*') {
+				return false
+			}
+			if last != 0 && !strings.ContainsRune("(,:[{!&|?", rune(last)) {
+				break // division
+			}
+			class := false // a regex literal; / doesn't end it inside [...]
+			for i++; i < len(s) && (class || s[i] != '/'); i++ {
+				switch s[i] {
+				case '\\':
+					i++
+				case '[':
+					class = true
+				case ']':
+					class = false
+				}
+			}
+			if i >= len(s) {
+				return false
+			}
+			for i+1 < len(s) && isIdent(s[i+1]) {
+				i++ // flags
+			}
+		case isIdent(c):
+			start := i
+			for i+1 < len(s) && isIdent(s[i+1]) {
+				i++
+			}
+			if word := s[start : i+1]; word != "new" {
+				last, ident = s[i], word
+			}
+			continue
+		case c == '[':
+			if ident != "" || last == ')' || last == ']' {
+				return false // member access
+			}
+		case c == '(':
+			if last == ')' || last == ']' {
+				return false
+			}
+			if ident != "" && !(depth == 0 && mongoChainCalls[ident]) && !(depth > 0 && mongoBSONCalls[ident]) {
+				return false
+			}
+			depth++
+		case c == ')':
+			depth--
+		}
+		last, ident = c, ""
+	}
+	return true
+}
+
+// Query evaluates the expression and prints its result (cursors drained up to
+// limit+1 documents) as one relaxed-EJSON line.
+func (mongoDriver) Query(t dbTarget, c dbCreds, stmt string, write bool, limit int, timeout time.Duration) (*queryResult, error) {
+	script := fmt.Sprintf(`const __r = (%s
+);
+let __out = __r;
+if (__r && typeof __r.hasNext === 'function') { __out = []; while (__out.length <= %d && __r.hasNext()) __out.push(__r.next()); }
+print(%q + EJSON.stringify(__out, {relaxed: true}));`, stmt, limit, mongoResultMarker)
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout+30*time.Second)
+	defer cancel()
+	var out bytes.Buffer
+	cmd := mongoAuth(c, "mongosh", c.Database, "--quiet", "--eval", script)
+	if err := streamComposeContext(ctx, execEnv(c), nil, &out, execArgs(t, c, cmd...)...); err != nil {
+		return nil, err
+	}
+	v, err := mongoResult(out.String())
+	if err != nil {
+		return nil, err
+	}
+	res := documentsResult(v, limit, write)
+	return res, nil
+}
+
+// mongoResult decodes the marked line of a script's output.
+func mongoResult(out string) (any, error) {
+	for _, l := range sqlLines(out) {
+		if rest, ok := strings.CutPrefix(l, mongoResultMarker); ok {
+			var v any
+			if err := json.Unmarshal([]byte(rest), &v); err != nil {
+				return nil, fmt.Errorf("mongosh output: %w", err)
+			}
+			return v, nil
+		}
+	}
+	return nil, fmt.Errorf("no result in mongosh output: %s", tail(out, 500))
+}
+
+// documentsResult turns documents into columns (top-level keys, _id first) and rows.
+func documentsResult(v any, limit int, write bool) *queryResult {
+	res := &queryResult{Mode: "read", Columns: []string{}, Rows: [][]any{}}
+	if write {
+		res.Mode = "write"
+	}
+	docs, ok := v.([]any)
+	if !ok {
+		docs = []any{v}
+	}
+	if !write && len(docs) > limit {
+		docs, res.Truncated = docs[:limit], true
+	}
+
+	seen := map[string]bool{}
+	scalar := false
+	for _, d := range docs {
+		m, ok := d.(map[string]any)
+		if !ok {
+			scalar = true
+			continue
+		}
+		for k := range m {
+			if !seen[k] {
+				seen[k] = true
+				res.Columns = append(res.Columns, k)
+			}
+		}
+	}
+	sort.Slice(res.Columns, func(i, k int) bool {
+		if (res.Columns[i] == "_id") != (res.Columns[k] == "_id") {
+			return res.Columns[i] == "_id"
+		}
+		return res.Columns[i] < res.Columns[k]
+	})
+	if scalar {
+		res.Columns = append(res.Columns, "value")
+	}
+
+	for _, d := range docs {
+		row := make([]any, len(res.Columns))
+		if m, ok := d.(map[string]any); ok {
+			for i, col := range res.Columns {
+				row[i] = m[col]
+			}
+		} else {
+			row[len(row)-1] = d
+		}
+		res.Rows = append(res.Rows, row)
+	}
+	res.RowCount = len(res.Rows)
+	return res
+}
+
+func (mongoDriver) Users(t dbTarget, admin dbCreds, action string, u dbUser) ([]string, error) {
+	q := func(s string) string { b, _ := json.Marshal(s); return string(b) }
+	var script string
+	switch action {
+	case "list":
+		script = fmt.Sprintf(`print(%q + EJSON.stringify(db.getSiblingDB(%s).getUsers().users.map(u => u.user)))`, mongoResultMarker, q(u.Database))
+	case "create":
+		role := "readWrite"
+		if u.Role == "readonly" {
+			role = "read"
+		}
+		script = fmt.Sprintf(`db.getSiblingDB(%s).createUser({user: %s, pwd: %s, roles: [{role: %s, db: %s}]})`,
+			q(u.Database), q(u.Name), q(u.Password), q(role), q(u.Database))
+	case "drop":
+		script = fmt.Sprintf(`db.getSiblingDB(%s).dropUser(%s)`, q(u.Database), q(u.Name))
+	default:
+		return nil, fmt.Errorf("unknown action %q (list|create|drop)", action)
+	}
+
+	// the script (which may hold a password) goes in on stdin, not argv
+	var out bytes.Buffer
+	cmd := mongoAuth(admin, "mongosh", "admin", "--quiet")
+	if err := streamComposeWithEnv(execEnv(admin), strings.NewReader(script+"\n"), &out, execArgs(t, admin, cmd...)...); err != nil {
+		return nil, err
+	}
+	if action != "list" {
+		return nil, nil
+	}
+	v, err := mongoResult(out.String())
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, n := range v.([]any) {
+		names = append(names, fmt.Sprint(n))
+	}
+	return names, nil
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMongoCheckQuery(t *testing.T) {
+	tests := []struct {
+		q        string
+		readOnly bool
+	}{
+		{`db.users.find({active: true})`, true},
+		{`db.users.find({}, {name: 1}).sort({name: -1}).skip(10).limit(5);`, true},
+		{`db.getCollection("audit-log").find({_id: ObjectId("65f0c0ffee0000000000beef")})`, true},
+		{`db.users.find({created: {$gt: new Date("2024-01-01")}}).count()`, true},
+		{`db.users.find({name: /^a[/]b/i, note: "a,b"})`, true},
+		{`db.users.find({score: {$gt: 10 / 2}})`, true},
+		{`db.orders.aggregate([{$match: {status: "open"}}, {$group: {_id: "$user", n: {$sum: 1}}}])`, true},
+		{`db.users.countDocuments({})`, true},
+		{`db.users.distinct("email")`, true},
+		{`db.users.find().toArray()`, true},
+
+		// not read helpers at all
+		{`db.users.insertOne({name: "x"})`, false},
+		{`db.users.deleteMany({})`, false},
+		{`db.users.drop()`, false},
+		{`db.dropDatabase()`, false},
+		{`show collections`, false},
+
+		// writes reached from a read call
+		{`db.users.find(db.users.deleteMany({}))`, false},
+		{`db.users.find({}).forEach(function (d) { db.users.deleteOne(d) })`, false},
+		{`db.users.aggregate([{$out: "copy"}])`, false},
+		{`db.users.aggregate([{$merge: {into: "copy"}}])`, false},
+		{`db.users.find(db.getSiblingDB("admin").runCommand({shutdown: 1}))`, false},
+		{`db.users.find({}); db.users.drop()`, false},
+
+		// indirect access (4e50a3f)
+		{`db.users.find(db.users["deleteMany"]({}))`, false},
+		{`db.users.find(db.users["delete" + "Many"]({}))`, false},
+		{`db["users"].find({})`, false},
+		{`db.users.find()["forEach"](printjson)`, false},
+		{`db.users.find().constructor.constructor("return db")()`, false},
+		{`db.users.find(eval("db.users.drop()"))`, false},
+		{`db.users.find(Function("return 1")())`, false},
+		{"db.users.find({a: `${db.users.drop()}`})", false},
+		{`db.users.find({a: x = 1})`, false},
+		{`db.users.find({}).map(d => d)`, false},
+		{`db.users.find({}) // comment`, false},
+		{`db.users.find({} /* c */)`, false},
+		{`db.users.find({name: "unterminated})`, false},
+		{`db.users.find({name: /unterminated})`, false},
+
+		// the write check doesn't parse strings, so it errs towards write mode
+		{`db.users.find({note: "a;b"})`, false},
+		{`db.users.find({note: "see .drop() docs"})`, false},
+	}
+	var d mongoDriver
+	for _, tt := range tests {
+		_, readOnly, err := d.CheckQuery(tt.q)
+		if err != nil {
+			t.Errorf("CheckQuery(%q): %v", tt.q, err)
+			continue
+		}
+		if readOnly != tt.readOnly {
+			t.Errorf("CheckQuery(%q) readOnly = %v, want %v", tt.q, readOnly, tt.readOnly)
+		}
+	}
+	if _, _, err := d.CheckQuery(" ;; "); err == nil {
+		t.Error("CheckQuery: no error for an empty query")
+	}
+}
+
+func TestRedisArgs(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"GET user:1", []string{"GET", "user:1"}},
+		{"  SET  k   v ", []string{"SET", "k", "v"}},
+		{`SET "a b" 'c d'`, []string{"SET", "a b", "c d"}},
+		{`GET "a\"b"`, []string{"GET", `a"b`}},
+		{`GET 'a\'`, []string{"GET", `a\`}},
+		{`GET ""`, []string{"GET", ""}},
+		{`GET pre"fix"`, []string{"GET", "prefix"}},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		got, err := redisArgs(tt.in)
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("redisArgs(%q) = %q, %v; want %q", tt.in, got, err, tt.want)
+		}
+	}
+	for _, in := range []string{`GET "open`, `GET 'open`} {
+		if _, err := redisArgs(in); err == nil {
+			t.Errorf("redisArgs(%q): no error for an unterminated quote", in)
+		}
+	}
+}
+
+func TestRedisCheckQuery(t *testing.T) {
+	tests := []struct {
+		q        string
+		readOnly bool
+	}{
+		{"GET user:1", true},
+		{"get user:1", true},
+		{"HGETALL session:abc", true},
+		{"SCAN 0 MATCH user:* COUNT 100", true},
+		{"MEMORY USAGE user:1", true},
+		{"OBJECT ENCODING user:1", true},
+		{"SET user:1 x", false},
+		{"DEL user:1", false},
+		{"FLUSHALL", false},
+		{"CONFIG SET dir /tmp", false},
+		{"EVAL \"return redis.call('FLUSHALL')\" 0", false},
+		{"MEMORY PURGE", false},
+		{"OBJECT HELP", false},
+		{`"FLUSHDB"`, false},
+	}
+	var d redisDriver
+	for _, tt := range tests {
+		_, readOnly, err := d.CheckQuery(tt.q)
+		if err != nil {
+			t.Errorf("CheckQuery(%q): %v", tt.q, err)
+			continue
+		}
+		if readOnly != tt.readOnly {
+			t.Errorf("CheckQuery(%q) readOnly = %v, want %v", tt.q, readOnly, tt.readOnly)
+		}
+	}
+	for _, q := range []string{"", `GET "open`} {
+		if _, _, err := d.CheckQuery(q); err == nil {
+			t.Errorf("CheckQuery(%q): no error", q)
+		}
+	}
+}
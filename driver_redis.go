@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ---------- Redis driver (redis-cli; also Valkey / KeyDB) ----------
+
+type redisDriver struct{}
+
+func (redisDriver) Creds(env map[string]string) dbCreds {
+	c := dbCreds{Kind: "redis"}
+	c.Password = firstEnv(env, "REDIS_PASSWORD")
+	c.Database = firstEnv(env, "REDIS_DB")
+	if c.Database == "" {
+		c.Database = "0"
+	}
+	return c
+}
+
+func (d redisDriver) AdminCreds(env map[string]string) dbCreds { return d.Creds(env) }
+
+// PasswordEnv: redis-cli reads REDISCLI_AUTH, which also keeps it off argv.
+func (redisDriver) PasswordEnv() string { return "REDISCLI_AUTH" }
+
+func (redisDriver) DefaultPort() int { return 6379 }
+
+func (redisDriver) URL(c dbCreds, host string, port int) string {
+	u := url.URL{Scheme: "redis", Host: host + ":" + strconv.Itoa(port), Path: "/" + c.Database}
+	if c.Password != "" {
+		u.User = url.UserPassword("", c.Password)
+	}
+	return u.String()
+}
+
+func (redisDriver) ReadyCommand(c dbCreds) []string {
+	return []string{"redis-cli", "--no-auth-warning", "ping"}
+}
+
+// DumpCommand fetches an RDB snapshot of the whole server (all logical DBs);
+// redis-cli can't write it to stdout, so it goes through a temp file.
+func (redisDriver) DumpCommand(c dbCreds, format string) ([]string, error) {
+	const tmp = "/tmp/compose-db-agent.rdb"
+	return []string{"sh", "-c", "redis-cli --no-auth-warning --rdb " + tmp + " >&2 && cat " + tmp + " && rm -f " + tmp}, nil
+}
+
+// RestoreCommand: Redis only loads RDB files at startup, so there is no client to pipe into.
+func (redisDriver) RestoreCommand(c dbCreds, head []byte) ([]string, error) {
+	return nil, errors.New("redis can't load a dump into a running server; use dbSnapshot/dbRestore (volume snapshots) instead")
+}
+
+// redisReadCommands may run in read mode.
+var redisReadCommands = map[string]bool{
+	"GET": true, "MGET": true, "GETRANGE": true, "STRLEN": true, "EXISTS": true, "TYPE": true,
+	"TTL": true, "PTTL": true, "KEYS": true, "SCAN": true, "DBSIZE": true, "INFO": true, "RANDOMKEY": true,
+	"HGET": true, "HMGET": true, "HGETALL": true, "HKEYS": true, "HVALS": true, "HLEN": true, "HEXISTS": true, "HSCAN": true,
+	"LRANGE": true, "LINDEX": true, "LLEN": true,
+	"SMEMBERS": true, "SISMEMBER": true, "SCARD": true, "SSCAN": true,
+	"ZRANGE": true, "ZRANGEBYSCORE": true, "ZREVRANGE": true, "ZSCORE": true, "ZCARD": true, "ZCOUNT": true, "ZRANK": true, "ZSCAN": true,
+	"XRANGE": true, "XREVRANGE": true, "XLEN": true, "XINFO": true,
+	"PING": true, "MEMORY": true, "OBJECT": true,
+}
+
+// redisArgs splits a command line like redis-cli does: whitespace separated,
+// with "double" or 'single' quoted arguments.
+func redisArgs(s string) ([]string, error) {
+	var args []string
+	var cur strings.Builder
+	inArg := false
+	var quote rune
+	esc := false
+	for _, r := range s {
+		switch {
+		case esc:
+			cur.WriteRune(r)
+			esc = false
+		case quote != 0 && r == '\\' && quote == '"':
+			esc = true
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			cur.WriteRune(r)
+		case r == '"' || r == '\'':
+			quote, inArg = r, true
+		case r == ' ' || r == '\t' || r == '\n' || r == '\r':
+			if inArg {
+				args = append(args, cur.String())
+				cur.Reset()
+				inArg = false
+			}
+		default:
+			cur.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, errors.New("unterminated quote")
+	}
+	if inArg {
+		args = append(args, cur.String())
+	}
+	return args, nil
+}
+
+// CheckQuery takes one redis-cli command line. MEMORY/OBJECT/XINFO are only
+// read-only with their inspection subcommands.
+func (redisDriver) CheckQuery(q string) (string, bool, error) {
+	args, err := redisArgs(strings.TrimSpace(q))
+	if err != nil {
+		return "", false, err
+	}
+	if len(args) == 0 {
+		return "", false, errors.New("empty command")
+	}
+	cmd := strings.ToUpper(args[0])
+	readOnly := redisReadCommands[cmd]
+	if readOnly && (cmd == "MEMORY" || cmd == "OBJECT") && len(args) > 1 {
+		sub := strings.ToUpper(args[1])
+		readOnly = sub == "USAGE" || sub == "STATS" || sub == "ENCODING" || sub == "IDLETIME" || sub == "FREQ" || sub == "REFCOUNT"
+	}
+	return strings.TrimSpace(q), readOnly, nil
+}
+
+// Query runs the command and returns one "value" row per output line
+// (redis-cli's raw output, as for a pipe).
+func (redisDriver) Query(t dbTarget, c dbCreds, stmt string, write bool, limit int, timeout time.Duration) (*queryResult, error) {
+	args, err := redisArgs(stmt)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout+30*time.Second)
+	defer cancel()
+	var out bytes.Buffer
+	cmd := append([]string{"redis-cli", "--no-auth-warning", "-n", c.Database}, args...)
+	if err := streamComposeContext(ctx, execEnv(c), nil, &out, execArgs(t, c, cmd...)...); err != nil {
+		return nil, err
+	}
+	s := strings.TrimRight(out.String(), "\n")
+	if strings.HasPrefix(s, "ERR") || strings.HasPrefix(s, "WRONGTYPE") || strings.HasPrefix(s, "NOAUTH") {
+		return nil, errors.New(s)
+	}
+
+	res := &queryResult{Mode: "read", Columns: []string{"value"}, Rows: [][]any{}}
+	if write {
+		res.Mode = "write"
+	}
+	if s != "" {
+		for _, l := range strings.Split(s, "\n") {
+			if !write && len(res.Rows) == limit {
+				res.Truncated = true
+				break
+			}
+			res.Rows = append(res.Rows, []any{l})
+		}
+	}
+	res.RowCount = len(res.Rows)
+	return res, nil
+}
+
+// Users manages ACL users (Redis 6+). Passwords go in on stdin, not argv.
+func (redisDriver) Users(t dbTarget, admin dbCreds, action string, u dbUser) ([]string, error) {
+	var script string
+	switch action {
+	case "list":
+		script = "ACL USERS\n"
+	case "create":
+		perms := "+@all"
+		if u.Role == "readonly" {
+			perms = "+@read +@connection"
+		}
+		script = fmt.Sprintf("ACL SETUSER %s on %s ~* &* %s\n", u.Name, strconv.Quote(">"+u.Password), perms)
+	case "drop":
+		script = "ACL DELUSER " + u.Name + "\n"
+	default:
+		return nil, fmt.Errorf("unknown action %q (list|create|drop)", action)
+	}
+	var out bytes.Buffer
+	cmd := []string{"redis-cli", "--no-auth-warning"}
+	if err := streamComposeWithEnv(execEnv(admin), strings.NewReader(script), &out, execArgs(t, admin, cmd...)...); err != nil {
+		return nil, err
+	}
+	s := strings.TrimSpace(out.String())
+	if strings.HasPrefix(s, "ERR") || strings.HasPrefix(s, "NOAUTH") || strings.HasPrefix(s, "NOPERM") {
+		return nil, errors.New(s)
+	}
+	if action != "list" {
+		return nil, nil
+	}
+	return sqlLines(s), nil
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ---------- Postgres and MySQL/MariaDB driver ----------
+
+type sqlDriver struct{ kind string }
+
+func (d sqlDriver) Creds(env map[string]string) dbCreds {
+	c := dbCreds{Kind: d.kind}
+	if d.kind == "postgres" {
+		c.User = firstEnv(env, "POSTGRES_USER")
+		if c.User == "" {
+			c.User = "postgres"
+		}
+		c.Password = firstEnv(env, "POSTGRES_PASSWORD")
+		c.Database = firstEnv(env, "POSTGRES_DB")
+		if c.Database == "" {
+			c.Database = c.User
+		}
+		return c
+	}
+	c.User = firstEnv(env, "MYSQL_USER", "MARIADB_USER")
+	c.Password = firstEnv(env, "MYSQL_PASSWORD", "MARIADB_PASSWORD")
+	if c.User == "" {
+		c.User = "root"
+		c.Password = firstEnv(env, "MYSQL_ROOT_PASSWORD", "MARIADB_ROOT_PASSWORD")
+	}
+	c.Database = firstEnv(env, "MYSQL_DATABASE", "MARIADB_DATABASE")
+	return c
+}
+
+// AdminCreds: POSTGRES_USER is already a superuser; MySQL needs root.
+func (d sqlDriver) AdminCreds(env map[string]string) dbCreds {
+	c := d.Creds(env)
+	if d.kind == "mysql" {
+		c.User, c.Password = "root", firstEnv(env, "MYSQL_ROOT_PASSWORD", "MARIADB_ROOT_PASSWORD")
+	}
+	return c
+}
+
+func (d sqlDriver) PasswordEnv() string {
+	if d.kind == "mysql" {
+		return "MYSQL_PWD"
+	}
+	return "PGPASSWORD"
+}
+
+func (d sqlDriver) DefaultPort() int {
+	if d.kind == "mysql" {
+		return 3306
+	}
+	return 5432
+}
+
+func (d sqlDriver) URL(c dbCreds, host string, port int) string {
+	u := url.URL{Scheme: d.kind, Host: host + ":" + strconv.Itoa(port), Path: "/" + c.Database}
+	if c.Password != "" {
+		u.User = url.UserPassword(c.User, c.Password)
+	} else {
+		u.User = url.User(c.User)
+	}
+	return u.String()
+}
+
+func (d sqlDriver) ReadyCommand(c dbCreds) []string {
+	if d.kind == "mysql" {
+		// exits 0 as soon as the server answers, even if the login is refused
+		return []string{"mysqladmin", "ping", "-u", c.User, "--silent"}
+	}
+	return []string{"pg_isready", "-U", c.User, "-d", c.Database}
+}
+
+func (d sqlDriver) DumpCommand(c dbCreds, format string) ([]string, error) {
+	if d.kind == "mysql" {
+		return []string{"mysqldump", "-u", c.User, "--single-transaction", "--routines", "--triggers", "--no-tablespaces", c.Database}, nil
+	}
+	cmd := []string{"pg_dump", "-U", c.User, "-d", c.Database, "--no-owner"}
+	if format == "custom" {
+		cmd = append(cmd, "-Fc")
+	}
+	return cmd, nil
+}
+
+// RestoreCommand: pg_dump -Fc archives start with "PGDMP" and need pg_restore.
+func (d sqlDriver) RestoreCommand(c dbCreds, head []byte) ([]string, error) {
+	if d.kind == "mysql" {
+		return []string{"mysql", "-u", c.User, c.Database}, nil
+	}
+	if strings.HasPrefix(string(head), "PGDMP") {
+		return []string{"pg_restore", "-U", c.User, "-d", c.Database, "--clean", "--if-exists", "--no-owner", "--no-privileges"}, nil
+	}
+	return []string{"psql", "-U", c.User, "-d", c.Database, "-q", "-v", "ON_ERROR_STOP=1"}, nil
+}
+
+func (d sqlDriver) CheckQuery(q string) (string, bool, error) {
+	stmt, err := singleStatement(q)
+	if err != nil {
+		return "", false, err
+	}
+	return stmt, readOnlyKeywords[firstKeyword(stmt)] && sideEffectCall(stmt) == "", nil
+}
+
+func (d sqlDriver) Query(t dbTarget, c dbCreds, stmt string, write bool, limit int, timeout time.Duration) (*queryResult, error) {
+	return runQuery(t, c, stmt, write, limit, timeout)
+}
+
+var userName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_.-]{0,62}$`)
+
+func (d sqlDriver) Users(t dbTarget, admin dbCreds, action string, u dbUser) ([]string, error) {
+	var script string
+	switch {
+	case action == "list" && d.kind == "mysql":
+		script = "SELECT DISTINCT User FROM mysql.user WHERE User NOT LIKE 'mysql.%' AND User NOT LIKE 'mariadb.%' ORDER BY 1;\n"
+	case action == "list":
+		script = "SELECT rolname FROM pg_roles WHERE rolcanlogin ORDER BY 1;\n"
+	case action == "create" && d.kind == "mysql":
+		privs := "ALL PRIVILEGES"
+		if u.Role == "readonly" {
+			privs = "SELECT, SHOW VIEW"
+		}
+		acct := quoteLiteral(u.Name) + "@'%'"
+		script = fmt.Sprintf("CREATE USER %s IDENTIFIED BY %s;\nGRANT %s ON `%s`.* TO %s;\n",
+			acct, mysqlLiteral(u.Password), privs, u.Database, acct)
+	case action == "create":
+		id := quoteIdent(u.Name)
+		script = fmt.Sprintf("CREATE ROLE %s LOGIN PASSWORD %s;\nGRANT CONNECT, TEMPORARY ON DATABASE %s TO %s;\n",
+			id, quoteLiteral(u.Password), quoteIdent(u.Database), id)
+		if u.Role == "readonly" {
+			script += fmt.Sprintf("GRANT USAGE ON SCHEMA public TO %[1]s;\nGRANT SELECT ON ALL TABLES IN SCHEMA public TO %[1]s;\n"+
+				"ALTER DEFAULT PRIVILEGES IN SCHEMA public GRANT SELECT ON TABLES TO %[1]s;\n", id)
+		} else {
+			script += fmt.Sprintf("GRANT USAGE, CREATE ON SCHEMA public TO %[1]s;\nGRANT ALL ON ALL TABLES IN SCHEMA public TO %[1]s;\n"+
+				"GRANT ALL ON ALL SEQUENCES IN SCHEMA public TO %[1]s;\n"+
+				"ALTER DEFAULT PRIVILEGES IN SCHEMA public GRANT ALL ON TABLES TO %[1]s;\n"+
+				"ALTER DEFAULT PRIVILEGES IN SCHEMA public GRANT ALL ON SEQUENCES TO %[1]s;\n", id)
+		}
+	case action == "drop" && d.kind == "mysql":
+		script = fmt.Sprintf("DROP USER IF EXISTS %s@'%%';\n", quoteLiteral(u.Name))
+	case action == "drop":
+		// objects the user owns go to the admin; grants in this DB are revoked
+		id := quoteIdent(u.Name)
+		script = fmt.Sprintf("REASSIGN OWNED BY %[1]s TO CURRENT_USER;\nDROP OWNED BY %[1]s;\nDROP ROLE %[1]s;\n", id)
+	default:
+		return nil, fmt.Errorf("unknown action %q (list|create|drop)", action)
+	}
+	out, err := runSQL(t, admin, script)
+	if err != nil || action != "list" {
+		return nil, err
+	}
+	return sqlLines(out), nil
+}
+
+// mysqlLiteral quotes a string for MySQL, where backslash is an escape by default.
+func mysqlLiteral(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `''`).Replace(s) + "'"
+}
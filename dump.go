@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// ---------- Logical dumps (the engine's dump tool via compose exec) ----------
+
+// dbCreds are the DB credentials as the app sees them (APP_ENV_FILE).
+type dbCreds struct {
+	Kind     string // postgres | mysql | mongo | redis
+	User     string
+	Password string
+	Database string
+}
+
+// requireDatabase fails when no database name could be resolved (MySQL has no default).
+func (c dbCreds) requireDatabase() error {
+	if c.Database == "" {
+		return errors.New("no database name (set MYSQL_DATABASE in APP_ENV_FILE or pass database)")
+	}
+	return nil
+}
+
+// execArgs builds `compose ... exec -T -e <PW> <service> <cmd...>`.
+// The password variable is passed by name (value from our process env), never on argv.
+func execArgs(t dbTarget, c dbCreds, cmd ...string) []string {
+	args := []string{"-p", t.Project, "-f", t.ComposeFile, "exec", "-T", "-e", driverFor(c.Kind).PasswordEnv(), t.Service}
+	return append(args, cmd...)
+}
+
+// execEnv is the app env plus the password variable execArgs forwards.
+func execEnv(c dbCreds) map[string]string {
+	extra := readDotenv(os.Getenv("APP_ENV_FILE"))
+	extra[driverFor(c.Kind).PasswordEnv()] = c.Password
+	return extra
+}
+
+// ---------- Compression ----------
+
+// compressionFor returns none|gzip|zstd, from the explicit choice or the file extension.
+func compressionFor(path, explicit string) (string, error) {
+	switch explicit {
+	case "none", "gzip", "zstd":
+		return explicit, nil
+	case "":
+	default:
+		return "", fmt.Errorf("unknown compression %q (none|gzip|zstd)", explicit)
+	}
+	switch {
+	case strings.HasSuffix(path, ".gz"):
+		return "gzip", nil
+	case strings.HasSuffix(path, ".zst"):
+		return "zstd", nil
+	}
+	return "none", nil
+}
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+func compressTo(w io.Writer, comp string) (io.WriteCloser, error) {
+	switch comp {
+	case "gzip":
+		return gzip.NewWriter(w), nil
+	case "zstd":
+		return zstd.NewWriter(w)
+	}
+	return nopWriteCloser{w}, nil
+}
+
+func decompressFrom(r io.Reader, comp string) (io.ReadCloser, error) {
+	switch comp {
+	case "gzip":
+		return gzip.NewReader(r)
+	case "zstd":
+		d, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return d.IOReadCloser(), nil
+	}
+	return io.NopCloser(r), nil
+}
+
+// ---------- Dump / load ----------
+
+type dumpResult struct {
+	File        string `json:"file"`
+	Engine      string `json:"engine"`
+	Database    string `json:"database"`
+	Format      string `json:"format,omitempty"`
+	Compression string `json:"compression"`
+	SizeBytes   int64  `json:"size_bytes"`
+}
+
+// defaultDumpPath is <SNAPSHOT_DIR>/<project>/dumps/<timestamp>.<ext>.
+func defaultDumpPath(project, kind, format, comp string) string {
+	ext := ".sql"
+	switch {
+	case kind == "postgres" && format == "custom":
+		ext = ".dump"
+	case kind == "mongo":
+		ext = ".archive"
+	case kind == "redis":
+		ext = ".rdb"
+	}
+	switch comp {
+	case "gzip":
+		ext += ".gz"
+	case "zstd":
+		ext += ".zst"
+	}
+	name := time.Now().UTC().Format("20060102-150405") + ext
+	return filepath.Join(snapshotDir(project), "dumps", name)
+}
+
+// dumpFilePath confines a dump file to SNAPSHOT_DIR or APP_DIR: a path inside
+// SNAPSHOT_DIR (as dbDump reports them) is kept, anything else must be in APP_DIR.
+func dumpFilePath(project, file string) (string, error) {
+	root := filepath.Dir(snapshotDir(project))
+	if abs, err := filepath.Abs(file); err == nil {
+		if p, err := insideDir(root, abs, "SNAPSHOT_DIR"); err == nil {
+			return p, nil
+		}
+	}
+	if p, err := appPath(file); err == nil {
+		return p, nil
+	}
+	return "", fmt.Errorf("disallowed path: %q (must be inside SNAPSHOT_DIR or APP_DIR)", file)
+}
+
+// dumpDB streams the dump from the container into path, compressing on the host.
+func dumpDB(t dbTarget, c dbCreds, path, format, comp string) (*dumpResult, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	tmp := path + ".partial"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp) // no-op after the rename
+
+	cw, err := compressTo(f, comp)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	cmd, err := driverFor(c.Kind).DumpCommand(c, format)
+	if err == nil {
+		err = streamComposeWithEnv(execEnv(c), nil, cw, execArgs(t, c, cmd...)...)
+	}
+	if cerr := cw.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, err
+	}
+	fi, err := os.Stat(tmp)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return nil, err
+	}
+	res := &dumpResult{File: path, Engine: c.Kind, Database: c.Database, Compression: comp, SizeBytes: fi.Size()}
+	if c.Kind == "postgres" {
+		res.Format = format
+	}
+	return res, nil
+}
+
+// loadDB streams a (possibly compressed) dump into the container's client.
+// The driver picks the client from the first bytes; for Postgres the returned
+// format is custom (pg_dump -Fc archives start with "PGDMP") or plain.
+func loadDB(t dbTarget, c dbCreds, path, comp string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	dr, err := decompressFrom(f, comp)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", path, err)
+	}
+	defer dr.Close()
+
+	br := bufio.NewReader(dr)
+	magic, _ := br.Peek(5)
+	cmd, err := driverFor(c.Kind).RestoreCommand(c, magic)
+	if err != nil {
+		return "", err
+	}
+	format := ""
+	if c.Kind == "postgres" {
+		format = "plain"
+		if string(magic) == "PGDMP" {
+			format = "custom"
+		}
+	}
+	return format, streamComposeWithEnv(execEnv(c), br, io.Discard, execArgs(t, c, cmd...)...)
+}
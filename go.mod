@@ -1,3 +1,8 @@
 module github.com/vr33ni-dev/compose-db-agent
 
 go 1.24
+
+require (
+	github.com/klauspost/compress v1.18.0
+	gopkg.in/yaml.v3 v3.0.1
+)
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ---------- Health waiting (event-driven) ----------
+
+// healthResult is what waitHealthy reports back to the model.
+type healthResult struct {
+	Status       string `json:"status"`          // healthy | unhealthy | starting | no-healthcheck | exited | oom-killed | restarting
+	Probe        string `json:"probe,omitempty"` // healthcheck | exec | tcp | log | none
+	Health       string `json:"health,omitempty"`
+	ExitCode     *int   `json:"exit_code,omitempty"`
+	RestartCount int    `json:"restart_count,omitempty"`
+	LastCheck    string `json:"last_healthcheck_output,omitempty"`
+}
+
+// waitForHealth waits with the container's configured probe (see waitReady).
+func waitForHealth(ctx context.Context, id string) (healthResult, error) {
+	return waitReady(ctx, id, "")
+}
+
+// waitReady subscribes to the container's events and returns as soon as it
+// turns healthy, dies, is OOM-killed or restarts. Without a Docker healthcheck
+// the probe (resolveProbe) is polled every second instead; with none at all the
+// result is "no-healthcheck" right away. At the ctx deadline the status is
+// "starting" or "unhealthy".
+func waitReady(ctx context.Context, id, spec string) (healthResult, error) {
+	// Subscribe before inspecting so no transition falls between the two.
+	sub, cancel := context.WithCancel(ctx)
+	defer cancel()
+	evc, errc := engine.Events(sub, map[string][]string{
+		"type":      {"container"},
+		"container": {id},
+		"event":     {"health_status", "die", "oom", "restart"},
+	})
+
+	res, done, err := healthFromInspect(ctx, id)
+	if err != nil || done {
+		return res, err
+	}
+	info, err := engine.ContainerInspect(ctx, id)
+	if err != nil {
+		return res, err
+	}
+	p, err := resolveProbe(spec, info)
+	if err != nil {
+		return res, err
+	}
+	res.Probe = p.Kind
+	if p.Kind == "none" {
+		res.Status = "no-healthcheck"
+		return res, nil
+	}
+	if p.Kind == "healthcheck" && info.State.Health == nil {
+		res.Status = "no-healthcheck"
+		return res, errors.New("container has no healthcheck; use probe exec, tcp or log:<regex>")
+	}
+
+	var tick <-chan time.Time
+	if p.Kind != "healthcheck" {
+		if ok, out := probeOnce(ctx, p, info); ok {
+			res.Status, res.LastCheck = "healthy", out
+			return res, nil
+		}
+		t := time.NewTicker(time.Second)
+		defer t.Stop()
+		tick = t.C
+	}
+
+	for {
+		select {
+		case <-tick:
+			ok, out := probeOnce(ctx, p, info)
+			res.LastCheck = out
+			if ok {
+				res.Status = "healthy"
+				return res, nil
+			}
+		case ev, ok := <-evc:
+			if !ok {
+				err := <-errc
+				if ctx.Err() != nil {
+					return timeoutResult(id, res), errors.New("service not healthy in time")
+				}
+				return res, fmt.Errorf("docker event stream ended: %w", err)
+			}
+			switch {
+			case ev.Action == "health_status: healthy" && p.Kind == "healthcheck":
+				res, _, err := healthFromInspect(ctx, id)
+				res.Status, res.Probe = "healthy", p.Kind
+				return res, err
+			case strings.HasPrefix(ev.Action, "health_status"):
+				res.Health = strings.TrimSpace(strings.TrimPrefix(ev.Action, "health_status:"))
+			case ev.Action == "oom":
+				res, _, _ := healthFromInspect(ctx, id)
+				res.Status = "oom-killed"
+				return res, errors.New("container was OOM-killed")
+			case ev.Action == "die":
+				res, _, _ := healthFromInspect(ctx, id)
+				res.Status = "exited"
+				if code, err := strconv.Atoi(ev.Actor.Attributes["exitCode"]); err == nil {
+					res.ExitCode = &code
+				}
+				return res, fmt.Errorf("container exited with code %s", ev.Actor.Attributes["exitCode"])
+			case ev.Action == "restart":
+				res, _, _ := healthFromInspect(ctx, id)
+				res.Status = "restarting"
+				return res, errors.New("container is restarting (crash loop?)")
+			}
+		case <-ctx.Done():
+			return timeoutResult(id, res), errors.New("service not healthy in time")
+		}
+	}
+}
+
+// healthFromInspect reads the current state; done is true if no waiting is needed
+// (Docker reports healthy, or the container is gone or crash-looping).
+func healthFromInspect(ctx context.Context, id string) (healthResult, bool, error) {
+	info, err := engine.ContainerInspect(ctx, id)
+	if err != nil {
+		return healthResult{Status: "inspect-failed"}, true, err
+	}
+	st := info.State
+	res := healthResult{RestartCount: info.RestartCount}
+	if h := st.Health; h != nil {
+		res.Health = h.Status
+		if n := len(h.Log); n > 0 {
+			res.LastCheck = strings.TrimSpace(h.Log[n-1].Output)
+		}
+	}
+
+	switch {
+	case res.Health == "healthy":
+		res.Status = "healthy"
+		return res, true, nil
+	case st.OOMKilled:
+		res.Status = "oom-killed"
+		return res, true, errors.New("container was OOM-killed")
+	case st.Status == "exited" || st.Status == "dead":
+		code := st.ExitCode
+		res.Status, res.ExitCode = "exited", &code
+		return res, true, fmt.Errorf("container exited with code %d", code)
+	case st.Restarting:
+		res.Status = "restarting"
+		return res, true, errors.New("container is restarting (crash loop?)")
+	}
+	return res, false, nil
+}
+
+// timeoutResult refreshes the last healthcheck output for the timeout report:
+// "starting" while Docker's healthcheck is in its start period, else "unhealthy"
+// (failing healthcheck, or a fallback probe that never passed).
+func timeoutResult(id string, last healthResult) healthResult {
+	if last.Probe == "healthcheck" {
+		ctx, cancel := context.WithTimeout(context.Background(), defaultAPITimeout)
+		defer cancel()
+		if res, _, _ := healthFromInspect(ctx, id); res.Status != "inspect-failed" {
+			res.Probe = last.Probe
+			last = res
+		}
+	}
+	last.Status = "unhealthy"
+	if last.Health == "starting" {
+		last.Status = "starting"
+	}
+	return last
+}
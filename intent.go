@@ -0,0 +1,244 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ---------- Offline intent parser (no API key / API unreachable) ----------
+
+// toolCall is one tool invocation picked by the offline parser.
+type toolCall struct {
+	Tool string
+	Args map[string]any
+}
+
+// intentRule maps a phrasing onto a tool. Rules are tried in order, so the more
+// specific ones ("list snapshots", "migrate down") come before the general ones.
+type intentRule struct {
+	Tool    string
+	Match   *regexp.Regexp
+	Confirm string // destructive: the text must carry confirm: <Confirm> <project>
+	Args    func(clause, text string) map[string]any
+	// Destructive reports whether these args make the call destructive (default: Confirm != "")
+	Destructive func(args map[string]any) bool
+	// Refuse, if it returns a message, stops the request: too destructive to guess from free text
+	Refuse func(text, project string) string
+}
+
+var (
+	confirmRe = regexp.MustCompile(`(?i)\bconfirm(?:_phrase)?\s*[:=]\s*["']?([^"')]+?)["']?\s*(?:\)|$)`)
+	// conjunctions split only between spaces, so "before-and-after" stays one name
+	clauseSep = regexp.MustCompile(`(?i),?\s+(?:and\s+then|then|and)\s+|\s*;\s*`)
+	tailRe    = regexp.MustCompile(`(?i)\b(?:tail|last)\b\D{0,3}(\d+)`)
+	nameAsRe  = regexp.MustCompile(`(?i)\b(?:as|named|called)\s+["']?([A-Za-z0-9][A-Za-z0-9_.-]*)`)
+	nameRe    = regexp.MustCompile(`(?i)\b(?:snapshot|restore)\s+(?:snapshot\s+)?["']?([A-Za-z0-9][A-Za-z0-9_.-]*)`)
+	fileRe    = regexp.MustCompile(`(?i)([A-Za-z0-9_./-]+\.(?:sql|dump|archive|rdb|gz|zst)(?:\.[a-z0-9]+)?)\b`)
+	numRe     = regexp.MustCompile(`\b(\d+)\b`)
+	downRe    = regexp.MustCompile(`(?i)\b(down|roll ?back|revert)\b`)
+	noSeedRe  = regexp.MustCompile(`(?i)\b(no|without|skip)\s+seed`)
+	plainRe   = regexp.MustCompile(`(?i)\bplain\b|\bsql\b`)
+	volumesRe = regexp.MustCompile(`(?i)\b(delete|remove|drop|wipe)\b.*\bvolumes?\b`)
+	secsRe    = regexp.MustCompile(`(?i)(\d+)\s*(s|sec|secs|seconds)\b`)
+	fillerRe  = regexp.MustCompile(`(?i)^\s*(also\s+)?(delete|remove|drop|wipe)?\s*(the\s+)?(db\s+)?volumes?\s*$`)
+)
+
+var intentRules = []intentRule{
+	{Tool: "listProfiles", Match: regexp.MustCompile(`(?i)\bprofiles\b`)},
+	{Tool: "validate", Match: regexp.MustCompile(`(?i)\bvalidate\b|\bcheck\b.*\bcompose\b`)},
+	{Tool: "ensureDocker", Match: regexp.MustCompile(`(?i)\bdocker\b.*\b(start|running|ready|up)\b|\bstart\b.*\bdocker\b`)},
+	{Tool: "dbSnapshotList", Match: regexp.MustCompile(`(?i)\b(list|show)\b.*\bsnapshots\b|^\s*snapshots\s*$`)},
+	{Tool: "dbRestore", Match: regexp.MustCompile(`(?i)\brestore\b`), Confirm: "RESTORE", Args: func(c, _ string) map[string]any {
+		return captureName(c)
+	}},
+	{Tool: "dbMigrate", Match: regexp.MustCompile(`(?i)\bmigrat`), Confirm: "MIGRATE DOWN", Args: func(c, _ string) map[string]any {
+		a := map[string]any{"action": "up"}
+		l := strings.ToLower(c)
+		switch {
+		case strings.Contains(l, "status"):
+			a["action"] = "status"
+		case downRe.MatchString(l):
+			a["action"] = "down"
+		}
+		if m := numRe.FindStringSubmatch(c); m != nil {
+			n, _ := strconv.Atoi(m[1])
+			a["steps"] = float64(n)
+		}
+		return a
+	}, Destructive: func(a map[string]any) bool { return a["action"] == "down" }},
+	{Tool: "undo", Match: regexp.MustCompile(`(?i)\bundo\b`)},
+	{Tool: "dbReset", Match: regexp.MustCompile(`(?i)\b(reset|wipe|recreate)\b`), Confirm: "RESET", Args: func(c, _ string) map[string]any {
+		a := map[string]any{}
+		if noSeedRe.MatchString(c) {
+			a["seed"] = false
+		}
+		return a
+	}},
+	{Tool: "dbLoad", Match: regexp.MustCompile(`(?i)\b(load|import)\b`), Confirm: "LOAD", Args: func(c, _ string) map[string]any {
+		return capture(fileRe, c, "file")
+	}},
+	{Tool: "dbDump", Match: regexp.MustCompile(`(?i)\b(dump|export)\b`), Args: func(c, _ string) map[string]any {
+		a := capture(fileRe, c, "file")
+		if plainRe.MatchString(c) {
+			a["format"] = "plain"
+		}
+		return a
+	}},
+	{Tool: "dbSnapshot", Match: regexp.MustCompile(`(?i)\b(snapshot|save|back ?up)\b`), Args: func(c, _ string) map[string]any {
+		return captureName(c)
+	}},
+	{Tool: "dbSeed", Match: regexp.MustCompile(`(?i)\bseed\b`)},
+	{Tool: "serviceLogs", Match: regexp.MustCompile(`(?i)\blogs?\b`), Args: func(c, _ string) map[string]any {
+		a := map[string]any{}
+		if m := tailRe.FindStringSubmatch(c); m != nil {
+			n, _ := strconv.Atoi(m[1])
+			a["tail"] = float64(n)
+		}
+		return a
+	}},
+	{Tool: "composeDown", Match: regexp.MustCompile(`(?i)\b(ramp|spin|bring|shut|take|power)\b.*\bdown\b|\bstop\b|\bteardown\b|\btear\b.*\bdown\b`), Args: func(string, string) map[string]any {
+		return map[string]any{"remove_volumes": false} // never the interactive prompt
+	}, Refuse: func(text, project string) string {
+		if !volumesRe.MatchString(text) {
+			return ""
+		}
+		return "deleting the DB volume is not guessed from free text offline; run `compose-db-agent down --remove-volumes`, or ask for \"reset (confirm: RESET " + project + ")\""
+	}},
+	{Tool: "composeUp", Match: regexp.MustCompile(`(?i)\b(ramp|spin|bring|boot|fire|start)\b.*\bup\b|^\s*(start|up|boot)\b|\bstart\b.*\b(db|database)\b`)},
+	{Tool: "waitHealthy", Match: regexp.MustCompile(`(?i)\bwait\b|\bhealthy\b|\bready\b`), Args: func(c, _ string) map[string]any {
+		a := map[string]any{}
+		if m := secsRe.FindStringSubmatch(c); m != nil {
+			n, _ := strconv.Atoi(m[1])
+			a["timeout_sec"] = float64(n)
+		}
+		return a
+	}},
+	{Tool: "waitHealthy", Match: regexp.MustCompile(`(?i)\bstatus\b|\bis\b.*\b(up|running|healthy)\b`), Args: func(string, string) map[string]any {
+		return map[string]any{"timeout_sec": float64(1)}
+	}},
+	{Tool: "dbEngine", Match: regexp.MustCompile(`(?i)\bengine\b|\bwhich (db|database)\b`)},
+	{Tool: "dbConnectionInfo", Match: regexp.MustCompile(`(?i)\bconnect(ion)?\b|\bdsn\b|\bdatabase_url\b|\bport\b`)},
+	{Tool: "dbSchema", Match: regexp.MustCompile(`(?i)\bschema\b|\btables\b`)},
+}
+
+func capture(re *regexp.Regexp, s, key string) map[string]any {
+	a := map[string]any{}
+	if m := re.FindStringSubmatch(s); m != nil {
+		a[key] = m[1]
+	}
+	return a
+}
+
+// captureName finds a snapshot name: "as <name>" first, then "snapshot <name>",
+// skipping filler words ("snapshot the DB").
+func captureName(s string) map[string]any {
+	for _, re := range []*regexp.Regexp{nameAsRe, nameRe} {
+		for _, m := range re.FindAllStringSubmatch(s, -1) {
+			switch strings.ToLower(m[1]) {
+			case "the", "a", "db", "database", "snapshot", "latest", "last":
+				continue
+			}
+			return map[string]any{"name": m[1]}
+		}
+	}
+	return map[string]any{}
+}
+
+// parseIntent turns a request into tool calls, one per clause ("ramp up and wait").
+// Every clause must match a rule; destructive calls need the exact confirm phrase
+// in the text. Otherwise it returns an error instead of guessing.
+func parseIntent(text, project string) ([]toolCall, error) {
+	confirm := ""
+	if m := confirmRe.FindStringSubmatch(text); m != nil {
+		confirm = strings.TrimSpace(m[1])
+	}
+	body := strings.TrimSpace(confirmRe.ReplaceAllString(text, ""))
+	body = strings.Trim(body, " .!?(")
+	if body == "" {
+		return nil, fmt.Errorf("empty request")
+	}
+
+	var calls []toolCall
+	for _, clause := range clauseSep.Split(body, -1) {
+		if strings.TrimSpace(clause) == "" {
+			continue
+		}
+		r, ok := matchRule(clause)
+		if !ok {
+			if len(calls) > 0 && isFiller(clause) {
+				continue // "... and the volume" belongs to the previous clause
+			}
+			return nil, fmt.Errorf("could not interpret %q offline", clause)
+		}
+		if r.Refuse != nil {
+			if msg := r.Refuse(text, project); msg != "" {
+				return nil, fmt.Errorf("%s: %s", r.Tool, msg)
+			}
+		}
+		args := map[string]any{}
+		if r.Args != nil {
+			args = r.Args(clause, text)
+		}
+		destructive := r.Confirm != ""
+		if r.Destructive != nil {
+			destructive = r.Destructive(args)
+		}
+		if destructive {
+			expect := r.Confirm + " " + project
+			if confirm != expect {
+				return nil, fmt.Errorf("%s is destructive; add (confirm: %s) to run it offline", r.Tool, expect)
+			}
+			args["confirm_phrase"] = confirm
+		}
+		calls = append(calls, toolCall{Tool: r.Tool, Args: args})
+	}
+	if len(calls) == 0 {
+		return nil, fmt.Errorf("could not interpret %q offline", text)
+	}
+	return calls, nil
+}
+
+func matchRule(clause string) (intentRule, bool) {
+	for _, r := range intentRules {
+		if r.Match.MatchString(clause) {
+			return r, true
+		}
+	}
+	return intentRule{}, false
+}
+
+// isFiller reports clauses that only qualify the previous one ("delete the volume").
+func isFiller(clause string) bool {
+	return fillerRe.MatchString(clause)
+}
+
+// runOffline runs the interpreted calls in order and stops at the first error.
+func runOffline(text string) int {
+	calls, err := parseIntent(text, currentProject())
+	if err != nil {
+		fmt.Println("Offline mode:", err)
+		fmt.Println("Use a subcommand instead (see `help`), or configure an LLM provider (LLM_PROVIDER, ANTHROPIC_API_KEY).")
+		return 1
+	}
+	names := make([]string, len(calls))
+	for i, c := range calls {
+		names[i] = c.Tool
+	}
+	fmt.Println("(offline: " + strings.Join(names, " -> ") + ")")
+	for _, c := range calls {
+		toolDefaults(c.Tool, c.Args)
+		out, isErr, err := callTool(c.Tool, c.Args)
+		if out != "" {
+			fmt.Println(out)
+		}
+		if err != nil {
+			fmt.Println("Error:", err)
+		}
+		if err != nil || isErr {
+			return 1
+		}
+	}
+	return 0
+}
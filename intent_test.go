@@ -0,0 +1,77 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseIntent(t *testing.T) {
+	type args = map[string]any
+	tests := []struct {
+		text    string
+		want    []toolCall
+		wantErr string
+	}{
+		// clauses
+		{"ramp up and wait", []toolCall{{"composeUp", args{}}, {"waitHealthy", args{}}}, ""},
+		{"start the db, then wait 30s", []toolCall{{"composeUp", args{}}, {"waitHealthy", args{"timeout_sec": 30.0}}}, ""},
+		{"bring up the stack; show profiles", []toolCall{{"composeUp", args{}}, {"listProfiles", args{}}}, ""},
+		{"seed and then show tables.", []toolCall{{"dbSeed", args{}}, {"dbSchema", args{}}}, ""},
+		{"validate and check docker is running", []toolCall{{"validate", args{}}, {"ensureDocker", args{}}}, ""},
+		{"snapshot as before-and-after", []toolCall{{"dbSnapshot", args{"name": "before-and-after"}}}, ""},
+		{"snapshot as rock-then-roll and stop", []toolCall{{"dbSnapshot", args{"name": "rock-then-roll"}}, {"composeDown", args{"remove_volumes": false}}}, ""},
+		{"backup as sandbox", []toolCall{{"dbSnapshot", args{"name": "sandbox"}}}, ""},
+
+		// rule order: the specific phrasing wins
+		{"list snapshots", []toolCall{{"dbSnapshotList", args{}}}, ""},
+		{"snapshots", []toolCall{{"dbSnapshotList", args{}}}, ""},
+		{"snapshot the db", []toolCall{{"dbSnapshot", args{}}}, ""},
+		{"snapshot nightly", []toolCall{{"dbSnapshot", args{"name": "nightly"}}}, ""},
+		{"migration status", []toolCall{{"dbMigrate", args{"action": "status"}}}, ""},
+		{"migrate", []toolCall{{"dbMigrate", args{"action": "up"}}}, ""},
+		{"migrate up 3", []toolCall{{"dbMigrate", args{"action": "up", "steps": 3.0}}}, ""},
+		{"dump plain to out/backup.sql", []toolCall{{"dbDump", args{"file": "out/backup.sql", "format": "plain"}}}, ""},
+		{"export the db to shop.dump", []toolCall{{"dbDump", args{"file": "shop.dump"}}}, ""},
+		{"show logs, last 50", []toolCall{{"serviceLogs", args{"tail": 50.0}}}, ""},
+		{"is it running?", []toolCall{{"waitHealthy", args{"timeout_sec": 1.0}}}, ""},
+		{"which database is this", []toolCall{{"dbEngine", args{}}}, ""},
+		{"what's the connection string", []toolCall{{"dbConnectionInfo", args{}}}, ""},
+		{"start docker", []toolCall{{"ensureDocker", args{}}}, ""},
+		{"undo", []toolCall{{"undo", args{}}}, ""},
+		{"tear it down", []toolCall{{"composeDown", args{"remove_volumes": false}}}, ""},
+
+		// confirm phrases
+		{"restore pre-demo (confirm: RESTORE shop)", []toolCall{{"dbRestore", args{"name": "pre-demo", "confirm_phrase": "RESTORE shop"}}}, ""},
+		{`reset without seed, confirm="RESET shop"`, []toolCall{{"dbReset", args{"seed": false, "confirm_phrase": "RESET shop"}}}, ""},
+		{"save and then reset (confirm_phrase: 'RESET shop')", []toolCall{{"dbSnapshot", args{}}, {"dbReset", args{"confirm_phrase": "RESET shop"}}}, ""},
+		{"migrate down 2 (confirm: MIGRATE DOWN shop)", []toolCall{{"dbMigrate", args{"action": "down", "steps": 2.0, "confirm_phrase": "MIGRATE DOWN shop"}}}, ""},
+		{"load seed.sql (confirm: LOAD shop)", []toolCall{{"dbLoad", args{"file": "seed.sql", "confirm_phrase": "LOAD shop"}}}, ""},
+		{"restore pre-demo", nil, "add (confirm: RESTORE shop)"},
+		{"restore pre-demo (confirm: RESTORE blog)", nil, "add (confirm: RESTORE shop)"},
+		{"restore pre-demo (confirm: RESET shop)", nil, "add (confirm: RESTORE shop)"},
+		{"roll back the migration", nil, "add (confirm: MIGRATE DOWN shop)"},
+		{"ramp up and reset", nil, "dbReset is destructive"},
+
+		// refusals
+		{"tear down and delete the volume", nil, "composeDown: deleting the DB volume"},
+		{"stop, then wipe volumes (confirm: RESET shop)", nil, "composeDown: deleting the DB volume"},
+		{"do a barrel roll", nil, `could not interpret "do a barrel roll"`},
+		{"ramp up and make coffee", nil, `could not interpret "make coffee"`},
+		{"delete the volume", nil, "could not interpret"},
+		{"  ?! ", nil, "empty request"},
+		{"(confirm: RESET shop)", nil, "empty request"},
+	}
+	for _, tt := range tests {
+		got, err := parseIntent(tt.text, "shop")
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("parseIntent(%q) = %v, %v; want error %q", tt.text, got, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseIntent(%q) = %v, %v; want %v", tt.text, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// ---------- Line editor (REPL input) ----------
+
+// errInterrupt is returned by readLine on Ctrl-C; the REPL just prompts again.
+var errInterrupt = errors.New("interrupt")
+
+// lineEditor reads lines with cursor movement and history when stdin is a
+// terminal (raw mode via stty, so no extra dependency), else plain lines.
+type lineEditor struct {
+	in      *bufio.Reader
+	out     io.Writer
+	tty     bool
+	history []string
+	file    string // history file, appended per line
+}
+
+func newLineEditor(historyFile string) *lineEditor {
+	e := &lineEditor{in: bufio.NewReader(os.Stdin), out: os.Stdout, file: historyFile}
+	if st, err := os.Stdin.Stat(); err == nil && st.Mode()&os.ModeCharDevice != 0 {
+		_, err := stty("-g")
+		e.tty = err == nil
+	}
+	if b, err := os.ReadFile(historyFile); err == nil {
+		for _, l := range strings.Split(string(b), "\n") {
+			if l != "" {
+				e.history = append(e.history, l)
+			}
+		}
+	}
+	return e
+}
+
+// stty runs stty on the terminal.
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	out, err := cmd.Output()
+	return strings.TrimSpace(string(out)), err
+}
+
+// addHistory records a line (skipping repeats) and appends it to the history file.
+func (e *lineEditor) addHistory(line string) {
+	if line == "" || strings.Contains(line, "\n") || (len(e.history) > 0 && e.history[len(e.history)-1] == line) {
+		return
+	}
+	e.history = append(e.history, line)
+	if e.file == "" {
+		return
+	}
+	if f, err := os.OpenFile(e.file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600); err == nil {
+		fmt.Fprintln(f, line)
+		f.Close()
+	}
+}
+
+func (e *lineEditor) readLine(prompt string) (string, error) {
+	if !e.tty {
+		fmt.Fprint(e.out, prompt)
+		line, err := e.in.ReadString('\n')
+		if err != nil && line == "" {
+			return "", err
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+
+	saved, err := stty("-g")
+	if err == nil {
+		_, err = stty("raw", "-echo")
+	}
+	if err != nil {
+		e.tty = false
+		return e.readLine(prompt)
+	}
+	defer stty(saved)
+
+	var buf []rune
+	pos, hist := 0, len(e.history)
+	draft := "" // the line being typed before browsing history
+	redraw := func() {
+		fmt.Fprintf(e.out, "\r%s%s\x1b[K", prompt, string(buf))
+		if n := len(buf) - pos; n > 0 {
+			fmt.Fprintf(e.out, "\x1b[%dD", n)
+		}
+	}
+	setLine := func(s string) {
+		buf = []rune(s)
+		pos = len(buf)
+	}
+	redraw()
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			return "", err
+		}
+		switch r {
+		case '\r', '\n':
+			fmt.Fprint(e.out, "\r\n")
+			return string(buf), nil
+		case 3: // Ctrl-C
+			fmt.Fprint(e.out, "^C\r\n")
+			return "", errInterrupt
+		case 4: // Ctrl-D
+			if len(buf) == 0 {
+				fmt.Fprint(e.out, "\r\n")
+				return "", io.EOF
+			}
+			if pos < len(buf) {
+				buf = append(buf[:pos], buf[pos+1:]...)
+			}
+		case 127, 8: // Backspace
+			if pos > 0 {
+				buf = append(buf[:pos-1], buf[pos:]...)
+				pos--
+			}
+		case 1: // Ctrl-A
+			pos = 0
+		case 5: // Ctrl-E
+			pos = len(buf)
+		case 11: // Ctrl-K
+			buf = buf[:pos]
+		case 21: // Ctrl-U
+			buf, pos = buf[pos:], 0
+		case 23: // Ctrl-W
+			i := pos
+			for i > 0 && buf[i-1] == ' ' {
+				i--
+			}
+			for i > 0 && buf[i-1] != ' ' {
+				i--
+			}
+			buf, pos = append(buf[:i], buf[pos:]...), i
+		case 27: // escape sequences: arrows, Home/End, Delete
+			b1, _ := e.in.ReadByte()
+			if b1 != '[' && b1 != 'O' {
+				break
+			}
+			b2, _ := e.in.ReadByte()
+			switch b2 {
+			case 'A': // up
+				if hist > 0 {
+					if hist == len(e.history) {
+						draft = string(buf)
+					}
+					hist--
+					setLine(e.history[hist])
+				}
+			case 'B': // down
+				if hist < len(e.history) {
+					hist++
+					if hist == len(e.history) {
+						setLine(draft)
+					} else {
+						setLine(e.history[hist])
+					}
+				}
+			case 'C':
+				if pos < len(buf) {
+					pos++
+				}
+			case 'D':
+				if pos > 0 {
+					pos--
+				}
+			case 'H':
+				pos = 0
+			case 'F':
+				pos = len(buf)
+			case '3': // Delete is ESC [ 3 ~
+				if b, _ := e.in.ReadByte(); b == '~' && pos < len(buf) {
+					buf = append(buf[:pos], buf[pos+1:]...)
+				}
+			}
+		default:
+			if r >= ' ' {
+				buf = append(buf[:pos], append([]rune{r}, buf[pos:]...)...)
+				pos++
+			}
+		}
+		redraw()
+	}
+}
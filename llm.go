@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ---------- LLM providers ----------
+
+// llmProvider is a chat backend with tool calling. The conversation is kept in
+// the Anthropic shape (Msg / ContentBlock / ToolDecl); providers translate.
+// Send calls onText with text as it arrives and onBlock with every finished
+// content block (tool_use with its full input), in order.
+type llmProvider interface {
+	Name() string
+	Send(req MessageReq, onText func(string), onBlock func(ContentBlock)) (*MessageResp, error)
+}
+
+// newProvider picks the backend from LLM_PROVIDER (default anthropic):
+//
+//	anthropic  Messages API; ANTHROPIC_API_KEY, ANTHROPIC_MODEL, ANTHROPIC_BASE_URL
+//	openai     any OpenAI-compatible chat completions API; LLM_API_KEY or OPENAI_API_KEY
+//	ollama     local Ollama (http://localhost:11434/v1), no key
+//	llamacpp   local llama.cpp server (http://localhost:8080/v1), no key
+//
+// LLM_MODEL and LLM_BASE_URL override the model and endpoint of any of them.
+func newProvider() (llmProvider, error) {
+	model, base := os.Getenv("LLM_MODEL"), os.Getenv("LLM_BASE_URL")
+	switch kind := strings.ToLower(os.Getenv("LLM_PROVIDER")); kind {
+	case "", "anthropic":
+		key := os.Getenv("ANTHROPIC_API_KEY")
+		if key == "" {
+			return nil, fmt.Errorf("ANTHROPIC_API_KEY is not set")
+		}
+		if model == "" {
+			model = os.Getenv("ANTHROPIC_MODEL")
+		}
+		if model == "" {
+			model = "claude-sonnet-4-20250514"
+		}
+		if base == "" {
+			base = os.Getenv("ANTHROPIC_BASE_URL")
+		}
+		return &anthropicProvider{key: key, model: model, base: base}, nil
+	case "openai":
+		key := os.Getenv("LLM_API_KEY")
+		if key == "" {
+			key = os.Getenv("OPENAI_API_KEY")
+		}
+		if key == "" {
+			return nil, fmt.Errorf("LLM_API_KEY (or OPENAI_API_KEY) is not set")
+		}
+		return newOpenAIProvider("openai", key, model, base, "https://api.openai.com/v1", "gpt-4o-mini"), nil
+	case "ollama":
+		return newOpenAIProvider("ollama", os.Getenv("LLM_API_KEY"), model, base, "http://localhost:11434/v1", "llama3.1"), nil
+	case "llamacpp", "llama.cpp":
+		return newOpenAIProvider("llamacpp", os.Getenv("LLM_API_KEY"), model, base, "http://localhost:8080/v1", "local"), nil
+	default:
+		return nil, fmt.Errorf("unknown LLM_PROVIDER %q (anthropic, openai, ollama, llamacpp)", kind)
+	}
+}
+
+// emitResponse replays a complete (non-streamed) response through the callbacks.
+func emitResponse(resp *MessageResp, onText func(string), onBlock func(ContentBlock)) {
+	for _, b := range resp.Content {
+		if b.Type == "text" && b.Text != "" && onText != nil {
+			onText(b.Text)
+		}
+		if onBlock != nil {
+			onBlock(b)
+		}
+	}
+}
+
+// ---------- Anthropic ----------
+
+type anthropicProvider struct {
+	key, model, base string
+}
+
+func (p *anthropicProvider) Name() string { return "anthropic" }
+
+func (p *anthropicProvider) Send(req MessageReq, onText func(string), onBlock func(ContentBlock)) (*MessageResp, error) {
+	req.Model = p.model
+	if streamingEnabled() {
+		return streamAnthropic(p.key, p.url(), req, onText, onBlock)
+	}
+	resp, err := callAnthropic(p.key, p.url(), req)
+	if err == nil {
+		emitResponse(resp, onText, onBlock)
+	}
+	return resp, err
+}
+
+func (p *anthropicProvider) url() string {
+	base := p.base
+	if base == "" {
+		base = "https://api.anthropic.com"
+	}
+	return strings.TrimRight(base, "/") + "/v1/messages"
+}
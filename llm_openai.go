@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ---------- OpenAI-compatible chat completions (OpenAI, Ollama, llama.cpp) ----------
+
+type openAIProvider struct {
+	name, key, model, base string
+}
+
+func newOpenAIProvider(name, key, model, base, defBase, defModel string) *openAIProvider {
+	if base == "" {
+		base = defBase
+	}
+	if model == "" {
+		model = defModel
+	}
+	return &openAIProvider{name: name, key: key, model: model, base: strings.TrimRight(base, "/")}
+}
+
+func (p *openAIProvider) Name() string { return p.name }
+
+type oaiMessage struct {
+	Role       string        `json:"role"`
+	Content    *string       `json:"content"` // null for assistant turns with only tool calls
+	ToolCalls  []oaiToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string        `json:"tool_call_id,omitempty"`
+}
+
+type oaiToolCall struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"` // JSON text
+	} `json:"function"`
+}
+
+type oaiTool struct {
+	Type     string `json:"type"`
+	Function struct {
+		Name        string         `json:"name"`
+		Description string         `json:"description"`
+		Parameters  map[string]any `json:"parameters"`
+	} `json:"function"`
+}
+
+type oaiRequest struct {
+	Model     string       `json:"model"`
+	Messages  []oaiMessage `json:"messages"`
+	Tools     []oaiTool    `json:"tools,omitempty"`
+	MaxTokens int          `json:"max_tokens,omitempty"`
+}
+
+type oaiResponse struct {
+	Choices []struct {
+		Message oaiMessage `json:"message"`
+	} `json:"choices"`
+}
+
+func (p *openAIProvider) Send(req MessageReq, onText func(string), onBlock func(ContentBlock)) (*MessageResp, error) {
+	b, _ := json.Marshal(toOpenAI(p.model, req))
+	httpReq, _ := http.NewRequest("POST", p.base+"/chat/completions", bytes.NewReader(b))
+	httpReq.Header.Set("Content-Type", "application/json")
+	if p.key != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+p.key)
+	}
+	res, err := http.DefaultClient.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	body, _ := io.ReadAll(res.Body)
+	if res.StatusCode >= 300 {
+		return nil, fmt.Errorf("status %d: %s", res.StatusCode, string(body))
+	}
+	var out oaiResponse
+	if err := json.Unmarshal(body, &out); err != nil {
+		return nil, err
+	}
+	if len(out.Choices) == 0 {
+		return nil, fmt.Errorf("no choices in response: %s", string(body))
+	}
+	resp := fromOpenAI(out.Choices[0].Message)
+	emitResponse(resp, onText, onBlock)
+	return resp, nil
+}
+
+// toOpenAI translates the conversation: tool_use blocks become the assistant's
+// tool_calls, each tool_result a "tool" message.
+func toOpenAI(model string, req MessageReq) oaiRequest {
+	str := func(s string) *string { return &s }
+	out := oaiRequest{Model: model, MaxTokens: req.MaxTokens}
+	if req.System != "" {
+		out.Messages = append(out.Messages, oaiMessage{Role: "system", Content: str(req.System)})
+	}
+	for _, m := range req.Messages {
+		var text []string
+		var calls []oaiToolCall
+		for _, b := range m.Content {
+			switch b.Type {
+			case "text":
+				text = append(text, b.Text)
+			case "tool_use":
+				c := oaiToolCall{ID: b.ID, Type: "function"}
+				c.Function.Name, c.Function.Arguments = b.Name, string(b.Input)
+				if c.Function.Arguments == "" {
+					c.Function.Arguments = "{}"
+				}
+				calls = append(calls, c)
+			case "tool_result":
+				content := b.Content
+				if b.IsError && !strings.HasPrefix(content, "Error") {
+					content = "Error: " + content
+				}
+				out.Messages = append(out.Messages, oaiMessage{Role: "tool", ToolCallID: b.ToolUseID, Content: str(content)})
+			}
+		}
+		if len(text) == 0 && len(calls) == 0 {
+			continue
+		}
+		msg := oaiMessage{Role: m.Role, ToolCalls: calls}
+		if len(text) > 0 || m.Role != "assistant" {
+			msg.Content = str(strings.Join(text, "\n"))
+		}
+		out.Messages = append(out.Messages, msg)
+	}
+	for _, d := range req.Tools {
+		var t oaiTool
+		t.Type = "function"
+		t.Function.Name, t.Function.Description, t.Function.Parameters = d.Name, d.Description, d.InputSchema
+		out.Tools = append(out.Tools, t)
+	}
+	return out
+}
+
+// fromOpenAI turns the assistant message back into content blocks. Local
+// servers sometimes omit call IDs or send arguments that aren't JSON.
+func fromOpenAI(m oaiMessage) *MessageResp {
+	var resp MessageResp
+	if m.Content != nil && strings.TrimSpace(*m.Content) != "" {
+		resp.Content = append(resp.Content, ContentBlock{Type: "text", Text: *m.Content})
+	}
+	for i, c := range m.ToolCalls {
+		id := c.ID
+		if id == "" {
+			id = "call_" + strconv.Itoa(i)
+		}
+		in := json.RawMessage(c.Function.Arguments)
+		if !json.Valid(in) {
+			in = json.RawMessage("{}")
+		}
+		resp.Content = append(resp.Content, ContentBlock{Type: "tool_use", ID: id, Name: c.Function.Name, Input: in})
+	}
+	return &resp
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// openAIServer answers every chat completion with reply and hands the raw
+// request body to check.
+func openAIServer(t *testing.T, reply string, check func(body []byte)) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/v1/chat/completions" {
+			t.Errorf("request %s %s", r.Method, r.URL.Path)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer test-key" {
+			t.Errorf("Authorization = %q", got)
+		}
+		body, _ := io.ReadAll(r.Body)
+		if check != nil {
+			check(body)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, reply)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestOpenAISendTranslatesConversation(t *testing.T) {
+	req := MessageReq{
+		Model:     "ignored",
+		System:    "be careful",
+		MaxTokens: 512,
+		Tools:     []ToolDecl{{Name: "composeUp", Description: "start", InputSchema: map[string]any{"type": "object"}}},
+		Messages: []Msg{
+			{Role: "user", Content: []ContentBlock{{Type: "text", Text: "start the db and wait"}}},
+			{Role: "assistant", Content: []ContentBlock{
+				{Type: "tool_use", ID: "tu_1", Name: "composeUp", Input: json.RawMessage(`{"services":["db"]}`)},
+				{Type: "tool_use", ID: "tu_2", Name: "waitHealthy"},
+			}},
+			{Role: "user", Content: []ContentBlock{
+				{Type: "tool_result", ToolUseID: "tu_1", Content: "started"},
+				{Type: "tool_result", ToolUseID: "tu_2", Content: "timed out", IsError: true},
+			}},
+			{Role: "assistant", Content: []ContentBlock{
+				{Type: "text", Text: "It timed out."},
+				{Type: "tool_use", ID: "tu_3", Name: "serviceLogs", Input: json.RawMessage(`{}`)},
+			}},
+			{Role: "user", Content: []ContentBlock{
+				{Type: "tool_result", ToolUseID: "tu_3", Content: "Error: no container", IsError: true},
+				{Type: "text", Text: "try again"},
+			}},
+		},
+	}
+	want := `[
+		{"role": "system", "content": "be careful"},
+		{"role": "user", "content": "start the db and wait"},
+		{"role": "assistant", "content": null, "tool_calls": [
+			{"id": "tu_1", "type": "function", "function": {"name": "composeUp", "arguments": "{\"services\":[\"db\"]}"}},
+			{"id": "tu_2", "type": "function", "function": {"name": "waitHealthy", "arguments": "{}"}}]},
+		{"role": "tool", "tool_call_id": "tu_1", "content": "started"},
+		{"role": "tool", "tool_call_id": "tu_2", "content": "Error: timed out"},
+		{"role": "assistant", "content": "It timed out.", "tool_calls": [
+			{"id": "tu_3", "type": "function", "function": {"name": "serviceLogs", "arguments": "{}"}}]},
+		{"role": "tool", "tool_call_id": "tu_3", "content": "Error: no container"},
+		{"role": "user", "content": "try again"}
+	]`
+	srv := openAIServer(t, `{"choices": [{"message": {"role": "assistant", "content": "Retrying."}}]}`, func(body []byte) {
+		var got struct {
+			Model     string          `json:"model"`
+			MaxTokens int             `json:"max_tokens"`
+			Messages  json.RawMessage `json:"messages"`
+			Tools     []oaiTool       `json:"tools"`
+		}
+		if err := json.Unmarshal(body, &got); err != nil {
+			t.Error(err)
+			return
+		}
+		if got.Model != "gpt-test" || got.MaxTokens != 512 {
+			t.Errorf("model = %q, max_tokens = %d", got.Model, got.MaxTokens)
+		}
+		if len(got.Tools) != 1 || got.Tools[0].Type != "function" || got.Tools[0].Function.Name != "composeUp" ||
+			got.Tools[0].Function.Parameters["type"] != "object" {
+			t.Errorf("tools = %+v", got.Tools)
+		}
+		var g, w any
+		json.Unmarshal(got.Messages, &g)
+		json.Unmarshal([]byte(want), &w)
+		if !reflect.DeepEqual(g, w) {
+			t.Errorf("messages:\n%s\nwant:\n%s", got.Messages, want)
+		}
+	})
+
+	p := newOpenAIProvider("openai", "test-key", "gpt-test", srv.URL+"/v1/", "", "")
+	var texts []string
+	resp, err := p.Send(req, func(s string) { texts = append(texts, s) }, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Content) != 1 || resp.Content[0].Text != "Retrying." || !reflect.DeepEqual(texts, []string{"Retrying."}) {
+		t.Errorf("resp = %+v, texts = %q", resp, texts)
+	}
+}
+
+func TestOpenAISendToolCalls(t *testing.T) {
+	// a local server: null content, a missing call ID and arguments that aren't JSON
+	srv := openAIServer(t, `{"choices": [{"message": {"role": "assistant", "content": null, "tool_calls": [
+		{"type": "function", "function": {"name": "composeUp", "arguments": "{\"services\": [\"db\"]}"}},
+		{"id": "abc", "type": "function", "function": {"name": "waitHealthy", "arguments": "{timeout_sec: 5"}},
+		{"type": "function", "function": {"name": "dbEngine", "arguments": ""}}
+	]}}]}`, nil)
+
+	p := newOpenAIProvider("ollama", "test-key", "", srv.URL+"/v1", "", "llama")
+	var blocks []string
+	resp, err := p.Send(MessageReq{Messages: []Msg{{Role: "user", Content: []ContentBlock{{Type: "text", Text: "up"}}}}},
+		func(s string) { t.Errorf("unexpected text %q", s) },
+		func(b ContentBlock) { blocks = append(blocks, b.Type+":"+b.ID) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ContentBlock{
+		{Type: "tool_use", ID: "call_0", Name: "composeUp", Input: json.RawMessage(`{"services": ["db"]}`)},
+		{Type: "tool_use", ID: "abc", Name: "waitHealthy", Input: json.RawMessage(`{}`)},
+		{Type: "tool_use", ID: "call_2", Name: "dbEngine", Input: json.RawMessage(`{}`)},
+	}
+	if !reflect.DeepEqual(resp.Content, want) {
+		t.Errorf("content = %+v, want %+v", resp.Content, want)
+	}
+	if strings.Join(blocks, " ") != "tool_use:call_0 tool_use:abc tool_use:call_2" {
+		t.Errorf("blocks = %q", blocks)
+	}
+}
+
+func TestOpenAISendErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		reply   string
+		wantErr string
+	}{
+		{"status", http.StatusTooManyRequests, `{"error": {"message": "slow down"}}`, "status 429: " + `{"error": {"message": "slow down"}}`},
+		{"no choices", http.StatusOK, `{"choices": []}`, "no choices in response"},
+		{"not JSON", http.StatusOK, `<html>`, "invalid character"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				fmt.Fprint(w, tt.reply)
+			}))
+			defer srv.Close()
+			p := newOpenAIProvider("llamacpp", "", "", srv.URL, "", "local")
+			if _, err := p.Send(MessageReq{}, nil, nil); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -3,14 +3,17 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
 	"strings"
 )
 
-// ---- Anthropic wire types ----
+// ---- Wire types (Anthropic Messages API; other providers translate) ----
 
 type ToolDecl struct {
 	Name        string         `json:"name"`
@@ -37,6 +40,7 @@ type MessageReq struct {
 	MaxTokens int        `json:"max_tokens"`
 	Tools     []ToolDecl `json:"tools,omitempty"`
 	Messages  []Msg      `json:"messages"`
+	Stream    bool       `json:"stream,omitempty"`
 }
 type MessageResp struct {
 	Content []ContentBlock `json:"content"`
@@ -44,108 +48,177 @@ type MessageResp struct {
 
 // Build the system prompt with your actual defaults baked in (clear for the model)
 func systemPrompt() string {
-	p := os.Getenv("PROJECT")
+	p := currentProject()
 	cf := os.Getenv("COMPOSE_FILE")
 	ds := os.Getenv("DB_SERVICE")
+	dv := os.Getenv("DB_VOLUME")
 	if p == "" {
 		p = "unknown-project"
 	}
+	prof := activeProfile
+	if prof == "" {
+		prof = "(none; from env)"
+	}
 
 	return fmt.Sprintf(
 		`You are a cautious project-scoped Dev DB agent for %[1]q.
 You manage docker compose for the database only.
 
-Defaults:
+Defaults (config profile %[5]s):
 - project = %[1]s
 - compose_file = %[2]s
 - db_service = %[3]s
+- db_volume = %[4]s
 
 Rules:
-- Use composeUp/composeDown/waitHealthy/dbReset tools as needed.
+- When setup looks wrong (compose errors, DB never healthy, missing volume or credentials), call validate and explain each finding with its fix.
+- Use composeUp/composeDown/waitHealthy/dbReset tools as needed. waitHealthy status "no-healthcheck" means the container runs but nothing confirmed readiness; say so instead of calling it healthy.
+- composeUp/composeDown only touch db_service unless the user names other services.
 - For destructive resets, require confirm_phrase = "RESET %[1]s".
+- Use dbSnapshot before risky changes; dbRestore requires confirm_phrase = "RESTORE %[1]s".
+- Use dbMigrate for schema migrations; down/goto-lower requires confirm_phrase = "MIGRATE DOWN %[1]s".
+- Seed with dbSeed (the reviewed seed file); only use seed_cmd when the user gives an explicit command.
+- Call dbSchema before writing SQL against unfamiliar tables; use dbSchemaDiff to review what migrations changed (against a snapshot, dump, another project or another profile).
+- Answer questions about the data with dbQuery (read mode). Only use mode=write when the user explicitly asks and gives confirm_phrase = "WRITE %[1]s".
+- To fork the seeded DB for tests/experiments use dbClone (inside the same Postgres; dbList shows them); dbDrop requires confirm_phrase = "DROP %[1]s/<name>".
+- dbEngine shows the detected engine (postgres, mysql, mongo, redis), readiness and connection URL. For mongo, dbQuery's sql is a mongosh expression; for redis, a redis-cli command. Migrations, schema tools and dbClone are SQL only.
+- If composeUp/dbReset report port_conflicts, tell the user which port was taken, by whom, and the new host port.
+- When the user asks how to connect (host port, DSN, DATABASE_URL), call dbConnectionInfo. Only set show_password=true if they ask for the password.
+- dbUser manages DB users (list, create, drop); drop requires confirm_phrase = "DROP USER %[1]s/<name>". Show generated passwords to the user once.
+- Per-branch DBs: use branchDB (list, switch, clone from main, gc); clone over an existing branch DB requires confirm_phrase = "CLONE <branch project>", gc requires "GC <base project>".
+- Destructive tools snapshot the DB first; if the user wants to go back, call undo.
+- dbDump writes a portable logical dump; dbLoad requires confirm_phrase = "LOAD %[1]s".
+- listProfiles shows the configured apps; to target another one the user restarts with --profile <name> (in the REPL: /profile <name>).
 - Keep responses short and actionable.`,
-		p, cf, ds,
+		p, cf, ds, dv, prof,
 	)
 }
 
 func main() {
-	key := os.Getenv("ANTHROPIC_API_KEY")
-	if key == "" {
-		fmt.Println("Set ANTHROPIC_API_KEY in .env")
+	profile := flag.String("profile", "", "named profile from compose-db-agent.yaml (default: AGENT_PROFILE, then the file's default)")
+	flag.Parse()
+	if err := loadProfile(*profile); err != nil {
+		fmt.Println("Config error:", err)
 		os.Exit(1)
 	}
-	model := os.Getenv("ANTHROPIC_MODEL")
-	if model == "" {
-		model = "claude-sonnet-4-20250514"
+	if liveOutputEnabled() {
+		liveOutput = os.Stderr
+	}
+	// Subcommands (up, status, snapshot ...) call the tool directly, no API key needed
+	if flag.NArg() > 0 {
+		if code, ok := runSubcommand(flag.Args()); ok {
+			os.Exit(code)
+		}
 	}
 
 	// Natural-language instruction comes from CLI args
 	userInput := "Ramp up the DB and wait until it's ready."
-	if len(os.Args) > 1 {
-		userInput = strings.Join(os.Args[1:], " ")
+	if flag.NArg() > 0 {
+		userInput = strings.Join(flag.Args(), " ")
+	}
+
+	llm, llmErr := newProvider()
+	// repl [session id]: interactive, keeps the conversation across prompts
+	if flag.Arg(0) == "repl" && flag.NArg() <= 2 {
+		if llmErr != nil {
+			fmt.Println(llmErr.Error() + "; requests are interpreted offline.")
+			llm = nil
+		}
+		os.Exit(runREPL(llm, flag.Arg(1)))
+	}
+	if llmErr != nil {
+		// no model: rule-based fallback for common requests
+		fmt.Println(llmErr.Error() + "; interpreting the request offline.")
+		os.Exit(runOffline(userInput))
 	}
 
 	msgs := []Msg{{Role: "user", Content: []ContentBlock{{Type: "text", Text: userInput}}}}
+	out, err := runAgent(llm, msgs, nil, printText)
+	var netErr *url.Error
+	if err != nil && len(out) == len(msgs) && errors.As(err, &netErr) {
+		// API unreachable before anything ran: fall back to the offline parser
+		fmt.Println(llm.Name() + " unreachable (" + err.Error() + "); interpreting the request offline.")
+		os.Exit(runOffline(userInput))
+	}
+	if err != nil {
+		fmt.Println(llm.Name()+" error:", err)
+		os.Exit(1)
+	}
+}
 
+// printText writes model text to stdout as it arrives.
+func printText(s string) { fmt.Print(s) }
+
+// toolTrace sees each tool call the model makes, after it ran.
+type toolTrace func(name string, args map[string]any, out string, isErr bool)
+
+// runAgent sends msgs to the model and runs the tools it asks for until it
+// answers with text (at most 8 steps). text receives the model's text as the
+// provider produces it; each tool runs as soon as its tool_use block is
+// complete. It returns the extended conversation; on error, the conversation
+// up to the failed request.
+func runAgent(llm llmProvider, msgs []Msg, trace toolTrace, text func(string)) ([]Msg, error) {
 	for step := 0; step < 8; step++ {
 		req := MessageReq{
-			Model:     model,
 			System:    systemPrompt(),
 			MaxTokens: 700,
 			Tools:     toolDecls(),
 			Messages:  msgs,
 		}
-		resp, err := callAnthropic(key, req)
-		if err != nil {
-			fmt.Println("Anthropic error:", err)
-			os.Exit(1)
-		}
-		// record assistant blocks
-		msgs = append(msgs, Msg{Role: "assistant", Content: resp.Content})
 
 		// handle tool calls (tool_use)
-		used := false
-		for _, b := range resp.Content {
-			if b.Type == "tool_use" {
-				used = true
-				name := b.Name
-				args := map[string]any{}
-				_ = json.Unmarshal(b.Input, &args)
-				fillDefaults(args) // pull from env if the model omitted something
-
-				out, isErr, err := callTool(name, args)
-				tres := ContentBlock{
-					Type:      "tool_result",
-					ToolUseID: b.ID,
-					Content:   out,
-					IsError:   isErr,
-				}
-				if err != nil {
-					tres.Content = "Error: " + err.Error()
-					tres.IsError = true
-				}
-				msgs = append(msgs, Msg{Role: "user", Content: []ContentBlock{tres}})
+		var results []Msg
+		wrote := false
+		runToolUse := func(b ContentBlock) {
+			if b.Type != "tool_use" {
+				return
 			}
-		}
-		if !used {
-			// final text
-			var sb strings.Builder
-			for _, b := range resp.Content {
-				if b.Type == "text" {
-					sb.WriteString(b.Text)
-					sb.WriteByte('\n')
-				}
+			if wrote {
+				text("\n")
+				wrote = false
+			}
+			args := map[string]any{}
+			_ = json.Unmarshal(b.Input, &args)
+			fillDefaults(args) // pull from env if the model omitted something
+
+			out, isErr, err := callTool(b.Name, args)
+			tres := ContentBlock{
+				Type:      "tool_result",
+				ToolUseID: b.ID,
+				Content:   out,
+				IsError:   isErr,
+			}
+			if err != nil {
+				tres.Content = "Error: " + err.Error()
+				tres.IsError = true
+			}
+			if trace != nil {
+				trace(b.Name, args, tres.Content, tres.IsError)
 			}
-			fmt.Print(strings.TrimSpace(sb.String()))
-			return
+			results = append(results, Msg{Role: "user", Content: []ContentBlock{tres}})
+		}
+
+		resp, err := llm.Send(req, func(s string) { text(s); wrote = true }, runToolUse)
+		if err != nil {
+			return msgs, err
+		}
+		if wrote {
+			text("\n")
+		}
+		// record assistant blocks, then the tool results
+		msgs = append(msgs, Msg{Role: "assistant", Content: resp.Content})
+		msgs = append(msgs, results...)
+		if len(results) == 0 {
+			return msgs, nil
 		}
 	}
-	fmt.Println("Stopped after too many tool steps.")
+	text("Stopped after too many tool steps.\n")
+	return msgs, nil
 }
 
-func callAnthropic(key string, req MessageReq) (*MessageResp, error) {
+func callAnthropic(key, endpoint string, req MessageReq) (*MessageResp, error) {
 	b, _ := json.Marshal(req)
-	httpReq, _ := http.NewRequest("POST", "https://api.anthropic.com/v1/messages", bytes.NewReader(b))
+	httpReq, _ := http.NewRequest("POST", endpoint, bytes.NewReader(b))
 	httpReq.Header.Set("Content-Type", "application/json")
 	httpReq.Header.Set("x-api-key", key)
 	httpReq.Header.Set("anthropic-version", "2023-06-01")
@@ -162,10 +235,10 @@ func callAnthropic(key string, req MessageReq) (*MessageResp, error) {
 	return &out, json.Unmarshal(body, &out)
 }
 
-// Inject env defaults if the model didn't supply them
+// Inject env defaults (the selected profile is already applied to the env) if the model didn't supply them
 func fillDefaults(m map[string]any) {
 	if _, ok := m["project"]; !ok {
-		m["project"] = os.Getenv("PROJECT")
+		m["project"] = currentProject()
 	}
 	if _, ok := m["compose_file"]; !ok {
 		m["compose_file"] = os.Getenv("COMPOSE_FILE")
@@ -173,4 +246,7 @@ func fillDefaults(m map[string]any) {
 	if _, ok := m["db_service"]; !ok {
 		m["db_service"] = os.Getenv("DB_SERVICE")
 	}
+	if _, ok := m["db_volume"]; !ok {
+		m["db_volume"] = os.Getenv("DB_VOLUME")
+	}
 }
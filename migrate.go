@@ -0,0 +1,280 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ---------- SQL migrations (NNN_name.up.sql / NNN_name.down.sql) ----------
+
+type migration struct {
+	Version int64  `json:"version"`
+	Name    string `json:"name"`
+	Up      string `json:"-"` // file paths
+	Down    string `json:"-"`
+}
+
+var (
+	migrationFile = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+	// a file that manages its own transaction, or opts out (CREATE INDEX CONCURRENTLY)
+	ownTransaction = regexp.MustCompile(`(?im)^\s*(?:BEGIN(?:\s+(?:WORK|TRANSACTION))?\s*;|START\s+TRANSACTION\b|--\s*no-transaction\b)`)
+)
+
+// migrationsDir resolves dir (default MIGRATIONS_DIR, then "migrations") inside APP_DIR.
+func migrationsDir(dir string) (string, error) {
+	if dir == "" {
+		dir = os.Getenv("MIGRATIONS_DIR")
+	}
+	if dir == "" {
+		dir = "migrations"
+	}
+	return insideDir(os.Getenv("APP_DIR"), dir, "APP_DIR")
+}
+
+// loadMigrations reads a migrations directory, sorted by version.
+func loadMigrations(dir string) ([]migration, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	byVersion := map[int64]*migration{}
+	for _, e := range entries {
+		m := migrationFile.FindStringSubmatch(e.Name())
+		if e.IsDir() || m == nil {
+			continue
+		}
+		v, err := strconv.ParseInt(m[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: bad version: %w", e.Name(), err)
+		}
+		mig := byVersion[v]
+		if mig == nil {
+			mig = &migration{Version: v, Name: m[2]}
+			byVersion[v] = mig
+		} else if mig.Name != m[2] {
+			return nil, fmt.Errorf("version %d used by both %q and %q", v, mig.Name, m[2])
+		}
+		if m[3] == "up" {
+			mig.Up = filepath.Join(dir, e.Name())
+		} else {
+			mig.Down = filepath.Join(dir, e.Name())
+		}
+	}
+	out := make([]migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no .up.sql", m.Version, m.Name)
+		}
+		out = append(out, *m)
+	}
+	sort.Slice(out, func(i, k int) bool { return out[i].Version < out[k].Version })
+	return out, nil
+}
+
+func migrationsTableSQL(kind string) string {
+	if kind == "mysql" {
+		return `CREATE TABLE IF NOT EXISTS schema_migrations (version BIGINT PRIMARY KEY, name VARCHAR(255) NOT NULL, applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP);`
+	}
+	return `CREATE TABLE IF NOT EXISTS schema_migrations (version BIGINT PRIMARY KEY, name TEXT NOT NULL, applied_at TIMESTAMPTZ NOT NULL DEFAULT now());`
+}
+
+// appliedVersions creates schema_migrations if needed and returns its versions, ascending.
+func appliedVersions(t dbTarget, c dbCreds) ([]int64, error) {
+	out, err := runSQL(t, c, migrationsTableSQL(c.Kind)+"\nSELECT version FROM schema_migrations ORDER BY version;\n")
+	if err != nil {
+		return nil, err
+	}
+	var vs []int64
+	for _, l := range sqlLines(out) {
+		v, err := strconv.ParseInt(strings.TrimSpace(l), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("unexpected schema_migrations row %q", l)
+		}
+		vs = append(vs, v)
+	}
+	return vs, nil
+}
+
+// applyMigration runs one direction of a migration and records it. On Postgres the
+// file and the bookkeeping share a transaction, unless the file has its own
+// BEGIN or a "-- no-transaction" line; MySQL DDL commits implicitly anyway.
+func applyMigration(t dbTarget, c dbCreds, m migration, up bool) error {
+	path, record := m.Up, fmt.Sprintf("INSERT INTO schema_migrations (version, name) VALUES (%d, '%s');", m.Version, strings.ReplaceAll(m.Name, "'", "''"))
+	if !up {
+		if m.Down == "" {
+			return fmt.Errorf("migration %d_%s has no .down.sql", m.Version, m.Name)
+		}
+		path, record = m.Down, fmt.Sprintf("DELETE FROM schema_migrations WHERE version = %d;", m.Version)
+	}
+	body, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	script := strings.TrimSpace(string(body))
+	if !strings.HasSuffix(script, ";") {
+		script += "\n;" // own line, in case the file ends in a -- comment
+	}
+	script += "\n" + record + "\n"
+	if c.Kind == "postgres" && !ownTransaction.Match(body) {
+		script = "BEGIN;\n" + script + "COMMIT;\n"
+	}
+	if _, err := runSQL(t, c, script); err != nil {
+		return fmt.Errorf("%s: %w", filepath.Base(path), err)
+	}
+	return nil
+}
+
+type migrationStatus struct {
+	migration
+	Applied bool `json:"applied"`
+}
+
+type migrateResult struct {
+	Action  string            `json:"action"`
+	Dir     string            `json:"dir"`
+	Applied []migration       `json:"applied,omitempty"`
+	Rolled  []migration       `json:"rolled_back,omitempty"`
+	Status  []migrationStatus `json:"status,omitempty"`
+	Current int64             `json:"current_version"`
+	Missing []int64           `json:"applied_without_files,omitempty"`
+
+	// DRY_RUN: what would run; the DB isn't queried, so nothing counts as applied
+	WouldApply    []migration `json:"would_apply,omitempty"`
+	WouldRollBack []migration `json:"would_roll_back,omitempty"`
+	Note          string      `json:"note,omitempty"`
+}
+
+// plan works out which migrations an action runs: ups ascending, downs descending.
+// action is up (steps 0 = all), down (steps, default 1), goto (target) or status.
+func plan(all []migration, applied []int64, action string, steps int, target int64) (ups, downs []migration, err error) {
+	isApplied := map[int64]bool{}
+	for _, v := range applied {
+		isApplied[v] = true
+	}
+	var pending, done []migration
+	for _, m := range all {
+		if isApplied[m.Version] {
+			done = append(done, m)
+		} else {
+			pending = append(pending, m)
+		}
+	}
+	reverse := func(ms []migration) []migration {
+		out := make([]migration, len(ms))
+		for i, m := range ms {
+			out[len(ms)-1-i] = m
+		}
+		return out
+	}
+
+	switch action {
+	case "status":
+		return nil, nil, nil
+	case "up":
+		if steps > 0 && steps < len(pending) {
+			pending = pending[:steps]
+		}
+		return pending, nil, nil
+	case "down":
+		if steps <= 0 {
+			steps = 1
+		}
+		if steps > len(done) {
+			steps = len(done)
+		}
+		return nil, reverse(done)[:steps], nil
+	case "goto":
+		if target != 0 {
+			known := false
+			for _, m := range all {
+				known = known || m.Version == target
+			}
+			if !known {
+				return nil, nil, fmt.Errorf("no migration with version %d", target)
+			}
+		}
+		for _, m := range pending {
+			if m.Version <= target {
+				ups = append(ups, m)
+			}
+		}
+		for _, m := range reverse(done) {
+			if m.Version > target {
+				downs = append(downs, m)
+			}
+		}
+		return ups, downs, nil
+	}
+	return nil, nil, fmt.Errorf("unknown action %q (up|down|goto|status)", action)
+}
+
+// migrate runs action against the DB and reports what changed plus the final status.
+func migrate(t dbTarget, c dbCreds, dir, action string, steps int, target int64) (*migrateResult, error) {
+	all, err := loadMigrations(dir)
+	if err != nil {
+		return nil, err
+	}
+	applied, err := appliedVersions(t, c)
+	if err != nil {
+		return nil, err
+	}
+	ups, downs, err := plan(all, applied, action, steps, target)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &migrateResult{Action: action, Dir: dir}
+	if dryRun {
+		res.WouldApply, res.WouldRollBack = ups, downs
+		res.Note = "dry-run: the DB isn't queried, so every migration counts as pending"
+		return res, nil
+	}
+	for _, m := range downs {
+		if err := applyMigration(t, c, m, false); err != nil {
+			return res, err
+		}
+		res.Rolled = append(res.Rolled, m)
+	}
+	for _, m := range ups {
+		if err := applyMigration(t, c, m, true); err != nil {
+			return res, err
+		}
+		res.Applied = append(res.Applied, m)
+	}
+
+	if len(ups)+len(downs) > 0 {
+		if applied, err = appliedVersions(t, c); err != nil {
+			return res, err
+		}
+	}
+	isApplied := map[int64]bool{}
+	for _, v := range applied {
+		isApplied[v] = true
+		res.Current = v
+	}
+	for _, m := range all {
+		res.Status = append(res.Status, migrationStatus{m, isApplied[m.Version]})
+		delete(isApplied, m.Version)
+	}
+	for v := range isApplied {
+		res.Missing = append(res.Missing, v)
+	}
+	sort.Slice(res.Missing, func(i, k int) bool { return res.Missing[i] < res.Missing[k] })
+	return res, nil
+}
+
+// migrateDestroys reports whether an action would run any down migration.
+func migrateDestroys(action string, target int64, applied []int64) bool {
+	switch action {
+	case "down":
+		return len(applied) > 0
+	case "goto":
+		return len(applied) > 0 && applied[len(applied)-1] > target
+	}
+	return false
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writeMigrations(t *testing.T, names ...string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for _, n := range names {
+		if err := os.WriteFile(filepath.Join(dir, n), []byte("SELECT 1;"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestLoadMigrations(t *testing.T) {
+	dir := writeMigrations(t, "10_tags.up.sql", "001_init.up.sql", "001_init.down.sql",
+		"2_add_email.up.sql", "README.md", "3_notes.sql", "004_x.up.SQL")
+	if err := os.Mkdir(filepath.Join(dir, "5_dir.up.sql"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	got, err := loadMigrations(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []migration{
+		{1, "init", filepath.Join(dir, "001_init.up.sql"), filepath.Join(dir, "001_init.down.sql")},
+		{2, "add_email", filepath.Join(dir, "2_add_email.up.sql"), ""},
+		{10, "tags", filepath.Join(dir, "10_tags.up.sql"), ""},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("loadMigrations = %+v, want %+v", got, want)
+	}
+
+	for _, tt := range []struct {
+		files   []string
+		wantErr string
+	}{
+		{[]string{"1_a.up.sql", "2_b.down.sql"}, "migration 2_b has no .up.sql"},
+		{[]string{"1_a.up.sql", "01_b.up.sql"}, `version 1 used by both`},
+		{[]string{"99999999999999999999_big.up.sql"}, "bad version"},
+	} {
+		_, err := loadMigrations(writeMigrations(t, tt.files...))
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("loadMigrations(%q) = %v, want error %q", tt.files, err, tt.wantErr)
+		}
+	}
+	if _, err := loadMigrations(filepath.Join(dir, "missing")); !os.IsNotExist(err) {
+		t.Errorf("missing dir: %v", err)
+	}
+}
+
+func TestPlan(t *testing.T) {
+	all := []migration{{Version: 1}, {Version: 2}, {Version: 3}, {Version: 5}}
+	versions := func(ms []migration) []int64 {
+		var out []int64
+		for _, m := range ms {
+			out = append(out, m.Version)
+		}
+		return out
+	}
+	tests := []struct {
+		name       string
+		applied    []int64
+		action     string
+		steps      int
+		target     int64
+		ups, downs []int64
+		wantErr    string
+	}{
+		{"status", []int64{1}, "status", 0, 0, nil, nil, ""},
+		{"up all", []int64{1}, "up", 0, 0, []int64{2, 3, 5}, nil, ""},
+		{"up steps", []int64{1}, "up", 2, 0, []int64{2, 3}, nil, ""},
+		{"up more steps than pending", []int64{1, 2, 3}, "up", 9, 0, []int64{5}, nil, ""},
+		{"up nothing pending", []int64{1, 2, 3, 5}, "up", 0, 0, nil, nil, ""},
+		{"up fills a gap", []int64{1, 3}, "up", 0, 0, []int64{2, 5}, nil, ""},
+		{"down default one", []int64{1, 2, 3}, "down", 0, 0, nil, []int64{3}, ""},
+		{"down steps", []int64{1, 2, 3}, "down", 2, 0, nil, []int64{3, 2}, ""},
+		{"down more steps than applied", []int64{1, 2}, "down", 5, 0, nil, []int64{2, 1}, ""},
+		{"down nothing applied", nil, "down", 1, 0, nil, nil, ""},
+		{"down skips unknown versions", []int64{1, 2, 4}, "down", 1, 0, nil, []int64{2}, ""},
+		{"goto forward", []int64{1}, "goto", 0, 3, []int64{2, 3}, nil, ""},
+		{"goto back", []int64{1, 2, 3, 5}, "goto", 0, 2, nil, []int64{5, 3}, ""},
+		{"goto both ways", []int64{1, 3}, "goto", 0, 2, []int64{2}, []int64{3}, ""},
+		{"goto zero", []int64{1, 2}, "goto", 0, 0, nil, []int64{2, 1}, ""},
+		{"goto unknown", []int64{1}, "goto", 0, 4, nil, nil, "no migration with version 4"},
+		{"unknown action", nil, "sideways", 0, 0, nil, nil, `unknown action "sideways"`},
+	}
+	for _, tt := range tests {
+		ups, downs, err := plan(all, tt.applied, tt.action, tt.steps, tt.target)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s: err = %v, want %q", tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(versions(ups), tt.ups) || !reflect.DeepEqual(versions(downs), tt.downs) {
+			t.Errorf("%s: plan = up %v, down %v, %v; want up %v, down %v", tt.name, versions(ups), versions(downs), err, tt.ups, tt.downs)
+		}
+	}
+}
+
+func TestMigrateDestroys(t *testing.T) {
+	tests := []struct {
+		action  string
+		target  int64
+		applied []int64
+		want    bool
+	}{
+		{"up", 0, []int64{1, 2}, false},
+		{"status", 0, []int64{1, 2}, false},
+		{"down", 0, []int64{1}, true},
+		{"down", 0, nil, false},
+		{"goto", 2, []int64{1, 2}, false},
+		{"goto", 3, []int64{1, 2}, false},
+		{"goto", 1, []int64{1, 2}, true},
+		{"goto", 0, []int64{1}, true},
+		{"goto", 0, nil, false},
+	}
+	for _, tt := range tests {
+		if got := migrateDestroys(tt.action, tt.target, tt.applied); got != tt.want {
+			t.Errorf("migrateDestroys(%q, %d, %v) = %v, want %v", tt.action, tt.target, tt.applied, got, tt.want)
+		}
+	}
+}
+
+func TestOwnTransaction(t *testing.T) {
+	tests := []struct {
+		sql  string
+		want bool
+	}{
+		{"CREATE TABLE t (a int);", false},
+		{"BEGIN;\nCREATE TABLE t (a int);\nCOMMIT;", true},
+		{"  begin work;\nUPDATE t SET a = 1;\ncommit;", true},
+		{"BEGIN TRANSACTION;\nSELECT 1;\nEND;", true},
+		{"START TRANSACTION;\nSELECT 1;\nCOMMIT;", true},
+		{"-- no-transaction\nCREATE INDEX CONCURRENTLY i ON t (a);", true},
+		{"--no-transaction", true},
+		{"-- no-transactions please", false},
+		{"CREATE FUNCTION f() RETURNS void AS $$\nBEGIN\n  NULL;\nEND;\n$$ LANGUAGE plpgsql;", false},
+		{"DO $$ BEGIN PERFORM 1; END $$;", false},
+		{"SELECT 1; -- then BEGIN;", false},
+	}
+	for _, tt := range tests {
+		if got := ownTransaction.MatchString(tt.sql); got != tt.want {
+			t.Errorf("ownTransaction(%q) = %v, want %v", tt.sql, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,352 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ---------- Host port pre-flight (conflicts and remapping) ----------
+
+// portConflict is a published port of a service we are about to start that is
+// already taken on the host.
+type portConflict struct {
+	Service    string `json:"service"`
+	Port       int    `json:"port"`
+	Target     int    `json:"target"`
+	Holder     string `json:"holder"`
+	RemappedTo int    `json:"remapped_to,omitempty"`
+}
+
+// servicePort is one entry of a service's ports: after `compose config`.
+type servicePort struct {
+	Service   string
+	Target    int
+	Published int
+	HostIP    string
+	Protocol  string
+}
+
+func (p servicePort) String() string {
+	s := strconv.Itoa(p.Published) + ":" + strconv.Itoa(p.Target)
+	if p.HostIP != "" {
+		s = net.JoinHostPort(p.HostIP, strconv.Itoa(p.Published)) + ":" + strconv.Itoa(p.Target)
+	}
+	if p.Protocol != "" && p.Protocol != "tcp" {
+		s += "/" + p.Protocol
+	}
+	return s
+}
+
+// portOverridePath is where the remapping compose override for one service lives.
+func portOverridePath(project, service string) string {
+	return filepath.Join(snapshotDir(project), "ports", service+".override.yml")
+}
+
+// composeFileArgs is `-p <project> -f <compose>`, plus the branch label and
+// active port overrides.
+func composeFileArgs(project, composeFile string) []string {
+	args := []string{"-p", project, "-f", composeFile}
+	files, _ := filepath.Glob(filepath.Join(snapshotDir(project), "ports", "*.override.yml"))
+	sort.Strings(files)
+	if _, err := os.Stat(branchOverridePath(project)); err == nil {
+		files = append([]string{branchOverridePath(project)}, files...)
+	}
+	for _, f := range files {
+		if abs, err := filepath.Abs(f); err == nil {
+			f = abs // compose runs with --project-directory APP_DIR
+		}
+		args = append(args, "-f", f)
+	}
+	return args
+}
+
+// composePorts reads the published ports of services from `compose config`
+// (so env interpolation and extends are already resolved). Port ranges are skipped.
+func composePorts(extra map[string]string, project, composeFile string, services []string) ([]servicePort, error) {
+	out, err := runComposeWithEnv(extra, "-p", project, "-f", composeFile, "config", "--format", "json")
+	if err != nil {
+		return nil, err
+	}
+	var cfg struct {
+		Services map[string]struct {
+			Ports []struct {
+				Target    int    `json:"target"`
+				Published any    `json:"published"` // "5432" in newer compose, 5432 in older
+				HostIP    string `json:"host_ip"`
+				Protocol  string `json:"protocol"`
+			} `json:"ports"`
+		} `json:"services"`
+	}
+	if err := json.Unmarshal([]byte(out), &cfg); err != nil {
+		return nil, fmt.Errorf("compose config: %w", err)
+	}
+	var ports []servicePort
+	for _, svc := range services {
+		for _, p := range cfg.Services[svc].Ports {
+			n, err := strconv.Atoi(strings.TrimSpace(fmt.Sprint(p.Published)))
+			if err != nil || n == 0 {
+				continue // unpublished, random or a range
+			}
+			ports = append(ports, servicePort{Service: svc, Target: p.Target, Published: n, HostIP: p.HostIP, Protocol: p.Protocol})
+		}
+	}
+	return ports, nil
+}
+
+// portHolders maps host ports to the running containers publishing them,
+// leaving out the project's own containers (compose recreates those anyway).
+func portHolders(project string) (map[int]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultAPITimeout)
+	defer cancel()
+	cs, err := engine.ContainerList(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	held := map[int]string{}
+	for _, c := range cs {
+		if c.Labels["com.docker.compose.project"] == project {
+			continue
+		}
+		name := strings.TrimPrefix(strings.Join(c.Names, ","), "/")
+		holder := "container " + name
+		if p := c.Labels["com.docker.compose.project"]; p != "" {
+			holder += fmt.Sprintf(" (project %s, service %s)", p, c.Labels["com.docker.compose.service"])
+		}
+		for _, p := range c.Ports {
+			if p.PublicPort != 0 {
+				held[p.PublicPort] = holder
+			}
+		}
+	}
+	return held, nil
+}
+
+// ownPorts maps the host ports the project's running containers publish to their service.
+func ownPorts(project string) (map[int]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultAPITimeout)
+	defer cancel()
+	cs, err := engine.ContainerList(ctx, false, "com.docker.compose.project="+project)
+	if err != nil {
+		return nil, err
+	}
+	own := map[int]string{}
+	for _, c := range cs {
+		for _, p := range c.Ports {
+			if p.PublicPort != 0 {
+				own[p.PublicPort] = c.Labels["com.docker.compose.service"]
+			}
+		}
+	}
+	return own, nil
+}
+
+// portInUse tries to bind the port; only "address in use" counts as taken.
+func portInUse(hostIP, proto string, port int) bool {
+	addr := net.JoinHostPort(hostIP, strconv.Itoa(port))
+	if proto == "udp" {
+		c, err := net.ListenPacket("udp", addr)
+		if err == nil {
+			c.Close()
+		}
+		return errors.Is(err, syscall.EADDRINUSE)
+	}
+	l, err := net.Listen("tcp", addr)
+	if err == nil {
+		l.Close()
+	}
+	return errors.Is(err, syscall.EADDRINUSE)
+}
+
+// portState is what the pre-flight knows about the host: ports held by other
+// containers and the ones the project's own services already publish.
+type portState struct {
+	held map[int]string
+	own  map[int]string
+}
+
+func hostPorts(project string) (portState, error) {
+	held, err := portHolders(project)
+	if err != nil {
+		return portState{}, err
+	}
+	own, err := ownPorts(project)
+	return portState{held, own}, err
+}
+
+// free reports whether service may publish port: not held by another container,
+// and either already its own or bindable.
+func (st portState) free(service, hostIP, proto string, port int) bool {
+	if st.held[port] != "" {
+		return false
+	}
+	if svc, ok := st.own[port]; ok {
+		return svc == service
+	}
+	return !portInUse(hostIP, proto, port)
+}
+
+// checkPorts returns the conflicts among ports.
+func checkPorts(st portState, ports []servicePort) []portConflict {
+	var conflicts []portConflict
+	for _, p := range ports {
+		if st.free(p.Service, p.HostIP, p.Protocol, p.Published) {
+			continue
+		}
+		c := portConflict{Service: p.Service, Port: p.Published, Target: p.Target, Holder: st.held[p.Published]}
+		switch {
+		case c.Holder != "":
+		case st.own[p.Published] != "":
+			c.Holder = "service " + st.own[p.Published] + " of this project"
+		default:
+			c.Holder = "a process on the host (not a container)"
+		}
+		conflicts = append(conflicts, c)
+	}
+	return conflicts
+}
+
+// remapPorts picks the next free host port for every conflict and writes one
+// override file per affected service (ports: !override, needs Compose 2.24+).
+// Started services without conflicts lose their old override, so the compose
+// file's ports apply again.
+func remapPorts(project string, st portState, ports []servicePort, conflicts []portConflict) ([]string, error) {
+	taken := map[int]bool{}
+	bySvc := map[string][]int{}
+	for i := range conflicts {
+		c := &conflicts[i]
+		for p := c.Port + 1; p < 65536 && p <= c.Port+100; p++ {
+			if !taken[p] && st.free(c.Service, "", "tcp", p) {
+				c.RemappedTo, taken[p] = p, true
+				break
+			}
+		}
+		if c.RemappedTo == 0 {
+			return nil, fmt.Errorf("no free host port near %d for %s", c.Port, c.Service)
+		}
+		bySvc[c.Service] = append(bySvc[c.Service], i)
+	}
+
+	started := map[string]bool{}
+	for _, p := range ports {
+		started[p.Service] = true
+	}
+	var files []string
+	for svc := range started {
+		path := portOverridePath(project, svc)
+		if len(bySvc[svc]) == 0 {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return nil, err
+			}
+			continue
+		}
+		if err := writePortOverride(path, svc, ports, conflicts, bySvc[svc]); err != nil {
+			return nil, err
+		}
+		files = append(files, path)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// writePortOverride restates svc's whole ports list with the remapped host ports,
+// plus an x- extension (ignored by compose) recording what moved where.
+func writePortOverride(path, svc string, ports []servicePort, conflicts []portConflict, idx []int) error {
+	list := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!override"}
+	var remapped []map[string]any
+	for _, p := range ports {
+		if p.Service != svc {
+			continue
+		}
+		for _, i := range idx {
+			if conflicts[i].Port == p.Published {
+				remapped = append(remapped, map[string]any{"from": p.Published, "to": conflicts[i].RemappedTo})
+				p.Published = conflicts[i].RemappedTo
+			}
+		}
+		list.Content = append(list.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: p.String(), Style: yaml.DoubleQuotedStyle})
+	}
+	var meta yaml.Node
+	if err := meta.Encode(remapped); err != nil {
+		return err
+	}
+	body := &yaml.Node{Kind: yaml.MappingNode, Content: []*yaml.Node{{Kind: yaml.ScalarNode, Value: "ports"}, list}}
+	doc := &yaml.Node{Kind: yaml.MappingNode, Content: []*yaml.Node{
+		{Kind: yaml.ScalarNode, Value: "services"},
+		{Kind: yaml.MappingNode, Content: []*yaml.Node{{Kind: yaml.ScalarNode, Value: svc}, body}},
+		{Kind: yaml.ScalarNode, Value: "x-compose-db-agent-remapped"}, &meta,
+	}}
+	b, err := yaml.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	header := "# written by compose-db-agent: host ports remapped because they were taken\n"
+	return os.WriteFile(path, append([]byte(header), b...), 0o644)
+}
+
+// remappedFrom reports the compose file's original host port if the active
+// override moved service's port to port, else 0.
+func remappedFrom(project, service string, port int) int {
+	b, err := os.ReadFile(portOverridePath(project, service))
+	if err != nil {
+		return 0
+	}
+	var o struct {
+		Remapped []struct {
+			From int `yaml:"from"`
+			To   int `yaml:"to"`
+		} `yaml:"x-compose-db-agent-remapped"`
+	}
+	if yaml.Unmarshal(b, &o) != nil {
+		return 0
+	}
+	for _, r := range o.Remapped {
+		if r.To == port {
+			return r.From
+		}
+	}
+	return 0
+}
+
+// preflightPorts checks the services' published ports before `up`. With remap
+// it writes (or clears) their overrides; otherwise a conflict is an error
+// naming the holder.
+func preflightPorts(extra map[string]string, project, composeFile string, services []string, remap bool) ([]portConflict, []string, error) {
+	if dryRun {
+		return nil, nil, nil
+	}
+	ports, err := composePorts(extra, project, composeFile, services)
+	if err != nil {
+		return nil, nil, err
+	}
+	st, err := hostPorts(project)
+	if err != nil {
+		return nil, nil, err
+	}
+	conflicts := checkPorts(st, ports)
+	if !remap {
+		if len(conflicts) > 0 {
+			c := conflicts[0]
+			return conflicts, nil, fmt.Errorf("host port %d (%s) is taken by %s; stop it or allow remapping", c.Port, c.Service, c.Holder)
+		}
+		return nil, nil, nil
+	}
+	files, err := remapPorts(project, st, ports, conflicts)
+	return conflicts, files, err
+}
+
+// portRemapDefault is PORT_REMAP (default on).
+func portRemapDefault() bool { return os.Getenv("PORT_REMAP") != "0" }
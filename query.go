@@ -0,0 +1,348 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// ---------- Ad-hoc SQL (dbQuery) ----------
+
+type queryResult struct {
+	Columns   []string `json:"columns"`
+	Rows      [][]any  `json:"rows"` // values are strings or null
+	RowCount  int      `json:"row_count"`
+	Truncated bool     `json:"truncated,omitempty"`
+	Affected  *int64   `json:"rows_affected,omitempty"`
+	Mode      string   `json:"mode"`
+}
+
+// singleStatement trims a trailing ";" and rejects scripts with more than one
+// statement or with client meta-commands. Quotes, comments and Postgres $tag$
+// strings are skipped.
+func singleStatement(sql string) (string, error) {
+	s := strings.TrimSpace(sql)
+	for strings.HasSuffix(s, ";") {
+		s = strings.TrimSpace(strings.TrimSuffix(s, ";"))
+	}
+	if s == "" {
+		return "", errors.New("empty statement")
+	}
+	if clientCommand(s) {
+		return "", errors.New(`backslash outside a quoted string: psql/mysql meta-commands (\g, \!, ...) are not allowed`)
+	}
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\'' || c == '"' || c == '`':
+			for i++; i < len(s) && s[i] != c; i++ {
+				if s[i] == '\\' && c != '"' {
+					i++
+				}
+			}
+		case c == '-' && strings.HasPrefix(s[i:], "--"):
+			for i < len(s) && s[i] != '\n' {
+				i++
+			}
+		case c == '/' && strings.HasPrefix(s[i:], "/*"):
+			end := strings.Index(s[i+2:], "*/")
+			if end < 0 {
+				return "", errors.New("unterminated comment")
+			}
+			i += end + 3
+		case c == '$':
+			if end := strings.IndexByte(s[i+1:], '$'); end >= 0 {
+				tag := s[i : i+end+2]
+				if isDollarTag(tag) {
+					close := strings.Index(s[i+len(tag):], tag)
+					if close < 0 {
+						return "", errors.New("unterminated dollar-quoted string")
+					}
+					i += len(tag) + close + len(tag) - 1
+				}
+			}
+		case c == ';':
+			return "", errors.New("only a single statement is allowed")
+		}
+	}
+	return s, nil
+}
+
+// clientCommand reports a backslash outside quoted literals: psql and mysql
+// read those as meta-commands (\g sends the buffer, \! runs a shell), which
+// would escape the wrapping transaction. Quotes are scanned both with and
+// without backslash escapes, so a literal only one client sees as closed
+// can't hide one; comments and $tag$ bodies get no exemption.
+func clientCommand(s string) bool {
+	for _, escapes := range []bool{true, false} {
+		for i := 0; i < len(s); i++ {
+			switch c := s[i]; c {
+			case '\\':
+				return true
+			case '\'', '"', '`':
+				for i++; i < len(s) && s[i] != c; i++ {
+					if escapes && s[i] == '\\' {
+						i++
+					}
+				}
+				if i >= len(s) {
+					return true // unterminated in this reading
+				}
+			}
+		}
+	}
+	return false
+}
+
+func isDollarTag(t string) bool {
+	for _, r := range t[1 : len(t)-1] {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' {
+			return false
+		}
+	}
+	return true
+}
+
+// firstKeyword is the statement's leading word, lowercased (comments skipped).
+func firstKeyword(stmt string) string {
+	s := strings.TrimSpace(stmt)
+	for {
+		switch {
+		case strings.HasPrefix(s, "--"):
+			if i := strings.IndexByte(s, '\n'); i >= 0 {
+				s = strings.TrimSpace(s[i:])
+				continue
+			}
+			return ""
+		case strings.HasPrefix(s, "/*"):
+			if i := strings.Index(s, "*/"); i >= 0 {
+				s = strings.TrimSpace(s[i+2:])
+				continue
+			}
+			return ""
+		}
+		break
+	}
+	end := strings.IndexFunc(s, func(r rune) bool { return !unicode.IsLetter(r) })
+	if end < 0 {
+		end = len(s)
+	}
+	return strings.ToLower(s[:end])
+}
+
+// readOnlyKeywords may run in read mode. Together with the read-only
+// transaction this stops writes to tables, but not everything a SELECT can
+// call (see sideEffectCall).
+var readOnlyKeywords = map[string]bool{
+	"select": true, "with": true, "values": true, "table": true, "show": true,
+	"explain": true, "describe": true, "desc": true,
+}
+
+// sideEffectRe matches calls a read-only transaction doesn't stop: ending other
+// sessions, server admin, session-level locks, statements over another
+// connection (dblink), and MySQL writing server files.
+var sideEffectRe = regexp.MustCompile(`(?i)\b(pg_terminate_backend|pg_cancel_backend|pg_reload_conf|pg_rotate_logfile|pg_switch_wal|pg_create_restore_point|pg_promote|pg_(?:try_)?advisory_lock(?:_shared)?|pg_file_write|pg_file_rename|pg_file_unlink|lo_export|dblink(?:_exec|_connect|_send_query)?|get_lock)\s*\(|\binto\s+(outfile|dumpfile)\b`)
+
+// sideEffectCall returns the first side-effecting call in stmt, or "". It only
+// sees what the statement spells out: a view or function that makes such a
+// call internally still passes, so read mode is a guard against mistakes, not
+// against a hostile user with DB credentials.
+func sideEffectCall(stmt string) string {
+	m := sideEffectRe.FindStringSubmatch(sqlCode(stmt))
+	switch {
+	case m == nil:
+		return ""
+	case m[1] != "":
+		return strings.ToLower(m[1])
+	}
+	return "INTO " + strings.ToUpper(m[2])
+}
+
+// sqlCode blanks out comments and string literals and unquotes identifiers
+// ("pg_terminate_backend" and `x` are names like any other), so only the code
+// is left to match against.
+func sqlCode(s string) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\'':
+			for i++; i < len(s) && s[i] != c; i++ {
+			}
+			sb.WriteString(" '' ")
+		case c == '"' || c == '`':
+			j := strings.IndexByte(s[i+1:], c)
+			if j < 0 {
+				j = len(s) - i - 1
+			}
+			sb.WriteString(s[i+1 : i+1+j])
+			i += j + 1
+		case c == '-' && strings.HasPrefix(s[i:], "--"):
+			for i < len(s) && s[i] != '\n' {
+				i++
+			}
+			sb.WriteByte(' ')
+		case c == '/' && strings.HasPrefix(s[i:], "/*"):
+			end := strings.Index(s[i+2:], "*/")
+			if end < 0 {
+				return sb.String()
+			}
+			i += end + 3
+			sb.WriteByte(' ')
+		case c == '$':
+			if end := strings.IndexByte(s[i+1:], '$'); end >= 0 && isDollarTag(s[i:i+end+2]) {
+				tag := s[i : i+end+2]
+				close := strings.Index(s[i+len(tag):], tag)
+				if close < 0 {
+					return sb.String()
+				}
+				i += len(tag) + close + len(tag) - 1
+				sb.WriteString(" '' ")
+				continue
+			}
+			sb.WriteByte(c)
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return sb.String()
+}
+
+// rowCountMarker is echoed after the statement so the row count can be split off.
+const rowCountMarker = "__compose_db_agent_rows"
+
+// queryScript wraps stmt in a transaction (read-only unless write) with the
+// statement timeout and row limit. The ";" after stmt goes on its own line in
+// case stmt ends in a -- comment.
+func queryScript(c dbCreds, stmt string, write bool, limit int, timeout time.Duration, mariadb bool) string {
+	ms := timeout.Milliseconds()
+	var sb strings.Builder
+	if c.Kind == "mysql" {
+		if mariadb {
+			fmt.Fprintf(&sb, "SET SESSION max_statement_time = %.3f;\n", timeout.Seconds())
+		} else {
+			fmt.Fprintf(&sb, "SET SESSION max_execution_time = %d;\n", ms)
+		}
+		if write {
+			fmt.Fprintf(&sb, "START TRANSACTION;\n%s\n;\nSELECT ROW_COUNT() AS %s;\nCOMMIT;\n", stmt, rowCountMarker)
+		} else {
+			fmt.Fprintf(&sb, "SET SESSION sql_select_limit = %d;\nSTART TRANSACTION READ ONLY;\n%s\n;\nROLLBACK;\n", limit+1, stmt)
+		}
+		return sb.String()
+	}
+
+	if write {
+		fmt.Fprintf(&sb, "BEGIN;\nSET LOCAL statement_timeout = %d;\n%s\n;\n\\echo %s :ROW_COUNT\nCOMMIT;\n", ms, stmt, rowCountMarker)
+		return sb.String()
+	}
+	fmt.Fprintf(&sb, "BEGIN TRANSACTION READ ONLY;\nSET LOCAL statement_timeout = %d;\n", ms)
+	switch firstKeyword(stmt) {
+	case "select", "with", "values", "table":
+		// a cursor stops the server from producing more than limit+1 rows
+		fmt.Fprintf(&sb, "DECLARE q NO SCROLL CURSOR FOR %s\n;\nFETCH %d FROM q;\n", stmt, limit+1)
+	default:
+		fmt.Fprintf(&sb, "%s\n;\n", stmt)
+	}
+	sb.WriteString("ROLLBACK;\n")
+	return sb.String()
+}
+
+func queryCommand(c dbCreds) []string {
+	if c.Kind == "mysql" {
+		return []string{"mysql", "-u", c.User, "-B", c.Database}
+	}
+	return []string{"psql", "-U", c.User, "-d", c.Database, "-X", "-q", "--csv", "-P", `null=\N`, "-v", "ON_ERROR_STOP=1"}
+}
+
+// isMariaDB asks the server, since max_execution_time only exists on MySQL.
+func isMariaDB(t dbTarget, c dbCreds) bool {
+	out, err := runSQL(t, c, "SELECT VERSION();")
+	return err == nil && strings.Contains(strings.ToLower(out), "mariadb")
+}
+
+func runQuery(t dbTarget, c dbCreds, stmt string, write bool, limit int, timeout time.Duration) (*queryResult, error) {
+	mariadb := c.Kind == "mysql" && isMariaDB(t, c)
+	script := queryScript(c, stmt, write, limit, timeout, mariadb)
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout+30*time.Second)
+	defer cancel()
+	var out bytes.Buffer
+	if err := streamComposeContext(ctx, execEnv(c), strings.NewReader(script), &out, execArgs(t, c, queryCommand(c)...)...); err != nil {
+		return nil, err
+	}
+
+	var records [][]string
+	var err error
+	if c.Kind == "mysql" {
+		records = parseMySQLBatch(out.String())
+	} else {
+		records, err = parsePsqlCSV(out.String())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	res := &queryResult{Mode: "read", Columns: []string{}, Rows: [][]any{}}
+	if write {
+		res.Mode = "write"
+	}
+	// split off the affected-rows marker: psql echoes "marker N", mysql returns it as a result set
+	if n := len(records); n > 0 {
+		last := records[n-1]
+		if len(last) == 1 && strings.HasPrefix(last[0], rowCountMarker+" ") {
+			v, _ := strconv.ParseInt(strings.TrimPrefix(last[0], rowCountMarker+" "), 10, 64)
+			res.Affected, records = &v, records[:n-1]
+		} else if n >= 2 && len(records[n-2]) == 1 && records[n-2][0] == rowCountMarker {
+			v, _ := strconv.ParseInt(last[0], 10, 64)
+			res.Affected, records = &v, records[:n-2]
+		}
+	}
+	if len(records) == 0 {
+		return res, nil
+	}
+
+	res.Columns = records[0]
+	for _, rec := range records[1:] {
+		if !write && len(res.Rows) == limit {
+			res.Truncated = true
+			break
+		}
+		row := make([]any, len(rec))
+		for i, v := range rec {
+			if (c.Kind == "mysql" && v == "NULL") || (c.Kind == "postgres" && v == `\N`) {
+				row[i] = nil
+			} else {
+				row[i] = v
+			}
+		}
+		res.Rows = append(res.Rows, row)
+	}
+	res.RowCount = len(res.Rows)
+	return res, nil
+}
+
+// parsePsqlCSV reads psql --csv output; the affected-rows echo is a one-field record.
+func parsePsqlCSV(out string) ([][]string, error) {
+	r := csv.NewReader(strings.NewReader(out))
+	r.FieldsPerRecord = -1
+	return r.ReadAll()
+}
+
+// parseMySQLBatch reads mysql -B output (tab-separated, \t \n \\ \0 escaped).
+func parseMySQLBatch(out string) [][]string {
+	unescape := strings.NewReplacer(`\t`, "\t", `\n`, "\n", `\\`, `\`, `\0`, "\x00")
+	var recs [][]string
+	for _, line := range sqlLines(out) {
+		fields := strings.Split(line, "\t")
+		for i, f := range fields {
+			fields[i] = unescape.Replace(f)
+		}
+		recs = append(recs, fields)
+	}
+	return recs
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSingleStatement(t *testing.T) {
+	tests := []struct {
+		sql, want, wantErr string
+	}{
+		{"SELECT 1;", "SELECT 1", ""},
+		{"  SELECT 1 ;; ", "SELECT 1", ""},
+		{"SELECT ';' AS semi", "SELECT ';' AS semi", ""},
+		{`SELECT ";" FROM t`, `SELECT ";" FROM t`, ""},
+		{"SELECT 1 -- trailing; comment", "SELECT 1 -- trailing; comment", ""},
+		{"SELECT /* ; */ 1", "SELECT /* ; */ 1", ""},
+		{"SELECT $$a;b$$", "SELECT $$a;b$$", ""},
+		{"SELECT $fn$ ; $fn$", "SELECT $fn$ ; $fn$", ""},
+		{"", "", "empty statement"},
+		{" ; ", "", "empty statement"},
+		{"SELECT 1; DROP TABLE users", "", "single statement"},
+		{"SELECT 1; -- x\nDELETE FROM t", "", "single statement"},
+		{"SELECT /* unterminated", "", "unterminated comment"},
+		{"SELECT $x$ never closed", "", "unterminated dollar-quoted"},
+
+		// client meta-commands, anywhere a client would read them
+		{`SELECT 1 \g`, "", "meta-commands"},
+		{`SELECT 1 \! rm -rf /`, "", "meta-commands"},
+		{"SELECT 1 -- \\! id", "", "meta-commands"},
+		{"SELECT $$ \\! id $$", "", "meta-commands"},
+		// a quote only one client reads as closed can't hide one
+		{`SELECT 'a\' \! id --'`, "", "meta-commands"},
+		{`SELECT 'it''s'`, `SELECT 'it''s'`, ""},
+	}
+	for _, tt := range tests {
+		got, err := singleStatement(tt.sql)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("singleStatement(%q) = %q, %v; want error %q", tt.sql, got, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("singleStatement(%q) = %q, %v; want %q", tt.sql, got, err, tt.want)
+		}
+	}
+}
+
+func TestSQLCheckQueryReadOnly(t *testing.T) {
+	tests := []struct {
+		sql      string
+		readOnly bool
+	}{
+		{"SELECT * FROM users", true},
+		{"  -- why\nWITH x AS (SELECT 1) SELECT * FROM x", true},
+		{"/* c */ explain select 1", true},
+		{"SHOW TABLES", true},
+		{"TABLE users", true},
+		{"SELECT 'pg_terminate_backend(1)' AS s", true},
+		{"SELECT pg_terminate_backend_count FROM stats", true},
+		{"SELECT 1 -- pg_reload_conf()", true},
+		{"INSERT INTO t VALUES (1)", false},
+		{"UPDATE t SET a = 1", false},
+		{"DELETE FROM t", false},
+		{"CREATE TABLE t (a int)", false},
+		{"COPY t TO '/tmp/x'", false},
+		{"SET ROLE postgres", false},
+
+		// side effects a read-only transaction doesn't stop
+		{"SELECT pg_terminate_backend(pid) FROM pg_stat_activity", false},
+		{"SELECT PG_CANCEL_BACKEND (42)", false},
+		{"SELECT pg_catalog.pg_reload_conf()", false},
+		{`SELECT "pg_terminate_backend"(42)`, false},
+		{"SELECT pg_terminate_backend/* x */(42)", false},
+		{"SELECT pg_advisory_lock(1)", false},
+		{"SELECT pg_try_advisory_lock_shared(1)", false},
+		{"SELECT * FROM dblink('dbname=x', 'DROP TABLE t') AS r(a text)", false},
+		{"SELECT dblink_exec('DROP TABLE t')", false},
+		{"SELECT * FROM users INTO OUTFILE '/tmp/users.csv'", false},
+		{"SELECT 'x' INTO\n  DUMPFILE '/tmp/x'", false},
+		{"SELECT GET_LOCK('a', 10)", false},
+	}
+	var d sqlDriver
+	for _, tt := range tests {
+		_, readOnly, err := d.CheckQuery(tt.sql)
+		if err != nil {
+			t.Errorf("CheckQuery(%q): %v", tt.sql, err)
+			continue
+		}
+		if readOnly != tt.readOnly {
+			t.Errorf("CheckQuery(%q) readOnly = %v, want %v (side effect %q)", tt.sql, readOnly, tt.readOnly, sideEffectCall(tt.sql))
+		}
+	}
+}
+
+func TestSideEffectCall(t *testing.T) {
+	tests := map[string]string{
+		"SELECT pg_terminate_backend(1)":        "pg_terminate_backend",
+		"select PG_RELOAD_CONF()":               "pg_reload_conf",
+		"SELECT a FROM t INTO OUTFILE '/tmp/a'": "INTO OUTFILE",
+		"SELECT 'pg_reload_conf()'":             "",
+		"SELECT $$pg_reload_conf()$$":           "",
+		"SELECT $q$ pg_reload_conf() $q$":       "",
+		"SELECT 1 /* pg_reload_conf() */":       "",
+		"SELECT outfile FROM t":                 "",
+	}
+	for sql, want := range tests {
+		if got := sideEffectCall(sql); got != want {
+			t.Errorf("sideEffectCall(%q) = %q, want %q", sql, got, want)
+		}
+	}
+}
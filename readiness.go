@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ---------- Readiness probes (for services without a healthcheck) ----------
+
+// readyProbe says how to tell a container is ready:
+//
+//	healthcheck  Docker's own HEALTHCHECK (the default when the container has one)
+//	exec         the engine's probe inside the container (pg_isready, mysqladmin ping, ...)
+//	tcp[:port]   connect to the published host port (first published one by default)
+//	log:<regex>  a line in the container's logs matches
+//	none         don't wait; report no-healthcheck
+type readyProbe struct {
+	Kind    string
+	Port    int            // tcp: container port, 0 = first published
+	Pattern *regexp.Regexp // log
+}
+
+func parseProbe(spec string) (readyProbe, error) {
+	kind, arg, _ := strings.Cut(strings.TrimSpace(spec), ":")
+	p := readyProbe{Kind: kind}
+	switch kind {
+	case "", "auto", "healthcheck", "exec", "none":
+		if arg != "" {
+			return p, fmt.Errorf("probe %q takes no argument", kind)
+		}
+	case "tcp":
+		if arg != "" {
+			n, err := strconv.Atoi(arg)
+			if err != nil || n <= 0 || n > 65535 {
+				return p, fmt.Errorf("invalid tcp probe port %q", arg)
+			}
+			p.Port = n
+		}
+	case "log":
+		if arg == "" {
+			return p, errors.New("log probe needs a pattern (log:<regex>)")
+		}
+		re, err := regexp.Compile(arg)
+		if err != nil {
+			return p, fmt.Errorf("invalid log probe pattern: %w", err)
+		}
+		p.Pattern = re
+	default:
+		return p, fmt.Errorf("unknown probe %q (auto|healthcheck|exec|tcp[:port]|log:<regex>|none)", spec)
+	}
+	if p.Kind == "" {
+		p.Kind = "auto"
+	}
+	return p, nil
+}
+
+// probeEnv is READY_PROBE_<SERVICE>, e.g. READY_PROBE_DB or READY_PROBE_SEARCH_API.
+func probeEnv(service string) string {
+	var b strings.Builder
+	for _, r := range strings.ToUpper(service) {
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		} else {
+			b.WriteByte('_')
+		}
+	}
+	return "READY_PROBE_" + b.String()
+}
+
+// resolveProbe picks the probe for a container: the explicit spec, else its
+// READY_PROBE_<SERVICE>, else auto (healthcheck, engine probe, TCP, none).
+func resolveProbe(spec string, info *containerJSON) (readyProbe, error) {
+	service := info.Config.Labels["com.docker.compose.service"]
+	if spec == "" && service != "" {
+		spec = os.Getenv(probeEnv(service))
+	}
+	p, err := parseProbe(spec)
+	if err != nil || p.Kind != "auto" {
+		return p, err
+	}
+	switch {
+	case info.State.Health != nil:
+		p.Kind = "healthcheck"
+	case engineOf(info) != "":
+		p.Kind = "exec"
+	case len(publishedPorts(info)) > 0:
+		p.Kind = "tcp"
+	default:
+		p.Kind = "none"
+	}
+	return p, nil
+}
+
+// engineOf is the container's DB engine (DB_ENGINE applies to DB_SERVICE only), or "".
+func engineOf(info *containerJSON) string {
+	if e := os.Getenv("DB_ENGINE"); e != "" && info.Config.Labels["com.docker.compose.service"] == os.Getenv("DB_SERVICE") {
+		kind, _ := normalizeDBKind(e)
+		return kind
+	}
+	kind, _ := normalizeDBKind(info.Config.Image)
+	return kind
+}
+
+// publishedPorts maps container ports to host addresses, sorted by container port.
+func publishedPorts(info *containerJSON) [][2]string {
+	var out [][2]string
+	for cport, binds := range info.NetworkSettings.Ports {
+		for _, b := range binds {
+			if b.HostPort == "" {
+				continue
+			}
+			ip := b.HostIP
+			if ip == "" || ip == "0.0.0.0" || ip == "::" {
+				ip = "127.0.0.1"
+			}
+			out = append(out, [2]string{cport, net.JoinHostPort(ip, b.HostPort)})
+			break
+		}
+	}
+	sort.Slice(out, func(i, k int) bool {
+		pi, _ := strconv.Atoi(strings.Split(out[i][0], "/")[0])
+		pk, _ := strconv.Atoi(strings.Split(out[k][0], "/")[0])
+		return pi < pk
+	})
+	return out
+}
+
+// probeOnce runs a non-healthcheck probe; out is what to show when it fails.
+func probeOnce(ctx context.Context, p readyProbe, info *containerJSON) (ok bool, out string) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	switch p.Kind {
+	case "tcp":
+		// weakest signal: with Docker's userland proxy the host port accepts early
+		addr := ""
+		for _, pp := range publishedPorts(info) {
+			if p.Port == 0 || pp[0] == strconv.Itoa(p.Port)+"/tcp" {
+				addr = pp[1]
+				break
+			}
+		}
+		if addr == "" {
+			return false, "no published port to probe"
+		}
+		conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return false, err.Error()
+		}
+		conn.Close()
+		return true, "connected to " + addr
+	case "exec":
+		kind := engineOf(info)
+		if kind == "" {
+			return false, "no engine probe for image " + info.Config.Image
+		}
+		// the container's own env has the official images' credentials
+		env := readDotenv(os.Getenv("APP_ENV_FILE"))
+		for _, kv := range info.Config.Env {
+			if k, v, ok := strings.Cut(kv, "="); ok {
+				env[k] = v
+			}
+		}
+		d := driverFor(kind)
+		c := d.Creds(env)
+		stdout, stderr, code, err := engine.ContainerExec(ctx, info.ID, d.ReadyCommand(c), []string{d.PasswordEnv() + "=" + c.Password})
+		if err != nil {
+			return false, err.Error()
+		}
+		out := strings.TrimSpace(stdout + stderr)
+		return code == 0, out
+	case "log":
+		logs, err := engine.ContainerLogs(ctx, info.ID, 500)
+		if err != nil {
+			return false, err.Error()
+		}
+		for _, l := range strings.Split(logs, "\n") {
+			if p.Pattern.MatchString(l) {
+				return true, strings.TrimSpace(l)
+			}
+		}
+		return false, "no log line matches " + p.Pattern.String()
+	}
+	return false, "unknown probe " + p.Kind
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ---------- REPL sessions ----------
+
+// replSession is a saved conversation; the REPL autosaves it after every turn.
+type replSession struct {
+	ID       string    `json:"id"`
+	Profile  string    `json:"profile,omitempty"`
+	Project  string    `json:"project"`
+	Created  time.Time `json:"created"`
+	Updated  time.Time `json:"updated"`
+	Messages []Msg     `json:"messages"`
+}
+
+var sessionIDRe = regexp.MustCompile(`^[a-zA-Z0-9_-][a-zA-Z0-9._-]*$`)
+
+// sessionDir is SESSION_DIR (default .sessions).
+func sessionDir() string {
+	if d := os.Getenv("SESSION_DIR"); d != "" {
+		return d
+	}
+	return ".sessions"
+}
+
+func sessionPath(id string) string { return filepath.Join(sessionDir(), id+".json") }
+
+func (s *replSession) save() error {
+	if err := os.MkdirAll(sessionDir(), 0o700); err != nil {
+		return err
+	}
+	s.Updated = time.Now().UTC()
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(sessionPath(s.ID), b, 0o600) // conversations can contain data and credentials
+}
+
+func loadSession(id string) (*replSession, error) {
+	if !sessionIDRe.MatchString(id) {
+		return nil, fmt.Errorf("invalid session id %q", id)
+	}
+	b, err := os.ReadFile(sessionPath(id))
+	if err != nil {
+		return nil, err
+	}
+	var s replSession
+	return &s, json.Unmarshal(b, &s)
+}
+
+// listSessions returns the saved sessions, newest first.
+func listSessions() ([]replSession, error) {
+	files, err := filepath.Glob(filepath.Join(sessionDir(), "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var out []replSession
+	for _, f := range files {
+		s, err := loadSession(strings.TrimSuffix(filepath.Base(f), ".json"))
+		if err != nil {
+			continue
+		}
+		out = append(out, *s)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Updated.After(out[j].Updated) })
+	return out, nil
+}
+
+// ---------- REPL ----------
+
+const replHelp = `Type a request, or:
+  /tools              list the tools the model can call
+  /profile [name]     show the active profile, or switch to another one
+  /history            show this session's conversation
+  /clear              start over (new session)
+  /save [id]          save the session (under a new id if given)
+  /sessions           list saved sessions
+  /resume <id>        continue a saved session
+  /exit               quit (Ctrl-D works too)`
+
+// runREPL keeps one conversation across prompts. resume is a session id or "".
+// Without a provider, each line goes through the offline parser (no history).
+func runREPL(llm llmProvider, resume string) int {
+	sess := &replSession{ID: time.Now().UTC().Format("20060102-150405"), Created: time.Now().UTC()}
+	if resume != "" {
+		s, err := resumeSession(resume)
+		if err != nil {
+			fmt.Println("Error:", err)
+			return 1
+		}
+		sess = s
+	}
+	history := ""
+	if home, err := os.UserHomeDir(); err == nil {
+		history = filepath.Join(home, ".compose_db_agent_history")
+	}
+	ed := newLineEditor(history)
+	fmt.Println("Session " + sess.ID + " for " + currentProject() + ". /help for commands.")
+
+	for {
+		line, err := ed.readLine(currentProject() + "> ")
+		if errors.Is(err, errInterrupt) {
+			continue
+		}
+		if err == io.EOF {
+			return 0
+		}
+		if err != nil {
+			fmt.Println("Error:", err)
+			return 1
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		ed.addHistory(line)
+
+		if strings.HasPrefix(line, "/") {
+			if replCommand(line, &sess) {
+				return 0
+			}
+			continue
+		}
+		if llm == nil {
+			runOffline(line)
+			continue
+		}
+
+		msgs := append(sess.Messages, Msg{Role: "user", Content: []ContentBlock{{Type: "text", Text: line}}})
+		out, err := runAgent(llm, msgs, printToolCall, printText)
+		if err != nil {
+			// keep the conversation valid: drop the unanswered turn
+			fmt.Println(llm.Name()+" error:", err)
+			continue
+		}
+		sess.Messages = out
+		sess.Profile, sess.Project = activeProfile, currentProject()
+		if err := sess.save(); err != nil {
+			fmt.Println("warning: session not saved:", err)
+		}
+	}
+}
+
+// resumeSession loads a saved session and switches to the profile it was using.
+func resumeSession(id string) (*replSession, error) {
+	s, err := loadSession(id)
+	if err != nil {
+		return nil, err
+	}
+	if s.Profile != "" && s.Profile != activeProfile {
+		if err := loadProfile(s.Profile); err != nil {
+			return nil, err
+		}
+	}
+	fmt.Printf("Resumed session %s (%d messages).\n", s.ID, len(s.Messages))
+	return s, nil
+}
+
+// printToolCall shows a tool call as it happens: name, arguments and the first line of the result.
+func printToolCall(name string, args map[string]any, out string, isErr bool) {
+	b, _ := json.Marshal(args)
+	status := "ok"
+	if isErr {
+		status = "error"
+	}
+	first, _, _ := strings.Cut(out, "\n")
+	if len(first) > 160 {
+		first = first[:160] + "…"
+	}
+	fmt.Printf("  → %s %s\n  ← %s: %s\n", name, b, status, first)
+}
+
+// replCommand handles a slash command; it reports whether the REPL should exit.
+func replCommand(line string, sess **replSession) bool {
+	cmd, arg, _ := strings.Cut(line, " ")
+	arg = strings.TrimSpace(arg)
+	s := *sess
+	switch cmd {
+	case "/exit", "/quit":
+		return true
+	case "/help":
+		fmt.Println(replHelp)
+	case "/tools":
+		decls := toolDecls()
+		sort.Slice(decls, func(i, j int) bool { return decls[i].Name < decls[j].Name })
+		for _, d := range decls {
+			desc, _, _ := strings.Cut(d.Description, ". ")
+			fmt.Printf("  %-18s %s\n", d.Name, desc)
+		}
+	case "/profile":
+		if arg != "" {
+			if err := loadProfile(arg); err != nil {
+				fmt.Println("Error:", err)
+				break
+			}
+		}
+		switch {
+		case activeConfig == nil:
+			fmt.Println("No config file; settings come from the environment.")
+		case activeProfile == "":
+			fmt.Printf("No profile active (%s has: %s).\n", activeConfig.Path, strings.Join(activeConfig.profileNames(), ", "))
+		default:
+			fmt.Printf("Profile %s from %s (project %s; available: %s).\n", activeProfile, activeConfig.Path, currentProject(), strings.Join(activeConfig.profileNames(), ", "))
+		}
+	case "/history":
+		for _, m := range s.Messages {
+			for _, b := range m.Content {
+				switch b.Type {
+				case "text":
+					fmt.Printf("%s: %s\n", m.Role, b.Text)
+				case "tool_use":
+					fmt.Printf("%s: → %s %s\n", m.Role, b.Name, b.Input)
+				case "tool_result":
+					first, _, _ := strings.Cut(b.Content, "\n")
+					fmt.Printf("%s: ← %s\n", m.Role, first)
+				}
+			}
+		}
+	case "/clear":
+		*sess = &replSession{ID: time.Now().UTC().Format("20060102-150405"), Created: time.Now().UTC()}
+		fmt.Println("New session " + (*sess).ID + ".")
+	case "/save":
+		if arg != "" {
+			if !sessionIDRe.MatchString(arg) {
+				fmt.Printf("Error: invalid session id %q\n", arg)
+				break
+			}
+			s.ID = arg
+		}
+		s.Profile, s.Project = activeProfile, currentProject()
+		if err := s.save(); err != nil {
+			fmt.Println("Error:", err)
+			break
+		}
+		fmt.Println("Saved " + sessionPath(s.ID) + ".")
+	case "/sessions":
+		list, err := listSessions()
+		if err != nil {
+			fmt.Println("Error:", err)
+			break
+		}
+		for _, l := range list {
+			fmt.Printf("  %-24s %-16s %3d messages  %s\n", l.ID, l.Project, len(l.Messages), l.Updated.Local().Format("2006-01-02 15:04"))
+		}
+	case "/resume":
+		r, err := resumeSession(arg)
+		if err != nil {
+			fmt.Println("Error:", err)
+			break
+		}
+		*sess = r
+	default:
+		fmt.Println("Unknown command " + cmd + ". /help lists them.")
+	}
+	return false
+}
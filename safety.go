@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// ---------- Safety snapshots before destructive tools ----------
+
+// autoSnapshotKeep is how many safety snapshots to keep per project (SNAPSHOT_KEEP, default 5).
+func autoSnapshotKeep() int {
+	if n, err := strconv.Atoi(os.Getenv("SNAPSHOT_KEEP")); err == nil && n > 0 {
+		return n
+	}
+	return 5
+}
+
+// safetySnapshot archives the DB volume before tool destroys it. It returns nil
+// (and no error) when disabled via AUTO_SNAPSHOT=0, in DRY_RUN, or when there is
+// no volume yet, i.e. nothing to lose. Any other failure must abort the tool.
+// Snapshots named in pinned (e.g. the one about to be restored) survive pruning.
+func safetySnapshot(t dbTarget, tool string, pinned ...string) (*snapshotMeta, error) {
+	if dryRun || os.Getenv("AUTO_SNAPSHOT") == "0" || t.Volume == "" {
+		return nil, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), defaultAPITimeout)
+	defer cancel()
+	if _, err := engine.VolumeInspect(ctx, dbVolumeName(t.Project, t.Volume)); isNotFound(err) {
+		return nil, nil
+	}
+
+	name := "auto-" + time.Now().UTC().Format("20060102-150405.000")
+	meta, err := takeSnapshot(t, name, "before "+tool, true)
+	if err != nil {
+		return nil, fmt.Errorf("safety snapshot failed, not running %s (set AUTO_SNAPSHOT=0 to skip): %w", tool, err)
+	}
+	pruneAutoSnapshots(t.Project, autoSnapshotKeep(), pinned...)
+	return meta, nil
+}
+
+// pruneAutoSnapshots deletes all but the newest keep safety snapshots; manual ones stay.
+func pruneAutoSnapshots(project string, keep int, pinned ...string) {
+	all, err := listSnapshots(project)
+	if err != nil {
+		return
+	}
+	n := 0
+	for _, m := range all {
+		if !m.Auto || contains(pinned, m.Name) {
+			continue
+		}
+		if n++; n > keep {
+			tarPath, metaPath := snapshotPaths(project, m.Name)
+			os.Remove(tarPath)
+			os.Remove(metaPath)
+		}
+	}
+}
+
+// lastUndoable is the newest safety snapshot that undo can go back to. Snapshots
+// taken by undo itself are skipped, so repeated undos don't just flip back and forth.
+func lastUndoable(project string) (*snapshotMeta, error) {
+	all, err := listSnapshots(project)
+	if err != nil {
+		return nil, err
+	}
+	for i := range all {
+		if all[i].Auto && all[i].Reason != "before undo" {
+			return &all[i], nil
+		}
+	}
+	return nil, fmt.Errorf("no safety snapshot to undo to for project %q", project)
+}
+
+// snapName is the snapshot's name, or "" when none was taken (for tool output).
+func snapName(m *snapshotMeta) string {
+	if m == nil {
+		return ""
+	}
+	return m.Name
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ---------- Schema introspection (tables, columns, indexes, constraints, FKs) ----------
+
+type dbSchema struct {
+	Engine   string        `json:"engine"`
+	Database string        `json:"database"`
+	Tables   []schemaTable `json:"tables"`
+}
+
+type schemaTable struct {
+	Schema      string             `json:"schema"`
+	Name        string             `json:"name"`
+	Columns     []schemaColumn     `json:"columns"`
+	Indexes     []schemaIndex      `json:"indexes,omitempty"`
+	Constraints []schemaConstraint `json:"constraints,omitempty"`
+	ForeignKeys []schemaForeignKey `json:"foreign_keys,omitempty"`
+}
+
+type schemaColumn struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Nullable bool   `json:"nullable"`
+	Default  string `json:"default,omitempty"`
+}
+
+type schemaIndex struct {
+	Name       string   `json:"name"`
+	Columns    []string `json:"columns"`
+	Unique     bool     `json:"unique,omitempty"`
+	Primary    bool     `json:"primary,omitempty"`
+	Definition string   `json:"definition,omitempty"`
+}
+
+type schemaConstraint struct {
+	Name       string   `json:"name"`
+	Type       string   `json:"type"` // PRIMARY KEY | UNIQUE | CHECK | EXCLUDE
+	Columns    []string `json:"columns,omitempty"`
+	Definition string   `json:"definition,omitempty"`
+}
+
+type schemaForeignKey struct {
+	Name       string   `json:"name"`
+	Columns    []string `json:"columns"`
+	RefTable   string   `json:"references_table"`
+	RefColumns []string `json:"references_columns"`
+}
+
+// Every row starts with a tag (C column, I index, K constraint) so one script
+// can return all three result sets through the tab-separated client output.
+const pgSchemaSQL = `
+SELECT 'C', n.nspname, c.relname, a.attname, format_type(a.atttypid, a.atttypmod),
+       CASE WHEN a.attnotnull THEN 'NO' ELSE 'YES' END,
+       coalesce(replace(pg_get_expr(d.adbin, d.adrelid), E'\n', ' '), '')
+FROM pg_attribute a
+JOIN pg_class c ON c.oid = a.attrelid
+JOIN pg_namespace n ON n.oid = c.relnamespace
+LEFT JOIN pg_attrdef d ON d.adrelid = a.attrelid AND d.adnum = a.attnum
+WHERE c.relkind IN ('r', 'p') AND a.attnum > 0 AND NOT a.attisdropped
+  AND n.nspname NOT IN ('pg_catalog', 'information_schema') AND n.nspname NOT LIKE 'pg_toast%'
+ORDER BY n.nspname, c.relname, a.attnum;
+
+SELECT 'I', n.nspname, c.relname, i.relname,
+       CASE WHEN ix.indisunique THEN 't' ELSE 'f' END,
+       CASE WHEN ix.indisprimary THEN 't' ELSE 'f' END,
+       array_to_string(ARRAY(SELECT pg_get_indexdef(ix.indexrelid, k + 1, true)
+                             FROM generate_subscripts(ix.indkey, 1) k ORDER BY k), ','),
+       pg_get_indexdef(ix.indexrelid)
+FROM pg_index ix
+JOIN pg_class i ON i.oid = ix.indexrelid
+JOIN pg_class c ON c.oid = ix.indrelid
+JOIN pg_namespace n ON n.oid = c.relnamespace
+WHERE n.nspname NOT IN ('pg_catalog', 'information_schema') AND n.nspname NOT LIKE 'pg_toast%'
+ORDER BY n.nspname, c.relname, i.relname;
+
+SELECT 'K', n.nspname, c.relname, co.conname, co.contype,
+       replace(pg_get_constraintdef(co.oid), E'\n', ' '),
+       coalesce(fn.nspname || '.' || f.relname, ''),
+       array_to_string(ARRAY(SELECT a.attname FROM unnest(co.conkey) WITH ORDINALITY k(num, ord)
+                             JOIN pg_attribute a ON a.attrelid = co.conrelid AND a.attnum = k.num ORDER BY k.ord), ','),
+       array_to_string(ARRAY(SELECT a.attname FROM unnest(co.confkey) WITH ORDINALITY k(num, ord)
+                             JOIN pg_attribute a ON a.attrelid = co.confrelid AND a.attnum = k.num ORDER BY k.ord), ',')
+FROM pg_constraint co
+JOIN pg_class c ON c.oid = co.conrelid
+JOIN pg_namespace n ON n.oid = c.relnamespace
+LEFT JOIN pg_class f ON f.oid = co.confrelid
+LEFT JOIN pg_namespace fn ON fn.oid = f.relnamespace
+WHERE n.nspname NOT IN ('pg_catalog', 'information_schema')
+ORDER BY n.nspname, c.relname, co.conname;
+`
+
+const mysqlSchemaSQL = `
+SELECT 'C', c.TABLE_SCHEMA, c.TABLE_NAME, c.COLUMN_NAME, c.COLUMN_TYPE, c.IS_NULLABLE, COALESCE(c.COLUMN_DEFAULT, '')
+FROM information_schema.COLUMNS c
+JOIN information_schema.TABLES t ON t.TABLE_SCHEMA = c.TABLE_SCHEMA AND t.TABLE_NAME = c.TABLE_NAME
+WHERE c.TABLE_SCHEMA = DATABASE() AND t.TABLE_TYPE = 'BASE TABLE'
+ORDER BY c.TABLE_NAME, c.ORDINAL_POSITION;
+
+SELECT 'I', TABLE_SCHEMA, TABLE_NAME, INDEX_NAME,
+       IF(NON_UNIQUE = 0, 't', 'f'), IF(INDEX_NAME = 'PRIMARY', 't', 'f'),
+       COALESCE(GROUP_CONCAT(COLUMN_NAME ORDER BY SEQ_IN_INDEX), ''), ''
+FROM information_schema.STATISTICS
+WHERE TABLE_SCHEMA = DATABASE()
+GROUP BY TABLE_SCHEMA, TABLE_NAME, INDEX_NAME, NON_UNIQUE
+ORDER BY TABLE_NAME, INDEX_NAME;
+
+SELECT 'K', tc.TABLE_SCHEMA, tc.TABLE_NAME, tc.CONSTRAINT_NAME, tc.CONSTRAINT_TYPE, '',
+       COALESCE(IF(MAX(k.REFERENCED_TABLE_SCHEMA) = tc.TABLE_SCHEMA, MAX(k.REFERENCED_TABLE_NAME),
+                   CONCAT(MAX(k.REFERENCED_TABLE_SCHEMA), '.', MAX(k.REFERENCED_TABLE_NAME))), ''),
+       COALESCE(GROUP_CONCAT(k.COLUMN_NAME ORDER BY k.ORDINAL_POSITION), ''),
+       COALESCE(GROUP_CONCAT(k.REFERENCED_COLUMN_NAME ORDER BY k.ORDINAL_POSITION), '')
+FROM information_schema.TABLE_CONSTRAINTS tc
+LEFT JOIN information_schema.KEY_COLUMN_USAGE k
+  ON k.CONSTRAINT_SCHEMA = tc.CONSTRAINT_SCHEMA AND k.TABLE_NAME = tc.TABLE_NAME AND k.CONSTRAINT_NAME = tc.CONSTRAINT_NAME
+WHERE tc.TABLE_SCHEMA = DATABASE()
+GROUP BY tc.TABLE_SCHEMA, tc.TABLE_NAME, tc.CONSTRAINT_NAME, tc.CONSTRAINT_TYPE
+ORDER BY tc.TABLE_NAME, tc.CONSTRAINT_NAME;
+`
+
+var pgConstraintTypes = map[string]string{"p": "PRIMARY KEY", "u": "UNIQUE", "f": "FOREIGN KEY", "c": "CHECK", "x": "EXCLUDE"}
+
+// introspectSchema reads the live schema of the DB. tables, if given, limits the
+// result to those names ("name" or "schema.name").
+func introspectSchema(t dbTarget, c dbCreds, tables []string) (*dbSchema, error) {
+	return readSchema(func(script string) (string, error) { return runSQL(t, c, script) }, c, tables)
+}
+
+// readSchema runs the catalog script through runScript (tab-separated client output).
+func readSchema(runScript func(string) (string, error), c dbCreds, tables []string) (*dbSchema, error) {
+	script := pgSchemaSQL
+	if c.Kind == "mysql" {
+		script = mysqlSchemaSQL
+	}
+	out, err := runScript(script)
+	if err != nil {
+		return nil, err
+	}
+	s, err := parseSchemaRows(c, sqlLines(out))
+	if err != nil {
+		return nil, err
+	}
+	if len(tables) > 0 {
+		kept := s.Tables[:0]
+		for _, tb := range s.Tables {
+			if contains(tables, tb.Name) || contains(tables, tb.Schema+"."+tb.Name) {
+				kept = append(kept, tb)
+			}
+		}
+		s.Tables = kept
+	}
+	return s, nil
+}
+
+func parseSchemaRows(c dbCreds, rows []string) (*dbSchema, error) {
+	byName := map[string]*schemaTable{}
+	var order []string
+	table := func(schema, name string) *schemaTable {
+		key := schema + "." + name
+		tb := byName[key]
+		if tb == nil {
+			tb = &schemaTable{Schema: schema, Name: name, Columns: []schemaColumn{}}
+			byName[key] = tb
+			order = append(order, key)
+		}
+		return tb
+	}
+	list := func(s string) []string {
+		if s == "" {
+			return nil
+		}
+		return strings.Split(s, ",")
+	}
+
+	for _, line := range rows {
+		f := strings.Split(line, "\t")
+		switch {
+		case f[0] == "C" && len(f) >= 7:
+			tb := table(f[1], f[2])
+			tb.Columns = append(tb.Columns, schemaColumn{Name: f[3], Type: f[4], Nullable: f[5] == "YES", Default: f[6]})
+		case f[0] == "I" && len(f) >= 8:
+			tb := table(f[1], f[2])
+			tb.Indexes = append(tb.Indexes, schemaIndex{Name: f[3], Unique: f[4] == "t", Primary: f[5] == "t", Columns: list(f[6]), Definition: f[7]})
+		case f[0] == "K" && len(f) >= 9:
+			tb := table(f[1], f[2])
+			typ := f[4]
+			if c.Kind == "postgres" {
+				typ = pgConstraintTypes[typ]
+			}
+			if typ == "FOREIGN KEY" {
+				tb.ForeignKeys = append(tb.ForeignKeys, schemaForeignKey{Name: f[3], Columns: list(f[7]), RefTable: f[6], RefColumns: list(f[8])})
+			} else {
+				tb.Constraints = append(tb.Constraints, schemaConstraint{Name: f[3], Type: typ, Columns: list(f[7]), Definition: f[5]})
+			}
+		default:
+			return nil, fmt.Errorf("unexpected schema row %q", line)
+		}
+	}
+
+	sort.Strings(order)
+	s := &dbSchema{Engine: c.Kind, Database: c.Database, Tables: []schemaTable{}}
+	for _, k := range order {
+		s.Tables = append(s.Tables, *byName[k])
+	}
+	return s, nil
+}
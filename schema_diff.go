@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// ---------- Schema diff (live DB vs snapshot, dump or another project) ----------
+
+type schemaChange[T any] struct {
+	Name   string `json:"name"`
+	Before T      `json:"before"`
+	After  T      `json:"after"`
+}
+
+type tableDiff struct {
+	Table              string                           `json:"table"`
+	AddedColumns       []schemaColumn                   `json:"added_columns,omitempty"`
+	RemovedColumns     []schemaColumn                   `json:"removed_columns,omitempty"`
+	ChangedColumns     []schemaChange[schemaColumn]     `json:"changed_columns,omitempty"`
+	AddedIndexes       []schemaIndex                    `json:"added_indexes,omitempty"`
+	RemovedIndexes     []schemaIndex                    `json:"removed_indexes,omitempty"`
+	ChangedIndexes     []schemaChange[schemaIndex]      `json:"changed_indexes,omitempty"`
+	AddedConstraints   []schemaConstraint               `json:"added_constraints,omitempty"`
+	RemovedConstraints []schemaConstraint               `json:"removed_constraints,omitempty"`
+	ChangedConstraints []schemaChange[schemaConstraint] `json:"changed_constraints,omitempty"`
+	AddedForeignKeys   []schemaForeignKey               `json:"added_foreign_keys,omitempty"`
+	RemovedForeignKeys []schemaForeignKey               `json:"removed_foreign_keys,omitempty"`
+	ChangedForeignKeys []schemaChange[schemaForeignKey] `json:"changed_foreign_keys,omitempty"`
+}
+
+func (d tableDiff) empty() bool {
+	return reflect.DeepEqual(d, tableDiff{Table: d.Table})
+}
+
+// schemaDiff describes how target (the live DB) differs from base.
+type schemaDiff struct {
+	Base          string      `json:"base"`
+	Target        string      `json:"target"`
+	Identical     bool        `json:"identical"`
+	AddedTables   []string    `json:"added_tables,omitempty"`
+	RemovedTables []string    `json:"removed_tables,omitempty"`
+	ChangedTables []tableDiff `json:"changed_tables,omitempty"`
+}
+
+// tableKey identifies a table across DBs. MySQL's schema is the database name,
+// which differs between a live DB and the scratch one, so only the name counts there.
+func tableKey(kind string, tb schemaTable) string {
+	if kind == "mysql" {
+		return tb.Name
+	}
+	return tb.Schema + "." + tb.Name
+}
+
+func diffSchemas(base, target *dbSchema) *schemaDiff {
+	d := &schemaDiff{}
+	before := map[string]schemaTable{}
+	for _, tb := range base.Tables {
+		before[tableKey(base.Engine, tb)] = tb
+	}
+	seen := map[string]bool{}
+	for _, tb := range target.Tables {
+		k := tableKey(target.Engine, tb)
+		seen[k] = true
+		old, ok := before[k]
+		if !ok {
+			d.AddedTables = append(d.AddedTables, k)
+			continue
+		}
+		td := tableDiff{Table: k}
+		td.AddedColumns, td.RemovedColumns, td.ChangedColumns = diffNamed(old.Columns, tb.Columns, func(c schemaColumn) string { return c.Name })
+		td.AddedIndexes, td.RemovedIndexes, td.ChangedIndexes = diffNamed(old.Indexes, tb.Indexes, func(i schemaIndex) string { return i.Name })
+		td.AddedConstraints, td.RemovedConstraints, td.ChangedConstraints = diffNamed(old.Constraints, tb.Constraints, func(c schemaConstraint) string { return c.Name })
+		td.AddedForeignKeys, td.RemovedForeignKeys, td.ChangedForeignKeys = diffNamed(old.ForeignKeys, tb.ForeignKeys, func(f schemaForeignKey) string { return f.Name })
+		if !td.empty() {
+			d.ChangedTables = append(d.ChangedTables, td)
+		}
+	}
+	for k := range before {
+		if !seen[k] {
+			d.RemovedTables = append(d.RemovedTables, k)
+		}
+	}
+	sort.Strings(d.RemovedTables)
+	d.Identical = len(d.AddedTables)+len(d.RemovedTables)+len(d.ChangedTables) == 0
+	return d
+}
+
+// diffNamed matches items by name; matched items that aren't equal are changes.
+func diffNamed[T any](before, after []T, name func(T) string) (added, removed []T, changed []schemaChange[T]) {
+	old := map[string]T{}
+	for _, v := range before {
+		old[name(v)] = v
+	}
+	for _, v := range after {
+		n := name(v)
+		prev, ok := old[n]
+		switch {
+		case !ok:
+			added = append(added, v)
+		case !reflect.DeepEqual(prev, v):
+			changed = append(changed, schemaChange[T]{Name: n, Before: prev, After: v})
+		}
+		delete(old, n)
+	}
+	for _, v := range before {
+		if _, ok := old[name(v)]; ok {
+			removed = append(removed, v)
+		}
+	}
+	return added, removed, changed
+}
+
+// snapshotSchema restores a snapshot into a temporary volume, starts a scratch DB
+// on it and reads its schema. The live DB is not touched.
+func snapshotSchema(t dbTarget, c dbCreds, name string, tables []string) (*dbSchema, *snapshotMeta, error) {
+	meta, err := findSnapshot(t.Project, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	tarPath, _ := snapshotPaths(t.Project, meta.Name)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+	_, env, dataDir, err := serviceRuntime(ctx, t, c.Kind)
+	if err != nil {
+		return nil, meta, err
+	}
+
+	vol := fmt.Sprintf("%s_scratch_%d", t.Project, time.Now().UnixNano())
+	if err := engine.VolumeCreate(ctx, vol, map[string]string{"compose-db-agent.helper": "scratch"}); err != nil {
+		return nil, meta, fmt.Errorf("create volume %s: %w", vol, err)
+	}
+	defer engine.VolumeRemove(context.Background(), vol, true)
+	if err := fillVolume(ctx, meta.Image, vol, tarPath); err != nil {
+		return nil, meta, err
+	}
+
+	s, err := startScratchDB(ctx, meta.Image, env, dataDir, vol, c)
+	if err != nil {
+		return nil, meta, err
+	}
+	defer s.close()
+	schema, err := readSchema(func(script string) (string, error) { return s.sql(ctx, script) }, c, tables)
+	return schema, meta, err
+}
+
+// dumpSchema loads a dump into a fresh scratch DB (same image as the service) and
+// reads its schema.
+func dumpSchema(t dbTarget, c dbCreds, path, comp string, tables []string) (*dbSchema, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Minute)
+	defer cancel()
+	image, env, _, err := serviceRuntime(ctx, t, c.Kind)
+	if err != nil {
+		return nil, err
+	}
+	if image == "" {
+		return nil, errors.New("DB service container not found; start it once so its image can be reused")
+	}
+
+	s, err := startScratchDB(ctx, image, env, "", "", c)
+	if err != nil {
+		return nil, err
+	}
+	defer s.close()
+	if err := s.load(ctx, path, comp); err != nil {
+		return nil, err
+	}
+	return readSchema(func(script string) (string, error) { return s.sql(ctx, script) }, c, tables)
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestDiffSchemas(t *testing.T) {
+	id := schemaColumn{Name: "id", Type: "integer"}
+	email := schemaColumn{Name: "email", Type: "text", Nullable: true}
+	pk := schemaIndex{Name: "users_pkey", Columns: []string{"id"}, Unique: true, Primary: true}
+	byEmail := schemaIndex{Name: "users_email_idx", Columns: []string{"email"}}
+	check := schemaConstraint{Name: "users_email_check", Type: "CHECK", Definition: "CHECK (email <> '')"}
+	fk := schemaForeignKey{Name: "orders_user_fk", Columns: []string{"user_id"}, RefTable: "users", RefColumns: []string{"id"}}
+
+	users := func(edit func(*schemaTable)) schemaTable {
+		tb := schemaTable{Schema: "public", Name: "users", Columns: []schemaColumn{id, email},
+			Indexes: []schemaIndex{pk, byEmail}, Constraints: []schemaConstraint{check}}
+		if edit != nil {
+			edit(&tb)
+		}
+		return tb
+	}
+	orders := func(edit func(*schemaTable)) schemaTable {
+		tb := schemaTable{Schema: "public", Name: "orders", Columns: []schemaColumn{id, {Name: "user_id", Type: "integer"}},
+			ForeignKeys: []schemaForeignKey{fk}}
+		if edit != nil {
+			edit(&tb)
+		}
+		return tb
+	}
+	base := &dbSchema{Engine: "postgres", Tables: []schemaTable{orders(nil), users(nil)}}
+
+	tests := []struct {
+		name   string
+		target []schemaTable
+		want   schemaDiff
+	}{
+		{"identical", []schemaTable{orders(nil), users(nil)}, schemaDiff{Identical: true}},
+		{"table order doesn't matter", []schemaTable{users(nil), orders(nil)}, schemaDiff{Identical: true}},
+		{"tables added and removed", []schemaTable{users(nil), {Schema: "public", Name: "tags"}, {Schema: "audit", Name: "users"}},
+			schemaDiff{AddedTables: []string{"public.tags", "audit.users"}, RemovedTables: []string{"public.orders"}}},
+		{"column added", []schemaTable{orders(nil), users(func(tb *schemaTable) {
+			tb.Columns = append(tb.Columns, schemaColumn{Name: "name", Type: "text"})
+		})}, schemaDiff{ChangedTables: []tableDiff{{Table: "public.users", AddedColumns: []schemaColumn{{Name: "name", Type: "text"}}}}}},
+		{"column removed", []schemaTable{orders(nil), users(func(tb *schemaTable) {
+			tb.Columns = tb.Columns[:1]
+		})}, schemaDiff{ChangedTables: []tableDiff{{Table: "public.users", RemovedColumns: []schemaColumn{email}}}}},
+		{"column changed", []schemaTable{orders(nil), users(func(tb *schemaTable) {
+			tb.Columns = []schemaColumn{id, {Name: "email", Type: "varchar(255)", Default: "''"}}
+		})}, schemaDiff{ChangedTables: []tableDiff{{Table: "public.users", ChangedColumns: []schemaChange[schemaColumn]{
+			{Name: "email", Before: email, After: schemaColumn{Name: "email", Type: "varchar(255)", Default: "''"}},
+		}}}}},
+		{"column order doesn't matter", []schemaTable{orders(nil), users(func(tb *schemaTable) {
+			tb.Columns = []schemaColumn{email, id}
+		})}, schemaDiff{Identical: true}},
+		{"column renamed", []schemaTable{orders(nil), users(func(tb *schemaTable) {
+			tb.Columns = []schemaColumn{id, {Name: "mail", Type: "text", Nullable: true}}
+		})}, schemaDiff{ChangedTables: []tableDiff{{Table: "public.users",
+			AddedColumns: []schemaColumn{{Name: "mail", Type: "text", Nullable: true}}, RemovedColumns: []schemaColumn{email}}}}},
+		{"index added, removed and changed", []schemaTable{orders(func(tb *schemaTable) {
+			tb.Indexes = []schemaIndex{{Name: "orders_user_idx", Columns: []string{"user_id"}}}
+		}), users(func(tb *schemaTable) {
+			tb.Indexes = []schemaIndex{{Name: "users_pkey", Columns: []string{"id", "email"}, Unique: true, Primary: true}}
+		})}, schemaDiff{ChangedTables: []tableDiff{
+			{Table: "public.orders", AddedIndexes: []schemaIndex{{Name: "orders_user_idx", Columns: []string{"user_id"}}}},
+			{Table: "public.users", RemovedIndexes: []schemaIndex{byEmail}, ChangedIndexes: []schemaChange[schemaIndex]{
+				{Name: "users_pkey", Before: pk, After: schemaIndex{Name: "users_pkey", Columns: []string{"id", "email"}, Unique: true, Primary: true}},
+			}},
+		}}},
+		{"index made unique", []schemaTable{orders(nil), users(func(tb *schemaTable) {
+			tb.Indexes = []schemaIndex{pk, {Name: "users_email_idx", Columns: []string{"email"}, Unique: true}}
+		})}, schemaDiff{ChangedTables: []tableDiff{{Table: "public.users", ChangedIndexes: []schemaChange[schemaIndex]{
+			{Name: "users_email_idx", Before: byEmail, After: schemaIndex{Name: "users_email_idx", Columns: []string{"email"}, Unique: true}},
+		}}}}},
+		{"constraint removed", []schemaTable{orders(nil), users(func(tb *schemaTable) {
+			tb.Constraints = nil
+		})}, schemaDiff{ChangedTables: []tableDiff{{Table: "public.users", RemovedConstraints: []schemaConstraint{check}}}}},
+		{"foreign key removed", []schemaTable{orders(func(tb *schemaTable) {
+			tb.ForeignKeys = nil
+		}), users(nil)}, schemaDiff{ChangedTables: []tableDiff{{Table: "public.orders", RemovedForeignKeys: []schemaForeignKey{fk}}}}},
+		{"foreign key added", []schemaTable{orders(nil), users(func(tb *schemaTable) {
+			tb.ForeignKeys = []schemaForeignKey{{Name: "users_manager_fk", Columns: []string{"manager_id"}, RefTable: "users", RefColumns: []string{"id"}}}
+		})}, schemaDiff{ChangedTables: []tableDiff{{Table: "public.users",
+			AddedForeignKeys: []schemaForeignKey{{Name: "users_manager_fk", Columns: []string{"manager_id"}, RefTable: "users", RefColumns: []string{"id"}}}}}}},
+		{"foreign key retargeted", []schemaTable{orders(func(tb *schemaTable) {
+			tb.ForeignKeys = []schemaForeignKey{{Name: "orders_user_fk", Columns: []string{"user_id"}, RefTable: "accounts", RefColumns: []string{"id"}}}
+		}), users(nil)}, schemaDiff{ChangedTables: []tableDiff{{Table: "public.orders", ChangedForeignKeys: []schemaChange[schemaForeignKey]{
+			{Name: "orders_user_fk", Before: fk, After: schemaForeignKey{Name: "orders_user_fk", Columns: []string{"user_id"}, RefTable: "accounts", RefColumns: []string{"id"}}},
+		}}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := diffSchemas(base, &dbSchema{Engine: "postgres", Tables: tt.target})
+			if !reflect.DeepEqual(*got, tt.want) {
+				g, _ := json.MarshalIndent(got, "", "  ")
+				w, _ := json.MarshalIndent(tt.want, "", "  ")
+				t.Errorf("diff:\n%s\nwant:\n%s", g, w)
+			}
+		})
+	}
+}
+
+// MySQL's schema is the database name, which differs between the live DB and
+// the scratch one restored from a snapshot or dump.
+func TestDiffSchemasMySQLIgnoresDatabase(t *testing.T) {
+	live := &dbSchema{Engine: "mysql", Tables: []schemaTable{{Schema: "shop", Name: "users", Columns: []schemaColumn{{Name: "id", Type: "int"}}}}}
+	scratch := &dbSchema{Engine: "mysql", Tables: []schemaTable{{Schema: "scratch_1", Name: "users", Columns: []schemaColumn{{Name: "id", Type: "bigint"}}}}}
+	got := diffSchemas(scratch, live)
+	if got.Identical || len(got.AddedTables)+len(got.RemovedTables) != 0 || len(got.ChangedTables) != 1 || got.ChangedTables[0].Table != "users" {
+		t.Errorf("diff = %+v, want only users.id changed", got)
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// ---------- Throwaway DB containers (to look inside snapshots and dumps) ----------
+
+// scratchDB is a DB container started from the service's image, outside compose,
+// with no published ports. Clients inside it connect over TCP to 127.0.0.1, which
+// the official images only open once their init scripts have finished.
+type scratchDB struct {
+	id string
+	c  dbCreds
+}
+
+var defaultDataDirs = map[string]string{"postgres": "/var/lib/postgresql/data", "mysql": "/var/lib/mysql"}
+
+// serviceRuntime returns the DB service container's image, env and data dir (where
+// DB_VOLUME is mounted). Without a container it falls back to the app env and the
+// image's default data dir; image is then empty.
+func serviceRuntime(ctx context.Context, t dbTarget, kind string) (image string, env []string, dataDir string, err error) {
+	dataDir = defaultDataDirs[kind]
+	id, err := containerID(t.Project, t.Service)
+	if err != nil {
+		for k, v := range readDotenv(os.Getenv("APP_ENV_FILE")) {
+			env = append(env, k+"="+v)
+		}
+		return "", env, dataDir, nil
+	}
+	info, err := engine.ContainerInspect(ctx, id)
+	if err != nil {
+		return "", nil, "", err
+	}
+	vol := ""
+	if t.Volume != "" {
+		vol = dbVolumeName(t.Project, t.Volume)
+	}
+	for _, m := range info.Mounts {
+		if m.Type == "volume" && (vol == "" || m.Name == vol) {
+			dataDir = m.Destination
+			break
+		}
+	}
+	return info.Config.Image, info.Config.Env, dataDir, nil
+}
+
+// startScratchDB runs image with vol (if any) mounted at dataDir and waits until
+// the DB accepts connections.
+func startScratchDB(ctx context.Context, image string, env []string, dataDir, vol string, c dbCreds) (*scratchDB, error) {
+	var binds []string
+	if vol != "" {
+		binds = []string{vol + ":" + dataDir}
+	}
+	id, err := engine.ContainerCreate(ctx, "", map[string]any{
+		"Image":      image,
+		"Env":        env,
+		"Labels":     map[string]string{"compose-db-agent.helper": "scratch"},
+		"HostConfig": map[string]any{"Binds": binds},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create scratch container: %w", err)
+	}
+	s := &scratchDB{id: id, c: c}
+	if err := engine.ContainerStart(ctx, id); err != nil {
+		s.close()
+		return nil, err
+	}
+	if err := s.waitReady(ctx); err != nil {
+		s.close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *scratchDB) waitReady(ctx context.Context) error {
+	for {
+		_, err := s.sql(ctx, "SELECT 1;")
+		if err == nil {
+			return nil
+		}
+		info, ierr := engine.ContainerInspect(ctx, s.id)
+		if ierr == nil && !info.State.Running {
+			logs, _ := engine.ContainerLogs(ctx, s.id, 20)
+			return fmt.Errorf("scratch DB exited (code %d): %s", info.State.ExitCode, strings.TrimSpace(logs))
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("scratch DB not ready: %w (last error: %v)", ctx.Err(), err)
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// tcpClient points a client command (psql, mysql, pg_restore) at 127.0.0.1.
+func tcpClient(cmd []string) []string {
+	return append([]string{cmd[0], "-h", "127.0.0.1"}, cmd[1:]...)
+}
+
+// run executes cmd with stdin from a file inside the container; output is stdout.
+func (s *scratchDB) run(ctx context.Context, cmd []string, stdinFile string) (string, error) {
+	quoted := make([]string, len(cmd))
+	for i, a := range cmd {
+		quoted[i] = "'" + strings.ReplaceAll(a, "'", `'\''`) + "'"
+	}
+	shell := strings.Join(quoted, " ") + " < " + stdinFile
+	env := []string{driverFor(s.c.Kind).PasswordEnv() + "=" + s.c.Password}
+	out, errOut, code, err := engine.ContainerExec(ctx, s.id, []string{"sh", "-c", shell}, env)
+	if err == nil && code != 0 {
+		err = fmt.Errorf("%s exited with %d: %s", cmd[0], code, strings.TrimSpace(errOut))
+	}
+	return out, err
+}
+
+// put copies r (size bytes) into the container as /tmp/<name>.
+func (s *scratchDB) put(ctx context.Context, name string, r io.Reader, size int64) error {
+	pr, pw := io.Pipe()
+	go func() {
+		tw := tar.NewWriter(pw)
+		err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: size, ModTime: time.Now()})
+		if err == nil {
+			_, err = io.Copy(tw, r)
+		}
+		if err == nil {
+			err = tw.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+	return engine.CopyToContainer(ctx, s.id, "/tmp", pr)
+}
+
+// sql runs a script through the batch client (same output as runSQL).
+func (s *scratchDB) sql(ctx context.Context, script string) (string, error) {
+	if err := s.put(ctx, "script.sql", strings.NewReader(script), int64(len(script))); err != nil {
+		return "", err
+	}
+	return s.run(ctx, tcpClient(sqlCommand(s.c)), "/tmp/script.sql")
+}
+
+// load restores a (possibly compressed) dump file from the host, like loadDB.
+func (s *scratchDB) load(ctx context.Context, path, comp string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	dr, err := decompressFrom(f, comp)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	defer dr.Close()
+
+	// the tar header needs the size, so decompress to a temp file first
+	tmp, err := os.CreateTemp("", "compose-db-agent-*.dump")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	size, err := io.Copy(tmp, dr)
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	br := bufio.NewReader(tmp)
+	magic, _ := br.Peek(5)
+	if err := s.put(ctx, "load.dump", br, size); err != nil {
+		return err
+	}
+	cmd, err := driverFor(s.c.Kind).RestoreCommand(s.c, magic)
+	if err != nil {
+		return err
+	}
+	if _, err := s.run(ctx, tcpClient(cmd), "/tmp/load.dump"); err != nil {
+		return fmt.Errorf("load %s: %w", path, err)
+	}
+	return nil
+}
+
+func (s *scratchDB) close() {
+	if err := engine.ContainerRemove(context.Background(), s.id); err != nil && !isNotFound(err) {
+		fmt.Fprintln(os.Stderr, "warning: remove scratch container:", err)
+	}
+}
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ---------- Declarative seed pipeline (seeds.yaml in APP_DIR) ----------
+
+// seedFile mirrors the YAML:
+//
+//	steps:
+//	  - name: base data
+//	    sql: seeds/base.sql
+//	  - name: users
+//	    csv: seeds/users.csv
+//	    table: users
+//	  - name: search index
+//	    exec: bin/reindex          # inside db_service (sh -lc)
+//	    timeout: 2m
+//	  - name: uploads
+//	    host: ./scripts/seed-s3.sh # on the host, in APP_DIR
+type seedFile struct {
+	Steps []seedStep `yaml:"steps"`
+}
+
+type seedStep struct {
+	Name    string `yaml:"name"`
+	SQL     string `yaml:"sql"`
+	CSV     string `yaml:"csv"`
+	Table   string `yaml:"table"`
+	Header  *bool  `yaml:"header"` // csv: first row names the columns (default true)
+	Exec    string `yaml:"exec"`
+	Host    string `yaml:"host"`
+	Timeout string `yaml:"timeout"` // Go duration, default 5m
+}
+
+func (s seedStep) kind() string {
+	switch {
+	case s.SQL != "":
+		return "sql"
+	case s.CSV != "":
+		return "csv"
+	case s.Exec != "":
+		return "exec"
+	case s.Host != "":
+		return "host"
+	}
+	return ""
+}
+
+type seedStepResult struct {
+	Name     string `json:"name"`
+	Kind     string `json:"kind"`
+	Rows     *int64 `json:"rows_inserted,omitempty"`
+	Duration string `json:"duration"`
+	Output   string `json:"output,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+var tableName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*(\.[a-zA-Z_][a-zA-Z0-9_]*)?$`)
+
+// seedPath resolves path (default SEED_FILE, then "seeds.yaml") inside APP_DIR.
+func seedPath(path string) (string, error) {
+	if path == "" {
+		path = os.Getenv("SEED_FILE")
+	}
+	if path == "" {
+		path = "seeds.yaml"
+	}
+	return appPath(path)
+}
+
+// appPath resolves a path inside APP_DIR, refusing to escape it (absolute
+// paths too, unless they point into APP_DIR).
+func appPath(p string) (string, error) {
+	return insideDir(os.Getenv("APP_DIR"), p, "APP_DIR")
+}
+
+// loadSeedFile parses and validates the pipeline; every step must be runnable.
+func loadSeedFile(path string) (*seedFile, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var sf seedFile
+	if err := yaml.Unmarshal(b, &sf); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(sf.Steps) == 0 {
+		return nil, fmt.Errorf("%s: no steps", path)
+	}
+	for i, s := range sf.Steps {
+		set := 0
+		for _, v := range []string{s.SQL, s.CSV, s.Exec, s.Host} {
+			if v != "" {
+				set++
+			}
+		}
+		if set != 1 {
+			return nil, fmt.Errorf("%s: step %d (%q) needs exactly one of sql, csv, exec, host", path, i+1, s.Name)
+		}
+		if s.CSV != "" && !tableName.MatchString(s.Table) {
+			return nil, fmt.Errorf("%s: step %d (%q): csv needs a valid table", path, i+1, s.Name)
+		}
+		if s.Timeout != "" {
+			if _, err := time.ParseDuration(s.Timeout); err != nil {
+				return nil, fmt.Errorf("%s: step %d (%q): %w", path, i+1, s.Name, err)
+			}
+		}
+		if sf.Steps[i].Name == "" {
+			sf.Steps[i].Name = fmt.Sprintf("step %d", i+1)
+		}
+	}
+	return &sf, nil
+}
+
+// runSeeds runs the steps in order (only those named in only, if given) and stops
+// at the first failure; the results so far are returned either way.
+func runSeeds(t dbTarget, c dbCreds, sf *seedFile, only []string) ([]seedStepResult, error) {
+	results := []seedStepResult{}
+	for _, s := range sf.Steps {
+		if len(only) > 0 && !contains(only, s.Name) {
+			continue
+		}
+		timeout := 5 * time.Minute
+		if s.Timeout != "" {
+			timeout, _ = time.ParseDuration(s.Timeout)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		start := time.Now()
+		rows, out, err := runSeedStep(ctx, t, c, s)
+		cancel()
+
+		r := seedStepResult{Name: s.Name, Kind: s.kind(), Rows: rows, Duration: time.Since(start).Round(time.Millisecond).String(), Output: tail(out, 2000)}
+		if err != nil {
+			r.Error = err.Error()
+			results = append(results, r)
+			return results, fmt.Errorf("seed step %q: %w", s.Name, err)
+		}
+		results = append(results, r)
+	}
+	return results, nil
+}
+
+func runSeedStep(ctx context.Context, t dbTarget, c dbCreds, s seedStep) (*int64, string, error) {
+	if k := s.kind(); (k == "sql" || k == "csv") && !isSQL(c.Kind) {
+		return nil, "", fmt.Errorf("%s steps need a SQL engine; use exec steps for %s", k, c.Kind)
+	}
+	switch s.kind() {
+	case "sql":
+		path, err := appPath(s.SQL)
+		if err != nil {
+			return nil, "", err
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, "", err
+		}
+		defer f.Close()
+		var out bytes.Buffer
+		err = streamComposeContext(ctx, execEnv(c), f, liveTee(&out), execArgs(t, c, seedSQLCommand(c)...)...)
+		rows := countRows(c.Kind, out.String())
+		return &rows, out.String(), err
+	case "csv":
+		return seedCSV(ctx, t, c, s)
+	case "exec":
+		var out bytes.Buffer
+		err := streamComposeContext(ctx, readDotenv(os.Getenv("APP_ENV_FILE")), nil, liveTee(&out),
+			"-p", t.Project, "-f", t.ComposeFile, "exec", "-T", t.Service, "sh", "-lc", s.Exec)
+		return nil, out.String(), err
+	case "host":
+		if dryRun {
+			return nil, "[dry-run] sh -c " + s.Host, nil
+		}
+		cmd := exec.CommandContext(ctx, "sh", "-c", s.Host)
+		cmd.Dir = os.Getenv("APP_DIR")
+		cmd.Env = os.Environ()
+		for k, v := range readDotenv(os.Getenv("APP_ENV_FILE")) {
+			cmd.Env = append(cmd.Env, k+"="+v)
+		}
+		var out bytes.Buffer
+		cmd.Stdout = liveTee(&out)
+		cmd.Stderr = cmd.Stdout
+		err := cmd.Run()
+		return nil, out.String(), err
+	}
+	return nil, "", errors.New("empty step")
+}
+
+// seedSQLCommand is the SQL client without quiet mode, so it echoes the
+// per-statement row counts (INSERT 0 n / COPY n, or "Query OK, n rows affected").
+func seedSQLCommand(c dbCreds) []string {
+	if c.Kind == "mysql" {
+		return []string{"mysql", "-u", c.User, "-vvv", c.Database}
+	}
+	return []string{"psql", "-U", c.User, "-d", c.Database, "-X", "-v", "ON_ERROR_STOP=1"}
+}
+
+var (
+	pgRowTag    = regexp.MustCompile(`(?m)^(?:INSERT \d+ (\d+)|COPY (\d+))\s*$`)
+	mysqlRowTag = regexp.MustCompile(`Query OK, (\d+) rows? affected`)
+)
+
+// countRows sums the inserted rows reported in the client's output.
+func countRows(kind, out string) int64 {
+	re := pgRowTag
+	if kind == "mysql" {
+		re = mysqlRowTag
+	}
+	var n int64
+	for _, m := range re.FindAllStringSubmatch(out, -1) {
+		for _, g := range m[1:] {
+			if v, err := strconv.ParseInt(g, 10, 64); err == nil {
+				n += v
+			}
+		}
+	}
+	return n
+}
+
+// seedCSV loads a CSV into a table: COPY FROM STDIN on Postgres, batched INSERTs on
+// MySQL (LOAD DATA LOCAL is off by default there).
+func seedCSV(ctx context.Context, t dbTarget, c dbCreds, s seedStep) (*int64, string, error) {
+	path, err := appPath(s.CSV)
+	if err != nil {
+		return nil, "", err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, "", err
+	}
+	defer f.Close()
+	header := s.Header == nil || *s.Header
+
+	var out bytes.Buffer
+	if c.Kind == "postgres" {
+		copySQL := fmt.Sprintf("COPY %s FROM STDIN WITH (FORMAT csv, HEADER %t)", s.Table, header)
+		if header {
+			// name the columns from the header so the CSV may skip/reorder them
+			hdr, err := csv.NewReader(f).Read()
+			if err != nil {
+				return nil, "", fmt.Errorf("%s: %w", s.CSV, err)
+			}
+			cols, err := quoteIdents(hdr, `"`)
+			if err != nil {
+				return nil, "", fmt.Errorf("%s: %w", s.CSV, err)
+			}
+			copySQL = fmt.Sprintf("COPY %s (%s) FROM STDIN WITH (FORMAT csv, HEADER true)", s.Table, cols)
+			if _, err := f.Seek(0, io.SeekStart); err != nil {
+				return nil, "", err
+			}
+		}
+		cmd := append(seedSQLCommand(c), "-c", copySQL)
+		err := streamComposeContext(ctx, execEnv(c), f, &out, execArgs(t, c, cmd...)...)
+		rows := countRows(c.Kind, out.String())
+		return &rows, out.String(), err
+	}
+
+	script, rows, err := csvInserts(f, s.Table, header)
+	if err != nil {
+		return nil, "", fmt.Errorf("%s: %w", s.CSV, err)
+	}
+	err = streamComposeContext(ctx, execEnv(c), strings.NewReader(script), &out, execArgs(t, c, sqlCommand(c)...)...)
+	return &rows, out.String(), err
+}
+
+// csvInserts turns a CSV into INSERT statements of up to 500 rows each (MySQL quoting).
+func csvInserts(r io.Reader, table string, header bool) (string, int64, error) {
+	cr := csv.NewReader(r)
+	records, err := cr.ReadAll()
+	if err != nil {
+		return "", 0, err
+	}
+	cols := ""
+	if header && len(records) > 0 {
+		q, err := quoteIdents(records[0], "`")
+		if err != nil {
+			return "", 0, err
+		}
+		cols, records = " ("+q+")", records[1:]
+	}
+	var sb strings.Builder
+	for i := 0; i < len(records); i += 500 {
+		end := min(i+500, len(records))
+		fmt.Fprintf(&sb, "INSERT INTO %s%s VALUES\n", table, cols)
+		for k, rec := range records[i:end] {
+			vals := make([]string, len(rec))
+			for n, v := range rec {
+				vals[n] = "'" + strings.NewReplacer(`\`, `\\`, `'`, `''`).Replace(v) + "'"
+			}
+			sep := ","
+			if k == end-i-1 {
+				sep = ";"
+			}
+			fmt.Fprintf(&sb, "(%s)%s\n", strings.Join(vals, ", "), sep)
+		}
+	}
+	return sb.String(), int64(len(records)), nil
+}
+
+func quoteIdents(names []string, q string) (string, error) {
+	out := make([]string, len(names))
+	for i, n := range names {
+		n = strings.TrimSpace(n)
+		if !tableName.MatchString(n) || strings.Contains(n, ".") {
+			return "", fmt.Errorf("invalid column name %q", n)
+		}
+		out[i] = q + n + q
+	}
+	return strings.Join(out, ", "), nil
+}
+
+// tail keeps the last n bytes of s.
+func tail(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return "…" + s[len(s)-n:]
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadSeedFile(t *testing.T) {
+	write := func(src string) string {
+		path := filepath.Join(t.TempDir(), "seeds.yaml")
+		if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	sf, err := loadSeedFile(write(`
+steps:
+  - name: base
+    sql: seeds/base.sql
+  - csv: seeds/users.csv
+    table: public.users
+    header: false
+  - exec: bin/reindex
+    timeout: 2m
+  - host: ./scripts/seed-s3.sh
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, s := range sf.Steps {
+		got = append(got, s.Name+"="+s.kind())
+	}
+	if want := "base=sql step 2=csv step 3=exec step 4=host"; strings.Join(got, " ") != want {
+		t.Errorf("steps = %q, want %q", got, want)
+	}
+	if h := sf.Steps[1].Header; h == nil || *h {
+		t.Errorf("header = %v, want false", h)
+	}
+
+	tests := []struct {
+		src, wantErr string
+	}{
+		{"", "no steps"},
+		{"steps: []", "no steps"},
+		{"steps: [{name: a}]", `step 1 ("a") needs exactly one of sql, csv, exec, host`},
+		{"steps: [{sql: a.sql}, {sql: b.sql, exec: run}]", `step 2 ("") needs exactly one`},
+		{"steps: [{csv: u.csv}]", "csv needs a valid table"},
+		{"steps: [{csv: u.csv, table: 'users; DROP TABLE x'}]", "csv needs a valid table"},
+		{"steps: [{csv: u.csv, table: a.b.c}]", "csv needs a valid table"},
+		{"steps: [{exec: x, timeout: soon}]", `invalid duration "soon"`},
+		{"steps: {sql: a.sql}", "cannot unmarshal"},
+	}
+	for _, tt := range tests {
+		_, err := loadSeedFile(write(tt.src))
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("loadSeedFile(%q) = %v, want error %q", tt.src, err, tt.wantErr)
+		}
+	}
+	if _, err := loadSeedFile(filepath.Join(t.TempDir(), "missing.yaml")); !os.IsNotExist(err) {
+		t.Errorf("missing file: %v", err)
+	}
+}
+
+func TestCSVInserts(t *testing.T) {
+	tests := []struct {
+		name, csv string
+		header    bool
+		want      string
+		rows      int64
+	}{
+		{"header", "id,name\n1,Ada\n2,Grace\n", true,
+			"INSERT INTO users (`id`, `name`) VALUES\n('1', 'Ada'),\n('2', 'Grace');\n", 2},
+		{"no header", "1,Ada\n", false,
+			"INSERT INTO users VALUES\n('1', 'Ada');\n", 1},
+		{"header trimmed", " id , name \n1,x\n", true,
+			"INSERT INTO users (`id`, `name`) VALUES\n('1', 'x');\n", 1},
+		{"quoting", "a,b,c,d\n\"O'Brien\",C:\\tmp\\,\"two\nlines\",\n", true,
+			"INSERT INTO users (`a`, `b`, `c`, `d`) VALUES\n('O''Brien', 'C:\\\\tmp\\\\', 'two\nlines', '');\n", 1},
+		{"csv quotes", `a` + "\n" + `"say ""hi"", ok"` + "\n", true,
+			"INSERT INTO users (`a`) VALUES\n('say \"hi\", ok');\n", 1},
+		{"injection stays a value", "a\n'); DROP TABLE users; --\n", true,
+			"INSERT INTO users (`a`) VALUES\n('''); DROP TABLE users; --');\n", 1},
+		{"header only", "id,name\n", true, "", 0},
+		{"empty", "", true, "", 0},
+	}
+	for _, tt := range tests {
+		got, rows, err := csvInserts(strings.NewReader(tt.csv), "users", tt.header)
+		if err != nil || got != tt.want || rows != tt.rows {
+			t.Errorf("%s: csvInserts = %q, %d, %v; want %q, %d", tt.name, got, rows, err, tt.want, tt.rows)
+		}
+	}
+
+	var big strings.Builder
+	big.WriteString("n\n")
+	for i := 0; i < 1001; i++ {
+		fmt.Fprintf(&big, "%d\n", i)
+	}
+	got, rows, err := csvInserts(strings.NewReader(big.String()), "nums", true)
+	if err != nil || rows != 1001 {
+		t.Fatalf("csvInserts = %d rows, %v", rows, err)
+	}
+	if n := strings.Count(got, "INSERT INTO nums (`n`) VALUES\n"); n != 3 {
+		t.Errorf("%d INSERT statements for 1001 rows, want 3 (500 rows each)", n)
+	}
+	if !strings.Contains(got, "('499');\nINSERT") || !strings.HasSuffix(got, "('1000');\n") {
+		t.Errorf("statements don't end at the batch boundaries:\n%s", got)
+	}
+
+	for _, tt := range []struct{ name, csv, wantErr string }{
+		{"bad column", "id,\"na`me\"\n1,x\n", "invalid column name"},
+		{"qualified column", "users.id\n1\n", "invalid column name"},
+		{"ragged rows", "a,b\n1\n", "wrong number of fields"},
+	} {
+		if _, _, err := csvInserts(strings.NewReader(tt.csv), "users", true); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: err = %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
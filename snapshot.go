@@ -0,0 +1,384 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ---------- Volume snapshots (tar.gz of the DB volume + JSON metadata) ----------
+
+// dbTarget is the DB a tool operates on, resolved from tool args + env defaults.
+type dbTarget struct {
+	Project     string
+	ComposeFile string
+	Service     string
+	Volume      string // compose volume key (DB_VOLUME), not the docker volume name
+}
+
+// targetArgs reads and validates project/compose_file/db_service/db_volume.
+func targetArgs(a map[string]any) (dbTarget, error) {
+	t := dbTarget{}
+	t.Project, _ = a["project"].(string)
+	t.ComposeFile, _ = a["compose_file"].(string)
+	t.Service, _ = a["db_service"].(string)
+	t.Volume, _ = a["db_volume"].(string)
+	if err := safeProject(t.Project); err != nil {
+		return t, err
+	}
+	if err := safeComposePath(t.ComposeFile); err != nil {
+		return t, err
+	}
+	if err := safeService(t.Service); err != nil {
+		return t, err
+	}
+	return t, nil
+}
+
+type snapshotMeta struct {
+	Name      string    `json:"name"`
+	Project   string    `json:"project"`
+	Service   string    `json:"service"`
+	Volume    string    `json:"volume"` // docker volume name
+	Image     string    `json:"image"`
+	CreatedAt time.Time `json:"created_at"`
+	GitCommit string    `json:"git_commit,omitempty"`
+	SizeBytes int64     `json:"size_bytes"`
+	Reason    string    `json:"reason,omitempty"`
+	Auto      bool      `json:"auto,omitempty"` // safety snapshot taken before a destructive tool
+}
+
+// Inside helper containers the volume is mounted here; archives are rooted at "volume/".
+const snapshotMount = "/volume"
+
+// snapshotHelperImage runs the helper container when nothing names the DB's
+// image (no container, a build-only service, no earlier snapshot).
+const snapshotHelperImage = "busybox:stable"
+
+func snapshotDir(project string) string {
+	root := os.Getenv("SNAPSHOT_DIR")
+	if root == "" {
+		root = ".snapshots"
+	}
+	return filepath.Join(root, project)
+}
+
+func snapshotPaths(project, name string) (tarball, meta string) {
+	base := filepath.Join(snapshotDir(project), name)
+	return base + ".tar.gz", base + ".json"
+}
+
+// gitHead returns the commit checked out in dir, or "" if it isn't a git repo.
+func gitHead(dir string) string {
+	if dir == "" {
+		dir = "."
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, "git", "-C", dir, "rev-parse", "HEAD").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// helperContainer creates a stopped container from image with the volume mounted,
+// pulling the image first if it isn't there. Nothing runs in it; it only exists
+// so the archive endpoints can reach the volume.
+func helperContainer(ctx context.Context, image, vol string, readOnly bool) (string, error) {
+	bind := vol + ":" + snapshotMount
+	if readOnly {
+		bind += ":ro"
+	}
+	cfg := map[string]any{
+		"Image":      image,
+		"Entrypoint": []string{"true"},
+		"Labels":     map[string]string{"compose-db-agent.helper": "snapshot"},
+		"HostConfig": map[string]any{"Binds": []string{bind}},
+	}
+	id, err := engine.ContainerCreate(ctx, "", cfg)
+	if isNotFound(err) {
+		if err := engine.ImagePull(ctx, image); err != nil {
+			return "", fmt.Errorf("pull %s: %w", image, err)
+		}
+		id, err = engine.ContainerCreate(ctx, "", cfg)
+	}
+	return id, err
+}
+
+// snapshotImage picks the helper image: the DB container's own, else the
+// image db_service has in the compose file, else the one recorded in the
+// newest snapshot, else snapshotHelperImage. running reports whether the DB
+// container is up.
+func snapshotImage(ctx context.Context, t dbTarget) (image string, running bool, err error) {
+	if id, err := containerID(t.Project, t.Service); err == nil {
+		info, err := engine.ContainerInspect(ctx, id)
+		if err != nil {
+			return "", false, err
+		}
+		return info.Config.Image, info.State.Running, nil
+	}
+	if p, err := loadCompose(t.ComposeFile, composeEnv()); err == nil {
+		if image, _ := p.Services[t.Service]["image"].(string); image != "" {
+			return image, false, nil
+		}
+	}
+	if last, err := findSnapshot(t.Project, ""); err == nil && last.Image != "" {
+		return last.Image, false, nil
+	}
+	return snapshotHelperImage, false, nil
+}
+
+// restartDB starts the DB service stopped for a snapshot and waits until it is
+// ready, so the caller's next command doesn't race its startup.
+func restartDB(extra map[string]string, t dbTarget) error {
+	if _, err := runComposeWithEnv(extra, "-p", t.Project, "-f", t.ComposeFile, "start", t.Service); err != nil {
+		return err
+	}
+	id, err := containerID(t.Project, t.Service)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 180*time.Second)
+	defer cancel()
+	_, err = waitForHealth(ctx, id)
+	return err
+}
+
+// takeSnapshot stops the DB service, archives its volume and, if it was running,
+// starts it again and waits for it to be ready.
+func takeSnapshot(t dbTarget, name, reason string, auto bool) (*snapshotMeta, error) {
+	if t.Volume == "" {
+		return nil, errors.New("DB_VOLUME is not set; don't know which volume to snapshot")
+	}
+	if name == "" {
+		name = time.Now().UTC().Format("20060102-150405")
+	}
+	if err := safeService(name); err != nil {
+		return nil, fmt.Errorf("invalid snapshot name: %q", name)
+	}
+	_, metaPath := snapshotPaths(t.Project, name)
+	if _, err := os.Stat(metaPath); err == nil {
+		return nil, fmt.Errorf("snapshot %q already exists", name)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	vol := dbVolumeName(t.Project, t.Volume)
+	if _, err := engine.VolumeInspect(ctx, vol); err != nil {
+		return nil, fmt.Errorf("volume %s: %w", vol, err)
+	}
+	image, running, err := snapshotImage(ctx, t)
+	if err != nil {
+		return nil, err
+	}
+
+	// Stop for a consistent on-disk state; bring it back afterwards.
+	extra := readDotenv(os.Getenv("APP_ENV_FILE"))
+	if running {
+		if _, err := runComposeWithEnv(extra, "-p", t.Project, "-f", t.ComposeFile, "stop", t.Service); err != nil {
+			return nil, err
+		}
+	}
+	meta := &snapshotMeta{
+		Name:    name,
+		Project: t.Project,
+		Service: t.Service,
+		Volume:  vol,
+		Image:   image,
+		Reason:  reason,
+		Auto:    auto,
+	}
+	err = archiveVolume(ctx, meta)
+	if running {
+		if rerr := restartDB(extra, t); rerr != nil && err == nil {
+			err = fmt.Errorf("restart %s after the snapshot: %w", t.Service, rerr)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return meta, nil
+}
+
+// archiveVolume writes the contents of meta.Volume and the metadata file; the
+// DB must be stopped.
+func archiveVolume(ctx context.Context, meta *snapshotMeta) error {
+	tarPath, metaPath := snapshotPaths(meta.Project, meta.Name)
+	helper, err := helperContainer(ctx, meta.Image, meta.Volume, true)
+	if err != nil {
+		return fmt.Errorf("create helper container: %w", err)
+	}
+	defer engine.ContainerRemove(context.Background(), helper)
+
+	rc, err := engine.CopyFromContainer(ctx, helper, snapshotMount)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	if err := os.MkdirAll(snapshotDir(meta.Project), 0o755); err != nil {
+		return err
+	}
+	if meta.SizeBytes, err = writeGzip(tarPath, rc); err != nil {
+		return err
+	}
+	meta.CreatedAt = time.Now().UTC()
+	meta.GitCommit = gitHead(os.Getenv("APP_DIR"))
+	b, _ := json.MarshalIndent(meta, "", "  ")
+	if err := os.WriteFile(metaPath, b, 0o644); err != nil {
+		os.Remove(tarPath)
+		return err
+	}
+	return nil
+}
+
+// writeGzip compresses r into path via a temp file, returning the compressed size.
+func writeGzip(path string, r io.Reader) (int64, error) {
+	tmp := path + ".partial"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return 0, err
+	}
+	zw := gzip.NewWriter(f)
+	_, err = io.Copy(zw, r)
+	if cerr := zw.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return 0, err
+	}
+	fi, err := os.Stat(tmp)
+	if err != nil {
+		return 0, err
+	}
+	return fi.Size(), os.Rename(tmp, path)
+}
+
+// restoreSnapshot replaces the DB volume with the snapshot's contents and starts the DB.
+func restoreSnapshot(t dbTarget, name string) (*snapshotMeta, healthResult, error) {
+	var hr healthResult
+	if t.Volume == "" {
+		return nil, hr, errors.New("DB_VOLUME is not set; don't know which volume to restore")
+	}
+	meta, err := findSnapshot(t.Project, name)
+	if err != nil {
+		return nil, hr, err
+	}
+	tarPath, _ := snapshotPaths(t.Project, meta.Name)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	extra := readDotenv(os.Getenv("APP_ENV_FILE"))
+	if _, err := stopServices(extra, t.Project, t.ComposeFile, []string{t.Service}); err != nil {
+		return meta, hr, err
+	}
+
+	// Recreate the volume empty, keeping compose's labels so it still owns it.
+	vol := dbVolumeName(t.Project, t.Volume)
+	labels := map[string]string{
+		"com.docker.compose.project": t.Project,
+		"com.docker.compose.volume":  t.Volume,
+	}
+	if v, err := engine.VolumeInspect(ctx, vol); err == nil {
+		if len(v.Labels) > 0 {
+			labels = v.Labels
+		}
+		if err := engine.VolumeRemove(ctx, vol, false); err != nil {
+			return meta, hr, fmt.Errorf("remove volume %s: %w", vol, err)
+		}
+	}
+	if err := engine.VolumeCreate(ctx, vol, labels); err != nil {
+		return meta, hr, fmt.Errorf("create volume %s: %w", vol, err)
+	}
+
+	if err := fillVolume(ctx, meta.Image, vol, tarPath); err != nil {
+		return meta, hr, err
+	}
+
+	if _, err := runComposeLive(extra, append(composeFileArgs(t.Project, t.ComposeFile), "up", "-d", t.Service)...); err != nil {
+		return meta, hr, err
+	}
+	id, err := containerID(t.Project, t.Service)
+	if err != nil {
+		return meta, hr, err
+	}
+	wctx, wcancel := context.WithTimeout(context.Background(), 180*time.Second)
+	defer wcancel()
+	hr, err = waitForHealth(wctx, id)
+	return meta, hr, err
+}
+
+// fillVolume extracts a snapshot tarball into vol through a helper container.
+func fillVolume(ctx context.Context, image, vol, tarPath string) error {
+	helper, err := helperContainer(ctx, image, vol, false)
+	if err != nil {
+		return fmt.Errorf("create helper container: %w", err)
+	}
+	defer engine.ContainerRemove(context.Background(), helper)
+
+	f, err := os.Open(tarPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return fmt.Errorf("%s: %w", tarPath, err)
+	}
+	// entries are "volume/...", so extracting at / lands them in the mount
+	return engine.CopyToContainer(ctx, helper, "/", zr)
+}
+
+// listSnapshots returns a project's snapshots, newest first.
+func listSnapshots(project string) ([]snapshotMeta, error) {
+	paths, err := filepath.Glob(filepath.Join(snapshotDir(project), "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	out := []snapshotMeta{}
+	for _, p := range paths {
+		b, err := os.ReadFile(p)
+		if err != nil {
+			continue
+		}
+		var m snapshotMeta
+		if json.Unmarshal(b, &m) == nil {
+			out = append(out, m)
+		}
+	}
+	sort.Slice(out, func(i, k int) bool { return out[i].CreatedAt.After(out[k].CreatedAt) })
+	return out, nil
+}
+
+// findSnapshot loads a snapshot by name; empty name means the newest one.
+func findSnapshot(project, name string) (*snapshotMeta, error) {
+	all, err := listSnapshots(project)
+	if err != nil {
+		return nil, err
+	}
+	for i := range all {
+		if name == "" || all[i].Name == name {
+			return &all[i], nil
+		}
+	}
+	if name == "" {
+		return nil, fmt.Errorf("no snapshots for project %q in %s", project, snapshotDir(project))
+	}
+	return nil, fmt.Errorf("snapshot %q not found for project %q", name, project)
+}
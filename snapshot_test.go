@@ -0,0 +1,190 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeSnapshotEnv points the Docker client at handler and compose at a script
+// that only logs its arguments; it returns a reader for that log.
+func fakeSnapshotEnv(t *testing.T, handler http.HandlerFunc) (log func() string) {
+	t.Helper()
+	dir := t.TempDir()
+	logFile := filepath.Join(dir, "compose.log")
+	script := filepath.Join(dir, "compose")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\necho \"$*\" >> \"$FAKE_COMPOSE_LOG\"\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("FAKE_COMPOSE_LOG", logFile)
+	t.Setenv("APP_DIR", dir)
+	t.Setenv("APP_ENV_FILE", "")
+	t.Setenv("SNAPSHOT_DIR", filepath.Join(dir, "snapshots"))
+	t.Setenv("AUTO_SNAPSHOT", "")
+	t.Setenv("READY_PROBE_DB", "")
+
+	oldEngine, oldCompose, oldDry := engine, composeBase, dryRun
+	t.Cleanup(func() { engine, composeBase, dryRun = oldEngine, oldCompose, oldDry })
+	engine, composeBase, dryRun = fakeDaemon(t, handler), []string{script}, false
+
+	return func() string {
+		b, _ := os.ReadFile(logFile)
+		return string(b)
+	}
+}
+
+// volumeTar is an archive as GET /containers/{id}/archive returns it.
+func volumeTar(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	tw.WriteHeader(&tar.Header{Name: "volume/", Typeflag: tar.TypeDir, Mode: 0o755})
+	tw.WriteHeader(&tar.Header{Name: "volume/PG_VERSION", Mode: 0o600, Size: 3})
+	tw.Write([]byte("16\n"))
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestTakeSnapshotWaitsForRestart(t *testing.T) {
+	var mu sync.Mutex
+	healthy := false
+	var log func() string
+	archive := volumeTar(t)
+	log = fakeSnapshotEnv(t, func(w http.ResponseWriter, r *http.Request) {
+		p := strings.TrimPrefix(r.URL.Path, "/"+dockerAPIVersion)
+		switch {
+		case p == "/volumes":
+			fmt.Fprint(w, `{"Volumes": []}`)
+		case p == "/volumes/shop_db_data":
+			fmt.Fprint(w, `{"Name": "shop_db_data"}`)
+		case p == "/containers/json":
+			fmt.Fprint(w, `[{"Id": "abc", "State": "running"}]`)
+		case p == "/containers/abc/json":
+			mu.Lock()
+			status := "starting"
+			if healthy {
+				status = "healthy"
+			}
+			mu.Unlock()
+			fmt.Fprintf(w, `{"Id": "abc", "State": {"Status": "running", "Running": true, "Health": {"Status": %q}},
+				"Config": {"Image": "postgres:16", "Labels": {"com.docker.compose.service": "db"}}}`, status)
+		case p == "/containers/create":
+			fmt.Fprint(w, `{"Id": "helper"}`)
+		case p == "/containers/helper/archive":
+			w.Write(archive)
+		case p == "/containers/helper":
+			w.WriteHeader(http.StatusNoContent)
+		case p == "/events":
+			if !strings.Contains(log(), "start db") {
+				t.Error("waiting for health before the DB was started again")
+			}
+			w.WriteHeader(http.StatusOK)
+			w.(http.Flusher).Flush()
+			time.Sleep(50 * time.Millisecond) // the server is still starting up
+			mu.Lock()
+			healthy = true
+			mu.Unlock()
+			fmt.Fprintln(w, `{"Type": "container", "Action": "health_status: healthy", "Actor": {"ID": "abc"}}`)
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+		default:
+			t.Errorf("unexpected %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	meta, err := safetySnapshot(dbTarget{Project: "shop", ComposeFile: "compose.yml", Service: "db", Volume: "db_data"}, "dbDrop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if !healthy {
+		t.Error("returned before the DB was healthy again")
+	}
+	lines := strings.Split(strings.TrimSpace(log()), "\n")
+	if len(lines) != 2 || !strings.HasSuffix(lines[0], "stop db") || !strings.HasSuffix(lines[1], "start db") {
+		t.Errorf("compose calls = %q, want stop then start", lines)
+	}
+	if meta == nil || !meta.Auto || meta.Image != "postgres:16" || meta.SizeBytes == 0 {
+		t.Errorf("meta = %+v", meta)
+	}
+}
+
+func TestTakeSnapshotHelperImage(t *testing.T) {
+	tests := []struct {
+		name    string
+		service string // db_service in the compose file
+		want    string
+		pull    bool
+	}{
+		{"compose image", "image: postgres:16-alpine", "postgres:16-alpine", false},
+		{"build only", "build: .", snapshotHelperImage, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var created, pulled []string
+			archive := volumeTar(t)
+			log := fakeSnapshotEnv(t, func(w http.ResponseWriter, r *http.Request) {
+				p := strings.TrimPrefix(r.URL.Path, "/"+dockerAPIVersion)
+				switch p {
+				case "/volumes":
+					fmt.Fprint(w, `{"Volumes": []}`)
+				case "/volumes/shop_db_data":
+					fmt.Fprint(w, `{"Name": "shop_db_data"}`)
+				case "/containers/json":
+					fmt.Fprint(w, `[]`) // composeDown removed the container
+				case "/images/create":
+					pulled = append(pulled, r.URL.Query().Get("fromImage"))
+					fmt.Fprintln(w, `{"status": "Pulling from library/busybox"}`)
+					fmt.Fprintln(w, `{"status": "Download complete"}`)
+				case "/containers/create":
+					var cfg struct{ Image string }
+					json.NewDecoder(r.Body).Decode(&cfg)
+					created = append(created, cfg.Image)
+					if tt.pull && len(pulled) == 0 {
+						w.WriteHeader(http.StatusNotFound)
+						fmt.Fprintf(w, `{"message": "No such image: %s"}`, cfg.Image)
+						return
+					}
+					fmt.Fprint(w, `{"Id": "helper"}`)
+				case "/containers/helper/archive":
+					w.Write(archive)
+				case "/containers/helper":
+					w.WriteHeader(http.StatusNoContent)
+				default:
+					t.Errorf("unexpected %s %s", r.Method, r.URL.Path)
+					w.WriteHeader(http.StatusNotFound)
+				}
+			})
+			compose := filepath.Join(os.Getenv("APP_DIR"), "compose.yml")
+			if err := os.WriteFile(compose, []byte("services:\n  db:\n    "+tt.service+"\n"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			meta, err := safetySnapshot(dbTarget{Project: "shop", ComposeFile: compose, Service: "db", Volume: "db_data"}, "dbReset")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if meta.Image != tt.want || created[len(created)-1] != tt.want {
+				t.Errorf("image = %q (created %q), want %q", meta.Image, created, tt.want)
+			}
+			if got := len(pulled) > 0; got != tt.pull || (tt.pull && pulled[0] != tt.want) {
+				t.Errorf("pulled = %q, want pull %v", pulled, tt.pull)
+			}
+			if l := log(); l != "" {
+				t.Errorf("compose calls = %q, want none (nothing was running)", l)
+			}
+		})
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+)
+
+// ---------- Running SQL through the DB container's CLI client ----------
+
+// sqlCommand is the engine's CLI client in batch mode: script on stdin,
+// unaligned/tab-separated rows without headers on stdout, stop on first error.
+func sqlCommand(c dbCreds) []string {
+	if c.Kind == "mysql" {
+		return []string{"mysql", "-u", c.User, "-N", "-B", c.Database}
+	}
+	return []string{"psql", "-U", c.User, "-d", c.Database, "-X", "-q", "-A", "-t", "-F", "\t", "-v", "ON_ERROR_STOP=1"}
+}
+
+// runSQL executes a script inside db_service (compose exec -T) and returns stdout.
+func runSQL(t dbTarget, c dbCreds, script string) (string, error) {
+	var out bytes.Buffer
+	err := streamComposeWithEnv(execEnv(c), strings.NewReader(script), &out, execArgs(t, c, sqlCommand(c)...)...)
+	return out.String(), err
+}
+
+// sqlLines splits client output into non-empty rows.
+func sqlLines(out string) []string {
+	var rows []string
+	for _, l := range strings.Split(out, "\n") {
+		if l = strings.TrimRight(l, "\r"); strings.TrimSpace(l) != "" {
+			rows = append(rows, l)
+		}
+	}
+	return rows
+}
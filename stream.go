@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// ---------- Streaming Messages API (server-sent events) ----------
+
+// streamingEnabled is ANTHROPIC_STREAM (default on).
+func streamingEnabled() bool { return os.Getenv("ANTHROPIC_STREAM") != "0" }
+
+// streamEvent is the data of one SSE event; only the fields we use.
+type streamEvent struct {
+	Type         string        `json:"type"`
+	Index        int           `json:"index"`
+	ContentBlock *ContentBlock `json:"content_block"`
+	Delta        struct {
+		Type        string `json:"type"`
+		Text        string `json:"text"`
+		PartialJSON string `json:"partial_json"`
+	} `json:"delta"`
+	Error *struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// streamAnthropic sends req with stream=true. onText gets text as it arrives,
+// onBlock each content block as soon as it is complete (tool_use with its full
+// input), so tools can run while the rest of the response streams in.
+func streamAnthropic(key, url string, req MessageReq, onText func(string), onBlock func(ContentBlock)) (*MessageResp, error) {
+	req.Stream = true
+	b, _ := json.Marshal(req)
+	httpReq, _ := http.NewRequest("POST", url, bytes.NewReader(b))
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Accept", "text/event-stream")
+	httpReq.Header.Set("x-api-key", key)
+	httpReq.Header.Set("anthropic-version", "2023-06-01")
+	res, err := http.DefaultClient.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 300 {
+		body, _ := io.ReadAll(res.Body)
+		return nil, fmt.Errorf("status %d: %s", res.StatusCode, string(body))
+	}
+	return readStream(res.Body, onText, onBlock)
+}
+
+// readStream assembles the response from the event stream.
+func readStream(r io.Reader, onText func(string), onBlock func(ContentBlock)) (*MessageResp, error) {
+	var (
+		out    MessageResp
+		blocks = map[int]*ContentBlock{}
+		inputs = map[int]*strings.Builder{}
+		order  []int
+	)
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	var data strings.Builder
+	for sc.Scan() {
+		line := sc.Text()
+		if v, ok := strings.CutPrefix(line, "data:"); ok {
+			data.WriteString(strings.TrimPrefix(v, " "))
+			continue
+		}
+		if line != "" || data.Len() == 0 {
+			continue // event:/id: lines and comments; the type is in the data too
+		}
+		var ev streamEvent
+		err := json.Unmarshal([]byte(data.String()), &ev)
+		data.Reset()
+		if err != nil {
+			return nil, fmt.Errorf("stream: %w", err)
+		}
+
+		switch ev.Type {
+		case "content_block_start":
+			if ev.ContentBlock == nil {
+				continue
+			}
+			blk := *ev.ContentBlock
+			blk.Input = nil // "{}" placeholder; the real input arrives as deltas
+			blocks[ev.Index], inputs[ev.Index] = &blk, &strings.Builder{}
+			order = append(order, ev.Index)
+			if blk.Text != "" && onText != nil {
+				onText(blk.Text)
+			}
+		case "content_block_delta":
+			blk := blocks[ev.Index]
+			if blk == nil {
+				continue
+			}
+			switch ev.Delta.Type {
+			case "text_delta":
+				blk.Text += ev.Delta.Text
+				if onText != nil {
+					onText(ev.Delta.Text)
+				}
+			case "input_json_delta":
+				inputs[ev.Index].WriteString(ev.Delta.PartialJSON)
+			}
+		case "content_block_stop":
+			blk := blocks[ev.Index]
+			if blk == nil {
+				continue
+			}
+			if blk.Type == "tool_use" {
+				in := inputs[ev.Index].String()
+				if in == "" {
+					in = "{}"
+				}
+				blk.Input = json.RawMessage(in)
+			}
+			if onBlock != nil {
+				onBlock(*blk)
+			}
+		case "error":
+			if ev.Error != nil {
+				return nil, fmt.Errorf("stream error %s: %s", ev.Error.Type, ev.Error.Message)
+			}
+			return nil, fmt.Errorf("stream error")
+		case "message_stop":
+			for _, i := range order {
+				out.Content = append(out.Content, *blocks[i])
+			}
+			return &out, nil
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("stream ended before message_stop")
+}
+
+// ---------- Live tool output ----------
+
+// liveOutput, when set, also receives the output of commands as they run
+// (compose up progress, seed steps), so long calls don't look stuck.
+var liveOutput io.Writer
+
+// liveTee returns w, plus liveOutput when live output is on.
+func liveTee(w io.Writer) io.Writer {
+	if liveOutput == nil {
+		return w
+	}
+	return io.MultiWriter(w, liveOutput)
+}
+
+// liveOutputEnabled is LIVE_OUTPUT (default: on when stderr is a terminal).
+func liveOutputEnabled() bool {
+	switch os.Getenv("LIVE_OUTPUT") {
+	case "0":
+		return false
+	case "1":
+		return true
+	}
+	st, err := os.Stderr.Stat()
+	return err == nil && st.Mode()&os.ModeCharDevice != 0
+}
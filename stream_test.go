@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// sseServer serves the given events as one text/event-stream response,
+// flushing after each so the client sees them arrive separately.
+func sseServer(t *testing.T, events ...string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req MessageReq
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || !req.Stream {
+			t.Errorf("request: stream=%v err=%v", req.Stream, err)
+		}
+		if r.Header.Get("x-api-key") != "test-key" {
+			t.Errorf("x-api-key = %q", r.Header.Get("x-api-key"))
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, e := range events {
+			fmt.Fprint(w, e+"\n\n")
+			w.(http.Flusher).Flush()
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func sse(typ, data string) string { return "event: " + typ + "\ndata: " + data }
+
+func TestStreamAnthropicAssemblesBlocks(t *testing.T) {
+	srv := sseServer(t,
+		sse("message_start", `{"type":"message_start","message":{"role":"assistant"}}`),
+		sse("content_block_start", `{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`),
+		sse("ping", `{"type":"ping"}`),
+		sse("content_block_delta", `{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Starting "}}`),
+		": keep-alive comment",
+		sse("content_block_delta", `{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"the DB."}}`),
+		sse("content_block_stop", `{"type":"content_block_stop","index":0}`),
+		sse("content_block_start", `{"type":"content_block_start","index":1,"content_block":{"type":"tool_use","id":"tu_1","name":"composeUp","input":{}}}`),
+		sse("content_block_delta", `{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":""}}`),
+		sse("content_block_delta", `{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"{\"services\": [\"d"}}`),
+		sse("content_block_delta", `{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"b\"]}"}}`),
+		sse("content_block_stop", `{"type":"content_block_stop","index":1}`),
+		sse("message_delta", `{"type":"message_delta","delta":{"stop_reason":"tool_use"}}`),
+		sse("message_stop", `{"type":"message_stop"}`),
+	)
+
+	var order []string
+	resp, err := streamAnthropic("test-key", srv.URL, MessageReq{Model: "m"},
+		func(s string) { order = append(order, "text:"+s) },
+		func(b ContentBlock) { order = append(order, "block:"+b.Type) })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantOrder := []string{"text:Starting ", "text:the DB.", "block:text", "block:tool_use"}
+	if !reflect.DeepEqual(order, wantOrder) {
+		t.Errorf("callbacks = %q, want %q", order, wantOrder)
+	}
+	if len(resp.Content) != 2 {
+		t.Fatalf("content = %+v, want 2 blocks", resp.Content)
+	}
+	if b := resp.Content[0]; b.Type != "text" || b.Text != "Starting the DB." {
+		t.Errorf("text block = %+v", b)
+	}
+	b := resp.Content[1]
+	if b.Type != "tool_use" || b.ID != "tu_1" || b.Name != "composeUp" {
+		t.Errorf("tool_use block = %+v", b)
+	}
+	var in map[string]any
+	if err := json.Unmarshal(b.Input, &in); err != nil {
+		t.Fatalf("input %s: %v", b.Input, err)
+	}
+	if !reflect.DeepEqual(in, map[string]any{"services": []any{"db"}}) {
+		t.Errorf("input = %v", in)
+	}
+}
+
+func TestStreamAnthropicEmptyToolInput(t *testing.T) {
+	srv := sseServer(t,
+		sse("content_block_start", `{"type":"content_block_start","index":0,"content_block":{"type":"tool_use","id":"tu_1","name":"listProfiles","input":{}}}`),
+		sse("content_block_stop", `{"type":"content_block_stop","index":0}`),
+		sse("message_stop", `{"type":"message_stop"}`),
+	)
+	resp, err := streamAnthropic("test-key", srv.URL, MessageReq{}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(resp.Content[0].Input); got != "{}" {
+		t.Errorf("input = %q, want {}", got)
+	}
+}
+
+func TestStreamAnthropicErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		events []string
+		want   string
+	}{
+		{"error event", []string{
+			sse("message_start", `{"type":"message_start","message":{}}`),
+			sse("error", `{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`),
+		}, "overloaded_error: Overloaded"},
+		{"truncated", []string{
+			sse("message_start", `{"type":"message_start","message":{}}`),
+			sse("content_block_start", `{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`),
+			sse("content_block_delta", `{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hal"}}`),
+		}, "before message_stop"},
+		{"bad json", []string{"data: {not json"}, "stream:"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := sseServer(t, tt.events...)
+			resp, err := streamAnthropic("test-key", srv.URL, MessageReq{}, nil, nil)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("err = %v (resp %+v), want %q", err, resp, tt.want)
+			}
+		})
+	}
+}
+
+func TestStreamAnthropicHTTPError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"type":"error","error":{"type":"authentication_error"}}`, http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+	_, err := streamAnthropic("bad", srv.URL, MessageReq{}, nil, nil)
+	if err == nil || !strings.Contains(err.Error(), "status 401") {
+		t.Fatalf("err = %v, want status 401", err)
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// ---------- Branch DB tool ----------
+
+func registerBranchTools() {
+	tools["branchDB"] = Tool{
+		Decl: ToolDecl{
+			Name:        "branchDB",
+			Description: `Per-git-branch DBs (BRANCH_MODE=1): each branch of APP_DIR gets its own compose project <PROJECT>-<branch> and so its own volume; the main branch keeps <PROJECT>. action: list (branch DBs, running/current/stale), switch (stop the other branch DBs, start this branch's and wait healthy), clone (copy the main branch's DB into this branch's; replacing an existing branch DB requires confirm_phrase="CLONE <branch project>"), gc (remove DBs whose branch no longer exists and that the agent labeled as branch DBs of PROJECT; without confirm_phrase only lists them, with confirm_phrase="GC <PROJECT>" takes a safety snapshot of each and deletes them). Optional: branch (default: the checked-out branch).`,
+			InputSchema: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"compose_file":   map[string]any{"type": "string"},
+					"db_service":     map[string]any{"type": "string"},
+					"db_volume":      map[string]any{"type": "string"},
+					"action":         map[string]any{"type": "string", "enum": []string{"list", "switch", "clone", "gc"}},
+					"branch":         map[string]any{"type": "string"},
+					"confirm_phrase": map[string]any{"type": "string"},
+				},
+				"required":             []string{"compose_file", "db_service", "action"},
+				"additionalProperties": false,
+			},
+		},
+		Call: func(a map[string]any) (string, bool, error) {
+			if os.Getenv("ENSURE_DOCKER_AUTO") != "0" {
+				if _, err := ensureDockerReady(); err != nil {
+					return "", true, err
+				}
+			}
+
+			// branch DBs hang off the configured PROJECT, not the derived one
+			base := os.Getenv("PROJECT")
+			a["project"] = base
+			t, err := targetArgs(a)
+			if err != nil {
+				return "", true, err
+			}
+			action, _ := a["action"].(string)
+			branch, _ := a["branch"].(string)
+			confirm, _ := a["confirm_phrase"].(string)
+			if t.Volume == "" && action != "switch" {
+				return "", true, errors.New("DB_VOLUME is not set; branch DBs are told apart by their volume")
+			}
+
+			main := mainBranch()
+			if branch == "" {
+				branch = currentBranch()
+			}
+			// the derived name goes through the same checks as a configured one
+			bt := t
+			bt.Project = branchProject(base, branch, main)
+			if err := safeProject(bt.Project); err != nil {
+				return "", true, err
+			}
+
+			extra := readDotenv(os.Getenv("APP_ENV_FILE"))
+			switch action {
+			case "list":
+				dbs, err := listBranchDBs(base, t.Service, t.Volume)
+				if err != nil {
+					return "", true, err
+				}
+				return j(map[string]any{"main_branch": main, "current_branch": currentBranch(), "branch_mode": branchMode(), "databases": dbs}), false, nil
+
+			case "switch":
+				if dryRun {
+					return j(map[string]any{"status": "dry-run", "would_switch_to": bt.Project}), false, nil
+				}
+				var stopped []string
+				if t.Volume != "" {
+					dbs, err := listBranchDBs(base, t.Service, t.Volume)
+					if err != nil {
+						return "", true, err
+					}
+					for _, d := range dbs {
+						if d.Running && d.Project != bt.Project {
+							if _, err := runComposeWithEnv(extra, "-p", d.Project, "-f", t.ComposeFile, "stop", t.Service); err != nil {
+								return "", true, err
+							}
+							stopped = append(stopped, d.Project)
+						}
+					}
+				}
+				if bt.Project != base {
+					if err := markBranchProject(extra, base, bt); err != nil {
+						return "", true, err
+					}
+				}
+				if _, err := runComposeLive(extra, append(composeFileArgs(bt.Project, bt.ComposeFile), "up", "-d", bt.Service)...); err != nil {
+					return "", true, err
+				}
+				id, err := containerID(bt.Project, bt.Service)
+				if err != nil {
+					return "", true, err
+				}
+				ctx, cancel := context.WithTimeout(context.Background(), 180*time.Second)
+				defer cancel()
+				hr, err := waitForHealth(ctx, id)
+				if err != nil {
+					return j(hr), true, err
+				}
+				return j(map[string]any{"status": "switched", "branch": branch, "project": bt.Project, "stopped": stopped, "health": hr}), false, nil
+
+			case "clone":
+				src := t
+				src.Project = base
+				if bt.Project == src.Project {
+					return "", true, fmt.Errorf("branch %q already uses the main DB (%s)", branch, base)
+				}
+				ctx, cancel := context.WithTimeout(context.Background(), defaultAPITimeout)
+				_, verr := engine.VolumeInspect(ctx, dbVolumeName(bt.Project, bt.Volume))
+				cancel()
+				exists := verr == nil
+				if exists {
+					expect := "CLONE " + bt.Project
+					if confirm != expect {
+						return "", true, fmt.Errorf("%s already has a DB; confirmation mismatch; expected %q", bt.Project, expect)
+					}
+				}
+				if dryRun {
+					return j(map[string]any{"status": "dry-run", "would_clone": base, "into": bt.Project}), false, nil
+				}
+				var snap *snapshotMeta
+				if exists {
+					if snap, err = safetySnapshot(bt, "branchDB clone"); err != nil {
+						return "", true, err
+					}
+				}
+				hr, err := cloneDB(src, bt)
+				if err != nil {
+					return j(hr), true, err
+				}
+				return j(map[string]any{"status": "cloned", "from": base, "into": bt.Project, "branch": branch, "safety_snapshot": snapName(snap), "health": hr}), false, nil
+
+			case "gc":
+				dbs, err := listBranchDBs(base, t.Service, t.Volume)
+				if err != nil {
+					return "", true, err
+				}
+				// only labeled projects, and only if none of their containers is someone else's
+				var stale []string
+				skipped := map[string]string{}
+				for _, d := range dbs {
+					if !d.Stale || !d.Labeled {
+						continue
+					}
+					if c := unlabeledContainer(d.Project, base); c != "" {
+						skipped[d.Project] = "container " + c + " has no " + branchLabel + "=" + base + " label"
+						continue
+					}
+					stale = append(stale, d.Project)
+				}
+				expect := "GC " + base
+				if confirm != expect || dryRun {
+					return j(map[string]any{"status": "would-remove", "projects": stale, "skipped": skipped, "confirm_with": expect}), false, nil
+				}
+				var removed, snaps []string
+				for _, p := range stale {
+					if err := safeProject(p); err != nil {
+						return "", true, err
+					}
+					pt := t
+					pt.Project = p
+					snap, err := safetySnapshot(pt, "branchDB gc")
+					if err != nil {
+						return j(map[string]any{"removed": removed, "safety_snapshots": snaps}), true, fmt.Errorf("%s: %w", p, err)
+					}
+					if snap != nil {
+						snaps = append(snaps, p+"/"+snap.Name)
+					}
+					if _, err := runComposeWithEnv(extra, "-p", p, "-f", t.ComposeFile, "down", "-v", "--remove-orphans"); err != nil {
+						return j(map[string]any{"removed": removed, "safety_snapshots": snaps}), true, fmt.Errorf("%s: %w", p, err)
+					}
+					os.Remove(branchOverridePath(p))
+					removed = append(removed, p)
+				}
+				return j(map[string]any{"status": "gc-complete", "removed": removed, "skipped": skipped, "safety_snapshots": snaps}), false, nil
+			}
+			return "", true, fmt.Errorf("unknown action %q (list|switch|clone|gc)", action)
+		},
+	}
+}
+
+// unlabeledContainer returns a container of project that isn't labeled as a
+// branch DB of base, or "" if there is none.
+func unlabeledContainer(project, base string) string {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultAPITimeout)
+	defer cancel()
+	cs, err := engine.ContainerList(ctx, true, "com.docker.compose.project="+project)
+	if err != nil {
+		return "(" + err.Error() + ")"
+	}
+	for _, c := range cs {
+		if c.Labels[branchLabel] != base {
+			if len(c.Names) > 0 {
+				return strings.TrimPrefix(c.Names[0], "/")
+			}
+			return c.ID
+		}
+	}
+	return ""
+}
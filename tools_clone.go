@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// ---------- Database fork tools (Postgres) ----------
+
+func registerCloneTools() {
+	tools["dbList"] = Tool{
+		Decl: ToolDecl{
+			Name:        "dbList",
+			Description: "List the databases inside the running Postgres (size, open connections, which one the app uses).",
+			InputSchema: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"project":      map[string]any{"type": "string"},
+					"compose_file": map[string]any{"type": "string"},
+					"db_service":   map[string]any{"type": "string"},
+				},
+				"required":             []string{"project", "compose_file", "db_service"},
+				"additionalProperties": false,
+			},
+		},
+		Call: func(a map[string]any) (string, bool, error) {
+			if os.Getenv("ENSURE_DOCKER_AUTO") != "0" {
+				if _, err := ensureDockerReady(); err != nil {
+					return "", true, err
+				}
+			}
+			t, c, err := cloneTarget(a)
+			if err != nil {
+				return "", true, err
+			}
+			dbs, err := listDatabases(t, c)
+			if err != nil {
+				return "", true, err
+			}
+			return j(dbs), false, nil
+		},
+	}
+
+	tools["dbClone"] = Tool{
+		Decl: ToolDecl{
+			Name:        "dbClone",
+			Description: "Fork a database inside the running Postgres with CREATE DATABASE <name> TEMPLATE <source> (a file-level copy, fast even for big fixtures). Required: name. Optional: source (default: the app's database), disconnect (terminate other sessions on source first, e.g. the running app; default false).",
+			InputSchema: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"project":      map[string]any{"type": "string"},
+					"compose_file": map[string]any{"type": "string"},
+					"db_service":   map[string]any{"type": "string"},
+					"name":         map[string]any{"type": "string"},
+					"source":       map[string]any{"type": "string"},
+					"disconnect":   map[string]any{"type": "boolean"},
+				},
+				"required":             []string{"project", "compose_file", "db_service", "name"},
+				"additionalProperties": false,
+			},
+		},
+		Call: func(a map[string]any) (string, bool, error) {
+			if os.Getenv("ENSURE_DOCKER_AUTO") != "0" {
+				if _, err := ensureDockerReady(); err != nil {
+					return "", true, err
+				}
+			}
+			t, c, err := cloneTarget(a)
+			if err != nil {
+				return "", true, err
+			}
+			name, _ := a["name"].(string)
+			source, _ := a["source"].(string)
+			disconnect, _ := a["disconnect"].(bool)
+			if source == "" {
+				source = c.Database
+			}
+			for _, n := range []string{name, source} {
+				if err := safeDBName(n); err != nil {
+					return "", true, err
+				}
+			}
+			if contains(systemDBs, name) || name == c.Database {
+				return "", true, fmt.Errorf("refusing to clone over %q", name)
+			}
+
+			if dryRun {
+				return j(map[string]any{"status": "dry-run", "would_clone": source, "into": name}), false, nil
+			}
+			start := time.Now()
+			if err := cloneDatabase(t, c, source, name, disconnect); err != nil {
+				return "", true, err
+			}
+			return j(map[string]any{"status": "cloned", "source": source, "database": name, "duration": time.Since(start).Round(time.Millisecond).String()}), false, nil
+		},
+	}
+
+	tools["dbDrop"] = Tool{
+		Decl: ToolDecl{
+			Name:        "dbDrop",
+			Description: `Destructive: drop a database inside the running Postgres (e.g. a fork made by dbClone). The app's own database and postgres/template0/template1 are refused; use dbReset for the app's database. Requires confirm_phrase="DROP <project>/<name>". Takes a safety snapshot of the DB volume first (undo brings the database back). Optional: force (disconnect remaining sessions, Postgres 13+).`,
+			InputSchema: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"project":        map[string]any{"type": "string"},
+					"compose_file":   map[string]any{"type": "string"},
+					"db_service":     map[string]any{"type": "string"},
+					"db_volume":      map[string]any{"type": "string"},
+					"name":           map[string]any{"type": "string"},
+					"force":          map[string]any{"type": "boolean"},
+					"confirm_phrase": map[string]any{"type": "string"},
+				},
+				"required":             []string{"project", "compose_file", "db_service", "name", "confirm_phrase"},
+				"additionalProperties": false,
+			},
+		},
+		Call: func(a map[string]any) (string, bool, error) {
+			if os.Getenv("ENSURE_DOCKER_AUTO") != "0" {
+				if _, err := ensureDockerReady(); err != nil {
+					return "", true, err
+				}
+			}
+			t, c, err := cloneTarget(a)
+			if err != nil {
+				return "", true, err
+			}
+			name, _ := a["name"].(string)
+			force, _ := a["force"].(bool)
+			confirm, _ := a["confirm_phrase"].(string)
+
+			if err := safeDBName(name); err != nil {
+				return "", true, err
+			}
+			if contains(systemDBs, name) || name == c.Database {
+				return "", true, fmt.Errorf("refusing to drop %q", name)
+			}
+			expect := "DROP " + t.Project + "/" + name
+			if confirm != expect {
+				return "", true, fmt.Errorf("confirmation mismatch; expected %q", expect)
+			}
+
+			if dryRun {
+				return j(map[string]any{"status": "dry-run", "would_drop": name}), false, nil
+			}
+			snap, err := safetySnapshot(t, "dbDrop")
+			if err != nil {
+				return "", true, err
+			}
+			if err := dropDatabase(t, c, name, force); err != nil {
+				return "", true, err
+			}
+			return j(map[string]string{"status": "dropped", "database": name, "safety_snapshot": snapName(snap)}), false, nil
+		},
+	}
+}
+
+// cloneTarget resolves the DB target and its Postgres credentials.
+func cloneTarget(a map[string]any) (dbTarget, dbCreds, error) {
+	t, err := targetArgs(a)
+	if err != nil {
+		return t, dbCreds{}, err
+	}
+	kind, err := detectDBKind(t, "")
+	if err != nil {
+		return t, dbCreds{}, err
+	}
+	c := credentialsFor(kind, readDotenv(os.Getenv("APP_ENV_FILE")))
+	if kind != "postgres" {
+		return t, c, fmt.Errorf("database forks need Postgres (db_service runs %s)", kind)
+	}
+	return t, c, nil
+}
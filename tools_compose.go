@@ -0,0 +1,82 @@
+package main
+
+import (
+	"os"
+	"sort"
+)
+
+// ---------- Compose file validation tool ----------
+
+func registerComposeTools() {
+	tools["validate"] = Tool{
+		Decl: ToolDecl{
+			Name:        "validate",
+			Description: "Parse the compose file the way compose would (${VAR} interpolation with APP_ENV_FILE values, extends, profiles from COMPOSE_PROFILES) without running anything, and check what the agent relies on: db_service exists and is active, has a healthcheck, mounts the named volume db_volume (declared at the top level), its image gets the credentials it needs, every referenced variable is set, and APP_ENV_FILE parses. Returns findings {level: error|warning, code, service, path, message, fix}. Optional: compose_file, db_service, db_volume, profiles (list; default COMPOSE_PROFILES).",
+			InputSchema: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"compose_file": map[string]any{"type": "string"},
+					"db_service":   map[string]any{"type": "string"},
+					"db_volume":    map[string]any{"type": "string"},
+					"profiles":     map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+				},
+				"additionalProperties": false,
+			},
+		},
+		Call: func(a map[string]any) (string, bool, error) {
+			composeFile, _ := a["compose_file"].(string)
+			service, _ := a["db_service"].(string)
+			volKey, _ := a["db_volume"].(string)
+			if composeFile == "" {
+				composeFile = os.Getenv("COMPOSE_FILE")
+			}
+			if service == "" {
+				service = os.Getenv("DB_SERVICE")
+			}
+			if volKey == "" {
+				volKey = os.Getenv("DB_VOLUME")
+			}
+			if err := safeComposePath(composeFile); err != nil {
+				return "", true, err
+			}
+			if err := safeService(service); err != nil {
+				return "", true, err
+			}
+
+			env := composeEnv()
+			if l, ok := a["profiles"].([]any); ok {
+				env["COMPOSE_PROFILES"] = ""
+				for i, v := range l {
+					if s, ok := v.(string); ok {
+						if i > 0 {
+							env["COMPOSE_PROFILES"] += ","
+						}
+						env["COMPOSE_PROFILES"] += s
+					}
+				}
+			}
+			p, err := loadCompose(composeFile, env)
+			if err != nil {
+				return "", true, err
+			}
+			p.validateDB(service, volKey)
+			p.validateEnvFiles()
+
+			names := make([]string, 0, len(p.Services))
+			for n := range p.Services {
+				names = append(names, n)
+			}
+			sort.Strings(names)
+			findings := p.sortedFindings()
+			return j(map[string]any{
+				"file":            composeFile,
+				"services":        names,
+				"db_service":      service,
+				"db_volume":       volKey,
+				"active_profiles": p.Profiles,
+				"ok":              composeErrors(findings) == nil,
+				"findings":        findings,
+			}), false, nil
+		},
+	}
+}
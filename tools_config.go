@@ -0,0 +1,47 @@
+package main
+
+import "sort"
+
+// ---------- Config profile tools ----------
+
+func registerConfigTools() {
+	tools["listProfiles"] = Tool{
+		Decl: ToolDecl{
+			Name:        "listProfiles",
+			Description: "List the named profiles of the config file (compose-db-agent.yaml in the working directory or a parent, or AGENT_CONFIG): project, compose_file, db_service, db_volume, app_dir, app_env_file, seed_file, migrations_dir, snapshot_dir and the names of extra env settings. Marks the active and default profile. Switching profiles means restarting with --profile <name>.",
+			InputSchema: map[string]any{
+				"type":                 "object",
+				"properties":           map[string]any{},
+				"additionalProperties": false,
+			},
+		},
+		Call: func(a map[string]any) (string, bool, error) {
+			if activeConfig == nil {
+				return j(map[string]any{"config": nil, "profiles": []any{}, "note": "no config file found; settings come from the environment"}), false, nil
+			}
+			type row struct {
+				Name string `json:"name"`
+				*agentProfile
+				EnvKeys []string `json:"env_keys,omitempty"` // values may be secrets
+				Active  bool     `json:"active,omitempty"`
+				Default bool     `json:"default,omitempty"`
+			}
+			var rows []row
+			for _, n := range activeConfig.profileNames() {
+				p := activeConfig.Profiles[n]
+				r := row{Name: n, agentProfile: p, Active: n == activeProfile, Default: n == activeConfig.Default}
+				for k := range p.Env {
+					r.EnvKeys = append(r.EnvKeys, k)
+				}
+				sort.Strings(r.EnvKeys)
+				rows = append(rows, r)
+			}
+			return j(map[string]any{
+				"config":   activeConfig.Path,
+				"active":   activeProfile,
+				"default":  activeConfig.Default,
+				"profiles": rows,
+			}), false, nil
+		},
+	}
+}
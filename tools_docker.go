@@ -10,6 +10,7 @@ import (
 	"io"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"regexp"
 	"strings"
 	"time"
@@ -52,6 +53,17 @@ var composeBase []string
 func init() {
 	composeBase = detectCompose()
 	registerTools()
+	registerSnapshotTools()
+	registerDumpTools()
+	registerMigrateTools()
+	registerSeedTools()
+	registerQueryTools()
+	registerSchemaTools()
+	registerBranchTools()
+	registerCloneTools()
+	registerEngineTools()
+	registerComposeTools()
+	registerConfigTools()
 }
 
 func detectCompose() []string {
@@ -84,25 +96,60 @@ func checkCmd(name string, args ...string) error {
 	return cmd.Run()
 }
 
-func runCompose(args ...string) (string, error) {
-	if len(composeBase) == 2 {
-		// docker compose …
-		return run(composeBase[0], append([]string{composeBase[1]}, args...)...)
+func runComposeWithEnv(extra map[string]string, args ...string) (string, error) {
+	name, argv := composeCmd(args)
+	return runWithEnv(extra, name, argv...)
+}
+
+// runComposeLive is runComposeWithEnv for slow commands (up: pulls, builds,
+// starts), showing their progress as it happens when live output is on.
+func runComposeLive(extra map[string]string, args ...string) (string, error) {
+	name, argv := composeCmd(args)
+	return runEnv(extra, true, name, argv...)
+}
+
+// Like runComposeWithEnv, but wires stdin/stdout straight through (dumps, loads).
+// Only stderr is buffered, for the error message.
+func streamComposeWithEnv(extra map[string]string, stdin io.Reader, stdout io.Writer, args ...string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Minute)
+	defer cancel()
+	return streamComposeContext(ctx, extra, stdin, stdout, args...)
+}
+
+// streamComposeContext is streamComposeWithEnv with a caller-chosen deadline.
+func streamComposeContext(ctx context.Context, extra map[string]string, stdin io.Reader, stdout io.Writer, args ...string) error {
+	name, argv := composeCmd(args)
+	if dryRun {
+		fmt.Fprintln(os.Stderr, "[dry-run]", name, strings.Join(argv, " "))
+		return nil
 	}
-	// docker-compose …
-	return run(composeBase[0], args...)
+	cmd := exec.CommandContext(ctx, name, argv...)
+	cmd.Env = os.Environ()
+	for k, v := range extra {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+	var errb bytes.Buffer
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = stdin, stdout, &errb
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			err = ctx.Err()
+		}
+		return fmt.Errorf("%s %s: %w\n%s", name, strings.Join(argv, " "), err, errb.String())
+	}
+	return nil
 }
 
-func runComposeWithEnv(extra map[string]string, args ...string) (string, error) {
-	// If APP_DIR is set, act as if we executed from the app repo
+// composeCmd prefixes args with the compose binary and, if APP_DIR is set,
+// --project-directory so we act as if we executed from the app repo.
+func composeCmd(args []string) (string, []string) {
 	appDir := os.Getenv("APP_DIR")
 	if appDir != "" && !contains(args, "--project-directory") {
 		args = append([]string{"--project-directory", appDir}, args...)
 	}
 	if len(composeBase) == 2 {
-		return runWithEnv(extra, composeBase[0], append([]string{composeBase[1]}, args...)...)
+		return composeBase[0], append([]string{composeBase[1]}, args...)
 	}
-	return runWithEnv(extra, composeBase[0], args...)
+	return composeBase[0], args
 }
 
 func contains(sl []string, x string) bool {
@@ -134,6 +181,11 @@ func run(name string, args ...string) (string, error) {
 
 // Like run, but adds environment variables (for compose var substitution)
 func runWithEnv(extra map[string]string, name string, args ...string) (string, error) {
+	return runEnv(extra, false, name, args...)
+}
+
+// runEnv is runWithEnv; live also copies the output to liveOutput as it comes.
+func runEnv(extra map[string]string, live bool, name string, args ...string) (string, error) {
 	cmdLine := name + " " + strings.Join(args, " ")
 	if dryRun {
 		return "[dry-run] " + cmdLine, nil
@@ -147,6 +199,9 @@ func runWithEnv(extra map[string]string, name string, args ...string) (string, e
 	}
 	var out, errb bytes.Buffer
 	cmd.Stdout, cmd.Stderr = &out, &errb
+	if live {
+		cmd.Stdout, cmd.Stderr = liveTee(&out), liveTee(&errb)
+	}
 	if err := cmd.Run(); err != nil {
 		return out.String() + errb.String(), fmt.Errorf("%s: %w\n%s", cmdLine, err, errb.String())
 	}
@@ -185,6 +240,14 @@ func safeProject(p string) error {
 	return nil
 }
 
+// compose service names: same charset as projects
+func safeService(s string) error {
+	if ok, _ := regexp.MatchString(`^[a-zA-Z0-9._-]+$`, s); !ok {
+		return fmt.Errorf("invalid service name: %q", s)
+	}
+	return nil
+}
+
 // allow relative paths; if they contain "..", only allow the exact COMPOSE_FILE from env
 func safeComposePath(p string) error {
 	if strings.Contains(p, "..") {
@@ -196,28 +259,80 @@ func safeComposePath(p string) error {
 	return nil
 }
 
-// Resolve the container ID for a service (works w/ or w/o container_name)
-func containerID(project, composeFile, service string) (string, error) {
-	args := []string{"-p", project}
-	if composeFile != "" {
-		args = append(args, "-f", composeFile)
+// insideDir resolves p (relative to root, or absolute) and refuses anything
+// outside root, also via symlinks in its existing part. what names root in errors.
+func insideDir(root, p, what string) (string, error) {
+	if root == "" {
+		root = "."
+	}
+	rootAbs, err := filepath.Abs(root)
+	if err != nil {
+		return "", err
 	}
-	args = append(args, "ps", "-q", service)
-	out, err := runCompose(args...)
-	id := strings.TrimSpace(out)
+	path := p
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(rootAbs, path)
+	}
+	path = filepath.Clean(path)
+	within := func(root, path string) bool {
+		rel, err := filepath.Rel(root, path)
+		return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+	}
+	if !within(rootAbs, path) {
+		return "", fmt.Errorf("disallowed path: %q (must be inside %s)", p, what)
+	}
+	// the file may not exist yet (outputs): check the nearest existing parent
+	existing := path
+	for {
+		if _, err := os.Lstat(existing); err == nil || existing == rootAbs {
+			break
+		}
+		existing = filepath.Dir(existing)
+	}
+	realRoot, err1 := filepath.EvalSymlinks(rootAbs)
+	real, err2 := filepath.EvalSymlinks(existing)
+	if err1 == nil && err2 == nil && !within(realRoot, real) {
+		return "", fmt.Errorf("disallowed path: %q (leaves %s through a symlink)", p, what)
+	}
+	return path, nil
+}
+
+// Resolve the container ID for a service via compose labels (works w/ or w/o container_name)
+func containerID(project, service string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultAPITimeout)
+	defer cancel()
+	cs, err := engine.ContainerList(ctx, true,
+		"com.docker.compose.project="+project,
+		"com.docker.compose.service="+service,
+	)
 	if err != nil {
 		return "", err
 	}
-	if id == "" {
+	if len(cs) == 0 {
 		return "", fmt.Errorf("no container for service %q (project %q)", service, project)
 	}
-	return id, nil
+	// prefer a running replica
+	for _, c := range cs {
+		if c.State == "running" {
+			return c.ID, nil
+		}
+	}
+	return cs[0].ID, nil
+}
+
+func pingDocker() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return engine.Ping(ctx)
 }
 
 // Ensure Docker daemon is reachable; if not, start Colima and wait.
 func ensureDockerReady() (string, error) {
+	if dryRun {
+		return "ok", nil
+	}
 	// Already up?
-	if _, err := run("docker", "info"); err == nil {
+	if err := pingDocker(); err == nil {
 		return "ok", nil
 	}
 
@@ -235,7 +350,7 @@ func ensureDockerReady() (string, error) {
 	// Wait for Docker
 	deadline := time.Now().Add(90 * time.Second)
 	for time.Now().Before(deadline) {
-		if _, err := run("docker", "info"); err == nil {
+		if err := pingDocker(); err == nil {
 			return "started", nil
 		}
 		time.Sleep(2 * time.Second)
@@ -243,28 +358,75 @@ func ensureDockerReady() (string, error) {
 	return "", fmt.Errorf("docker did not become ready after starting Colima")
 }
 
-// simple dotenv parser (KEY=VALUE lines)
-func readDotenv(path string) map[string]string {
-	env := map[string]string{}
-	if path == "" {
-		return env
+// Services to operate on: explicit "services" list, else db_service (default DB_SERVICE).
+func servicesArg(a map[string]any) ([]string, error) {
+	var out []string
+	if l, ok := a["services"].([]any); ok {
+		for _, v := range l {
+			if s, ok := v.(string); ok && strings.TrimSpace(s) != "" {
+				out = append(out, strings.TrimSpace(s))
+			}
+		}
 	}
-	b, err := os.ReadFile(path)
-	if err != nil {
-		return env
+	if len(out) == 0 {
+		if s, _ := a["db_service"].(string); s != "" {
+			out = []string{s}
+		} else if s := os.Getenv("DB_SERVICE"); s != "" {
+			out = []string{s}
+		}
+	}
+	if len(out) == 0 {
+		return nil, errors.New("no services given and DB_SERVICE is not set")
 	}
-	for _, line := range strings.Split(string(b), "\n") {
-		line = strings.TrimSpace(line)
-		if line == "" || strings.HasPrefix(line, "#") {
-			continue
+	for _, s := range out {
+		if err := safeService(s); err != nil {
+			return nil, err
 		}
-		if i := strings.IndexByte(line, '='); i > 0 {
-			k := strings.TrimSpace(line[:i])
-			v := strings.Trim(strings.TrimSpace(line[i+1:]), `"'`)
-			env[k] = v
+	}
+	return out, nil
+}
+
+// Resolve the docker volume for a compose volume key. Compose labels the volumes
+// it creates, which also covers `name:` overrides; otherwise assume <project>_<key>.
+func dbVolumeName(project, key string) string {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultAPITimeout)
+	defer cancel()
+	vs, err := engine.VolumeList(ctx,
+		"com.docker.compose.project="+project,
+		"com.docker.compose.volume="+key,
+	)
+	if err == nil && len(vs) == 1 {
+		return vs[0].Name
+	}
+	return project + "_" + key
+}
+
+// removeDBVolume deletes only the DB volume; an already-missing volume is not an error.
+func removeDBVolume(project, key string) (string, error) {
+	if key == "" {
+		return "", errors.New("DB_VOLUME is not set; refusing to guess which volume to delete")
+	}
+	name := dbVolumeName(project, key)
+	ctx, cancel := context.WithTimeout(context.Background(), defaultAPITimeout)
+	defer cancel()
+	if err := engine.VolumeRemove(ctx, name, false); err != nil {
+		if isNotFound(err) {
+			return name + " (absent)", nil
 		}
+		return "", fmt.Errorf("remove volume %s: %w", name, err)
+	}
+	return name, nil
+}
+
+// stopServices stops and removes only the given services' containers.
+func stopServices(extra map[string]string, project, composeFile string, services []string) (string, error) {
+	base := []string{"-p", project, "-f", composeFile}
+	out, err := runComposeWithEnv(extra, append(append(base, "stop"), services...)...)
+	if err != nil {
+		return out, err
 	}
-	return env
+	rm, err := runComposeWithEnv(extra, append(append(base, "rm", "-f"), services...)...)
+	return strings.TrimRight(out, "\n") + "\n" + rm, err
 }
 
 // ---------- Tools ----------
@@ -293,13 +455,16 @@ func registerTools() {
 	tools["composeUp"] = Tool{
 		Decl: ToolDecl{
 			Name:        "composeUp",
-			Description: "Start docker compose. Required: project, compose_file. Optional: build (bool)",
+			Description: "Start only the given compose services (default: db_service). Before starting, their published host ports are checked against other containers and listening sockets; a taken port is remapped to the next free one via an override file (reported in port_conflicts), or with remap_ports=false reported as an error naming the holder. Required: project, compose_file. Optional: services (list), build (bool), remap_ports (bool, default PORT_REMAP)",
 			InputSchema: map[string]any{
 				"type": "object",
 				"properties": map[string]any{
 					"project":      map[string]any{"type": "string"},
 					"compose_file": map[string]any{"type": "string"},
+					"db_service":   map[string]any{"type": "string"},
+					"services":     map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
 					"build":        map[string]any{"type": "boolean"}, // default false; forces image rebuild
+					"remap_ports":  map[string]any{"type": "boolean"},
 				},
 				"required":             []string{"project", "compose_file"},
 				"additionalProperties": false,
@@ -323,16 +488,42 @@ func registerTools() {
 				return "", true, err
 			}
 
-			args := []string{"-p", project, "-f", composeFile}
+			services, err := servicesArg(a)
+			if err != nil {
+				return "", true, err
+			}
+			if err := precheckCompose(composeFile, services); err != nil {
+				return "", true, err
+			}
+			remap, ok := a["remap_ports"].(bool)
+			if !ok {
+				remap = portRemapDefault()
+			}
+
+			extra := readDotenv(os.Getenv("APP_ENV_FILE"))
+			conflicts, overrides, err := preflightPorts(extra, project, composeFile, services, remap)
+			if err != nil {
+				return j(map[string]any{"port_conflicts": conflicts}), true, err
+			}
+
+			if err := markIfBranch(extra, dbTarget{project, composeFile, os.Getenv("DB_SERVICE"), os.Getenv("DB_VOLUME")}); err != nil {
+				return "", true, err
+			}
+
+			args := composeFileArgs(project, composeFile)
 
 			args = append(args, "up", "-d")
 			if build {
 				args = append(args, "--build")
 			}
+			args = append(args, services...)
 
-			extra := readDotenv(os.Getenv("APP_ENV_FILE"))
-			out, err := runComposeWithEnv(extra, args...)
-			return j(map[string]string{"output": out}), err != nil, err
+			out, err := runComposeLive(extra, args...)
+			res := map[string]any{"output": out}
+			if len(conflicts) > 0 {
+				res["port_conflicts"], res["port_overrides"] = conflicts, overrides
+			}
+			return j(res), err != nil, err
 		},
 	}
 
@@ -340,12 +531,15 @@ func registerTools() {
 	tools["composeDown"] = Tool{
 		Decl: ToolDecl{
 			Name:        "composeDown",
-			Description: "Stop compose. Required: project, compose_file. Optional: build (bool).",
+			Description: "Stop and remove only the given compose services (default: db_service); other services keep running. Required: project, compose_file. Optional: services (list), remove_volumes (bool; deletes only the <project>_<db_volume> volume, and always stops db_service first).",
 			InputSchema: map[string]any{
 				"type": "object",
 				"properties": map[string]any{
 					"project":        map[string]any{"type": "string"},
 					"compose_file":   map[string]any{"type": "string"},
+					"db_service":     map[string]any{"type": "string"},
+					"db_volume":      map[string]any{"type": "string"},
+					"services":       map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
 					"remove_volumes": map[string]any{"type": "boolean"},
 				},
 				"required":             []string{"project", "compose_file"},
@@ -370,7 +564,7 @@ func registerTools() {
 				}
 			} else {
 				// Not provided → ask interactively (default: no)
-				rmvol = askYesNo("Also delete named volumes? [y/N]: ", false)
+				rmvol = askYesNo("Also delete the DB volume? [y/N]: ", false)
 			}
 
 			if err := safeProject(project); err != nil {
@@ -380,14 +574,49 @@ func registerTools() {
 				return "", true, err
 			}
 
-			args := []string{"-p", project, "-f", composeFile, "down"}
+			services, err := servicesArg(a)
+			if err != nil {
+				return "", true, err
+			}
+			dbVol, _ := a["db_volume"].(string)
+			dbSvc, _ := a["db_service"].(string)
+
 			if rmvol {
-				args = append(args, "-v")
+				// the volume can only go once nothing uses it: always take db_service down too
+				if dbSvc == "" {
+					return "", true, errors.New("DB_SERVICE is not set; don't know which service uses the DB volume")
+				}
+				if err := safeService(dbSvc); err != nil {
+					return "", true, err
+				}
+				if !contains(services, dbSvc) {
+					services = append(services, dbSvc)
+				}
+			}
+
+			res := map[string]string{}
+			if rmvol {
+				snap, err := safetySnapshot(dbTarget{project, composeFile, dbSvc, dbVol}, "composeDown")
+				if err != nil {
+					return "", true, err
+				}
+				res["safety_snapshot"] = snapName(snap)
 			}
 
 			extra := readDotenv(os.Getenv("APP_ENV_FILE"))
-			out, err := runComposeWithEnv(extra, args...)
-			return j(map[string]string{"output": out}), err != nil, err
+			out, err := stopServices(extra, project, composeFile, services)
+			res["output"] = out
+			if err != nil {
+				return j(res), true, err
+			}
+			if rmvol {
+				name, err := removeDBVolume(project, dbVol)
+				if err != nil {
+					return j(res), true, err
+				}
+				res["removed_volume"] = name
+			}
+			return j(res), false, nil
 		},
 	}
 
@@ -395,7 +624,7 @@ func registerTools() {
 	tools["waitHealthy"] = Tool{
 		Decl: ToolDecl{
 			Name:        "waitHealthy",
-			Description: "Poll container health until healthy. Required: project, service. Optional: timeout_sec, compose_file.",
+			Description: "Wait for a service's container to become healthy. Returns early if it exits, is OOM-killed or restarts (with exit code and last healthcheck output). Services without a Docker healthcheck are probed instead: the engine's own check (pg_isready, mysqladmin ping, ...), the published TCP port, or a log regex. status is healthy, unhealthy, starting (still in its start period at the timeout) or no-healthcheck (nothing to probe; the container is running). Required: project, service. Optional: timeout_sec, compose_file, probe (auto|healthcheck|exec|tcp[:port]|log:<regex>|none; default READY_PROBE_<SERVICE> or auto).",
 			InputSchema: map[string]any{
 				"type": "object",
 				"properties": map[string]any{
@@ -403,6 +632,7 @@ func registerTools() {
 					"service":      map[string]any{"type": "string"},
 					"timeout_sec":  map[string]any{"type": "integer"},
 					"compose_file": map[string]any{"type": "string"},
+					"probe":        map[string]any{"type": "string"},
 				},
 				"required":             []string{"project", "service"},
 				"additionalProperties": false,
@@ -418,10 +648,14 @@ func registerTools() {
 			project := a["project"].(string)
 			service := a["service"].(string)
 			composeFile, _ := a["compose_file"].(string)
+			probe, _ := a["probe"].(string)
 			tout, _ := a["timeout_sec"].(float64)
 			if tout == 0 {
 				tout = 180
 			}
+			if _, err := parseProbe(probe); err != nil {
+				return "", true, err
+			}
 
 			if err := safeProject(project); err != nil {
 				return "", true, err
@@ -432,20 +666,15 @@ func registerTools() {
 				}
 			}
 
-			id, err := containerID(project, composeFile, service)
+			id, err := containerID(project, service)
 			if err != nil {
 				return j(map[string]string{"status": "not-found"}), true, err
 			}
 
-			deadline := time.Now().Add(time.Duration(tout) * time.Second)
-			for time.Now().Before(deadline) {
-				out, _ := run("docker", "inspect", "--format", "{{.State.Health.Status}}", id)
-				if strings.Contains(out, "healthy") {
-					return j(map[string]string{"status": "healthy"}), false, nil
-				}
-				time.Sleep(3 * time.Second)
-			}
-			return j(map[string]string{"status": "timeout"}), true, errors.New("service not healthy in time")
+			ctx, cancel := context.WithTimeout(context.Background(), time.Duration(tout)*time.Second)
+			defer cancel()
+			res, err := waitReady(ctx, id, probe)
+			return j(res), err != nil, err
 		},
 	}
 
@@ -489,12 +718,14 @@ func registerTools() {
 				}
 			}
 
-			id, err := containerID(project, composeFile, service)
+			id, err := containerID(project, service)
 			if err != nil {
 				return j(map[string]string{"status": "not-found"}), true, err
 			}
 
-			out, err := run("docker", "logs", "--tail", fmt.Sprint(int(tailF)), id)
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+			out, err := engine.ContainerLogs(ctx, id, int(tailF))
 			return j(map[string]string{"logs": out}), err != nil, err
 		},
 	}
@@ -503,13 +734,16 @@ func registerTools() {
 	tools["dbReset"] = Tool{
 		Decl: ToolDecl{
 			Name:        "dbReset",
-			Description: `Destructive: reset DB by 'compose down -v' then 'up -d'. Removes containers, network, and named volumes (data is lost). Requires confirm_phrase="RESET <project>". After starting, waits for the service to become healthy. Optional: seed_cmd.`, InputSchema: map[string]any{
+			Description: `Destructive: reset the DB by stopping and removing db_service, deleting only its <project>_<db_volume> volume (data is lost), then 'up -d db_service'. Other services and volumes are untouched. Requires confirm_phrase="RESET <project>". After starting, waits for the service to become healthy, applies migrations (migrate; default on when MIGRATIONS_DIR is set and exists), then runs the seed pipeline (seed; default on when the seed file exists). Prefer the pipeline; seed_cmd is a one-off shell command run after it. Optional: migrate, seed, seed_cmd.`, InputSchema: map[string]any{
 				"type": "object",
 				"properties": map[string]any{
 					"project":        map[string]any{"type": "string"},
 					"compose_file":   map[string]any{"type": "string"},
 					"db_service":     map[string]any{"type": "string"},
+					"db_volume":      map[string]any{"type": "string"},
 					"seed_cmd":       map[string]any{"type": "string"},
+					"migrate":        map[string]any{"type": "boolean"},
+					"seed":           map[string]any{"type": "boolean"},
 					"confirm_phrase": map[string]any{"type": "string"},
 				},
 				"required":             []string{"project", "compose_file", "db_service", "confirm_phrase"},
@@ -526,6 +760,7 @@ func registerTools() {
 			project := a["project"].(string)
 			compose := a["compose_file"].(string)
 			dbSvc := a["db_service"].(string)
+			dbVol, _ := a["db_volume"].(string)
 			seed, _ := a["seed_cmd"].(string)
 			confirm, _ := a["confirm_phrase"].(string)
 
@@ -541,16 +776,44 @@ func registerTools() {
 				return "", true, fmt.Errorf("confirmation mismatch; expected %q", expect)
 			}
 
-			extra := readDotenv("APP_ENV_FILE")
+			if err := safeService(dbSvc); err != nil {
+				return "", true, err
+			}
+			if err := precheckCompose(compose, []string{dbSvc}); err != nil {
+				return "", true, err
+			}
+			if dbVol == "" {
+				return "", true, errors.New("DB_VOLUME is not set; refusing to guess which volume to delete")
+			}
 
-			if _, err := runComposeWithEnv(extra, "-p", project, "-f", compose, "down", "-v"); err != nil {
+			snap, err := safetySnapshot(dbTarget{project, compose, dbSvc, dbVol}, "dbReset")
+			if err != nil {
 				return "", true, err
 			}
 
-			args := []string{"-p", project, "-f", compose}
+			extra := readDotenv(os.Getenv("APP_ENV_FILE"))
 
-			args = append(args, "up", "-d")
-			if _, err := runComposeWithEnv(extra, args...); err != nil {
+			if _, err := stopServices(extra, project, compose, []string{dbSvc}); err != nil {
+				return "", true, err
+			}
+			volName, err := removeDBVolume(project, dbVol)
+			if err != nil {
+				return "", true, err
+			}
+
+			conflicts, _, err := preflightPorts(extra, project, compose, []string{dbSvc}, portRemapDefault())
+			if err != nil {
+				return "", true, err
+			}
+
+			if err := markIfBranch(extra, dbTarget{project, compose, dbSvc, dbVol}); err != nil {
+				return "", true, err
+			}
+
+			args := composeFileArgs(project, compose)
+
+			args = append(args, "up", "-d", dbSvc)
+			if _, err := runComposeLive(extra, args...); err != nil {
 				return "", true, err
 			}
 
@@ -560,15 +823,70 @@ func registerTools() {
 				return "", true, err
 			}
 
+			migrated := []migration{}
+			doMigrate, explicit := a["migrate"].(bool)
+			if !explicit && os.Getenv("MIGRATIONS_DIR") != "" {
+				// implicit: only if the directory is actually there
+				dir, err := migrationsDir("")
+				if err != nil {
+					return "", true, err
+				}
+				fi, err := os.Stat(dir)
+				doMigrate = err == nil && fi.IsDir()
+			}
+			if doMigrate {
+				t := dbTarget{project, compose, dbSvc, dbVol}
+				dir, err := migrationsDir("")
+				if err != nil {
+					return "", true, err
+				}
+				kind, err := detectSQLKind(t, "")
+				if err != nil {
+					return "", true, err
+				}
+				res, err := migrate(t, credentialsFor(kind, extra), dir, "up", 0, 0)
+				if err != nil {
+					return "", true, fmt.Errorf("migrations: %w", err)
+				}
+				migrated = res.Applied
+			}
+
+			seedSteps := []seedStepResult{}
+			seedFile, _ := seedPath("")
+			doSeed, explicit := a["seed"].(bool)
+			if !explicit {
+				_, err := os.Stat(seedFile)
+				doSeed = err == nil
+			}
+			if doSeed {
+				t := dbTarget{project, compose, dbSvc, dbVol}
+				sf, err := loadSeedFile(seedFile)
+				if err != nil {
+					return "", true, err
+				}
+				kind, err := detectDBKind(t, "")
+				if err != nil {
+					return "", true, err
+				}
+				seedSteps, err = runSeeds(t, credentialsFor(kind, extra), sf, nil)
+				if err != nil {
+					return j(map[string]any{"status": "seed-failed", "seed_steps": seedSteps}), true, err
+				}
+			}
+
 			seedOut := ""
 			if strings.TrimSpace(seed) != "" {
-				out, err := runComposeWithEnv(extra, "-p", project, "-f", compose, "exec", "-T", dbSvc, "sh", "-lc", seed)
+				out, err := runComposeLive(extra, "-p", project, "-f", compose, "exec", "-T", dbSvc, "sh", "-lc", seed)
 				if err != nil {
 					return "", true, err
 				}
 				seedOut = out
 			}
-			return j(map[string]string{"status": "reset-complete", "seed_out": seedOut}), false, nil
+			res := map[string]any{"status": "reset-complete", "removed_volume": volName, "safety_snapshot": snapName(snap), "migrations_applied": migrated, "seed_steps": seedSteps, "seed_out": seedOut}
+			if len(conflicts) > 0 {
+				res["port_conflicts"] = conflicts
+			}
+			return j(res), false, nil
 		},
 	}
 }
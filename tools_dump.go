@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// ---------- Logical dump tools ----------
+
+func registerDumpTools() {
+	tools["dbDump"] = Tool{
+		Decl: ToolDecl{
+			Name:        "dbDump",
+			Description: "Logical dump of the DB (pg_dump, mysqldump, mongodump --archive or a redis-cli RDB, run inside db_service via compose exec) streamed to a host file. Credentials come from APP_ENV_FILE. Portable across engine versions, unlike snapshots. Optional: file (inside SNAPSHOT_DIR or APP_DIR; default under the snapshot dir), compression (none|gzip|zstd; default from the file extension), format (postgres only: custom|plain, default custom), engine (postgres|mysql|mongo|redis; default from the image), database.",
+			InputSchema: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"project":      map[string]any{"type": "string"},
+					"compose_file": map[string]any{"type": "string"},
+					"db_service":   map[string]any{"type": "string"},
+					"file":         map[string]any{"type": "string"},
+					"compression":  map[string]any{"type": "string", "enum": []string{"none", "gzip", "zstd"}},
+					"format":       map[string]any{"type": "string", "enum": []string{"custom", "plain"}},
+					"engine":       map[string]any{"type": "string", "enum": []string{"postgres", "mysql", "mongo", "redis"}},
+					"database":     map[string]any{"type": "string"},
+				},
+				"required":             []string{"project", "compose_file", "db_service"},
+				"additionalProperties": false,
+			},
+		},
+		Call: func(a map[string]any) (string, bool, error) {
+			if os.Getenv("ENSURE_DOCKER_AUTO") != "0" {
+				if _, err := ensureDockerReady(); err != nil {
+					return "", true, err
+				}
+			}
+
+			t, err := targetArgs(a)
+			if err != nil {
+				return "", true, err
+			}
+			file, _ := a["file"].(string)
+			compArg, _ := a["compression"].(string)
+			format, _ := a["format"].(string)
+			kindArg, _ := a["engine"].(string)
+			database, _ := a["database"].(string)
+			if format == "" {
+				format = "custom"
+			}
+			if format != "custom" && format != "plain" {
+				return "", true, fmt.Errorf("unknown format %q (custom|plain)", format)
+			}
+
+			kind, err := detectDBKind(t, kindArg)
+			if err != nil {
+				return "", true, err
+			}
+			c := credentialsFor(kind, readDotenv(os.Getenv("APP_ENV_FILE")))
+			if database != "" {
+				c.Database = database
+			}
+			if err := c.requireDatabase(); err != nil {
+				return "", true, err
+			}
+
+			comp, err := compressionFor(file, compArg)
+			if err != nil {
+				return "", true, err
+			}
+			if file == "" {
+				file = defaultDumpPath(t.Project, kind, format, comp)
+			}
+			if file, err = dumpFilePath(t.Project, file); err != nil {
+				return "", true, err
+			}
+
+			if dryRun {
+				return j(map[string]any{"status": "dry-run", "would_dump": c.Database, "file": file}), false, nil
+			}
+			res, err := dumpDB(t, c, file, format, comp)
+			if err != nil {
+				return "", true, err
+			}
+			return j(res), false, nil
+		},
+	}
+
+	tools["dbLoad"] = Tool{
+		Decl: ToolDecl{
+			Name:        "dbLoad",
+			Description: `Destructive: load a dump file from the host into the DB (pg_restore/psql, mysql or mongorestore inside db_service; redis dumps need dbRestore). Existing objects in the dump are replaced. Requires confirm_phrase="LOAD <project>". Required: file (inside SNAPSHOT_DIR or APP_DIR). Optional: compression (default from the extension), engine, database.`,
+			InputSchema: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"project":        map[string]any{"type": "string"},
+					"compose_file":   map[string]any{"type": "string"},
+					"db_service":     map[string]any{"type": "string"},
+					"db_volume":      map[string]any{"type": "string"},
+					"file":           map[string]any{"type": "string"},
+					"compression":    map[string]any{"type": "string", "enum": []string{"none", "gzip", "zstd"}},
+					"engine":         map[string]any{"type": "string", "enum": []string{"postgres", "mysql", "mongo", "redis"}},
+					"database":       map[string]any{"type": "string"},
+					"confirm_phrase": map[string]any{"type": "string"},
+				},
+				"required":             []string{"project", "compose_file", "db_service", "file", "confirm_phrase"},
+				"additionalProperties": false,
+			},
+		},
+		Call: func(a map[string]any) (string, bool, error) {
+			if os.Getenv("ENSURE_DOCKER_AUTO") != "0" {
+				if _, err := ensureDockerReady(); err != nil {
+					return "", true, err
+				}
+			}
+
+			t, err := targetArgs(a)
+			if err != nil {
+				return "", true, err
+			}
+			file, _ := a["file"].(string)
+			compArg, _ := a["compression"].(string)
+			kindArg, _ := a["engine"].(string)
+			database, _ := a["database"].(string)
+			confirm, _ := a["confirm_phrase"].(string)
+
+			expect := "LOAD " + t.Project
+			if confirm != expect {
+				return "", true, fmt.Errorf("confirmation mismatch; expected %q", expect)
+			}
+			if file, err = dumpFilePath(t.Project, file); err != nil {
+				return "", true, err
+			}
+			if _, err := os.Stat(file); err != nil {
+				return "", true, err
+			}
+
+			kind, err := detectDBKind(t, kindArg)
+			if err != nil {
+				return "", true, err
+			}
+			c := credentialsFor(kind, readDotenv(os.Getenv("APP_ENV_FILE")))
+			if database != "" {
+				c.Database = database
+			}
+			if err := c.requireDatabase(); err != nil {
+				return "", true, err
+			}
+			comp, err := compressionFor(file, compArg)
+			if err != nil {
+				return "", true, err
+			}
+			// fail before the safety snapshot if the engine can't restore dumps
+			if _, err := driverFor(kind).RestoreCommand(c, nil); err != nil {
+				return "", true, err
+			}
+
+			if dryRun {
+				return j(map[string]any{"status": "dry-run", "would_load": file, "database": c.Database}), false, nil
+			}
+			snap, err := safetySnapshot(t, "dbLoad")
+			if err != nil {
+				return "", true, err
+			}
+			format, err := loadDB(t, c, file, comp)
+			if err != nil {
+				return "", true, err
+			}
+			return j(map[string]string{"status": "load-complete", "file": file, "engine": kind, "database": c.Database, "format": format, "safety_snapshot": snapName(snap)}), false, nil
+		},
+	}
+}
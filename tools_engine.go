@@ -0,0 +1,292 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ---------- Engine tools (driver info, connection info, DB users) ----------
+
+func registerEngineTools() {
+	tools["dbEngine"] = Tool{
+		Decl: ToolDecl{
+			Name:        "dbEngine",
+			Description: "Show which engine driver db_service uses (postgres|mysql|mongo|redis; from DB_ENGINE or the image name), whether it accepts connections (the engine's own probe via compose exec), and the in-network connection URL with the password masked.",
+			InputSchema: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"project":      map[string]any{"type": "string"},
+					"compose_file": map[string]any{"type": "string"},
+					"db_service":   map[string]any{"type": "string"},
+					"engine":       map[string]any{"type": "string", "enum": []string{"postgres", "mysql", "mongo", "redis"}},
+				},
+				"required":             []string{"project", "compose_file", "db_service"},
+				"additionalProperties": false,
+			},
+		},
+		Call: func(a map[string]any) (string, bool, error) {
+			if os.Getenv("ENSURE_DOCKER_AUTO") != "0" {
+				if _, err := ensureDockerReady(); err != nil {
+					return "", true, err
+				}
+			}
+			t, err := targetArgs(a)
+			if err != nil {
+				return "", true, err
+			}
+			kindArg, _ := a["engine"].(string)
+			kind, err := detectDBKind(t, kindArg)
+			if err != nil {
+				return "", true, err
+			}
+			source := "image"
+			if kindArg != "" {
+				source = "argument"
+			} else if os.Getenv("DB_ENGINE") != "" {
+				source = "DB_ENGINE"
+			}
+
+			d := driverFor(kind)
+			c := d.Creds(readDotenv(os.Getenv("APP_ENV_FILE")))
+			masked := c
+			if masked.Password != "" {
+				masked.Password = passwordMask
+			}
+			res := map[string]any{
+				"engine":   kind,
+				"source":   source,
+				"database": c.Database,
+				"user":     c.User,
+				"url":      unmaskEscapes(d.URL(masked, t.Service, d.DefaultPort())),
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			err = streamComposeContext(ctx, execEnv(c), nil, io.Discard, execArgs(t, c, d.ReadyCommand(c)...)...)
+			res["ready"] = err == nil
+			if err != nil {
+				res["ready_error"] = tail(err.Error(), 500)
+			}
+			return j(res), false, nil
+		},
+	}
+
+	tools["dbConnectionInfo"] = Tool{
+		Decl: ToolDecl{
+			Name:        "dbConnectionInfo",
+			Description: "Ready-to-use connection strings for the running DB: the host port db_service publishes, credentials from APP_ENV_FILE, as URL, libpq keyword string (postgres), JDBC (postgres/mysql), env block (DATABASE_URL, DB_HOST, ...) and the in-network URL for other containers. The password is shown as **** unless show_password=true. Optional: file (inside APP_DIR; .json gets a JSON object, anything else the env block with existing keys updated in place; always written with the real password), engine, database.",
+			InputSchema: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"project":       map[string]any{"type": "string"},
+					"compose_file":  map[string]any{"type": "string"},
+					"db_service":    map[string]any{"type": "string"},
+					"engine":        map[string]any{"type": "string", "enum": []string{"postgres", "mysql", "mongo", "redis"}},
+					"database":      map[string]any{"type": "string"},
+					"show_password": map[string]any{"type": "boolean"},
+					"file":          map[string]any{"type": "string"},
+				},
+				"required":             []string{"project", "compose_file", "db_service"},
+				"additionalProperties": false,
+			},
+		},
+		Call: func(a map[string]any) (string, bool, error) {
+			if os.Getenv("ENSURE_DOCKER_AUTO") != "0" {
+				if _, err := ensureDockerReady(); err != nil {
+					return "", true, err
+				}
+			}
+			t, err := targetArgs(a)
+			if err != nil {
+				return "", true, err
+			}
+			kindArg, _ := a["engine"].(string)
+			database, _ := a["database"].(string)
+			show, _ := a["show_password"].(bool)
+			file, _ := a["file"].(string)
+
+			var path string
+			if file != "" {
+				if filepath.IsAbs(file) {
+					return "", true, fmt.Errorf("file must be relative to APP_DIR: %q", file)
+				}
+				if path, err = appPath(file); err != nil {
+					return "", true, err
+				}
+			}
+
+			kind, err := detectDBKind(t, kindArg)
+			if err != nil {
+				return "", true, err
+			}
+			d := driverFor(kind)
+			c := d.Creds(readDotenv(os.Getenv("APP_ENV_FILE")))
+			if database != "" {
+				c.Database = database
+			}
+			host, port, err := publishedAddr(t, d.DefaultPort())
+			if err != nil {
+				return "", true, err
+			}
+
+			ci := connectionFor(t, c, host, port)
+			if path != "" {
+				if dryRun {
+					ci.File = "[dry-run] " + path
+				} else if err := writeConnectionFile(path, ci, c); err != nil {
+					return "", true, err
+				} else {
+					ci.File = path
+				}
+			}
+			if !show && c.Password != "" {
+				file := ci.File
+				ci = redacted(t, c, host, port)
+				ci.File = file
+			}
+			ci.RemappedFrom = remappedFrom(t.Project, t.Service, port)
+			return j(ci), false, nil
+		},
+	}
+
+	tools["dbUser"] = Tool{
+		Decl: ToolDecl{
+			Name:        "dbUser",
+			Description: `Manage DB users/logins with the engine's admin account (Postgres roles, MySQL users, Mongo users, Redis ACL users). action: list | create | drop. create takes name, role (readwrite|readonly, default readwrite), password (default: generated and returned once) and database (default: the app's). drop is destructive, requires confirm_phrase="DROP USER <project>/<name>" and takes a safety snapshot first; the app's own user can't be dropped.`,
+			InputSchema: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"project":        map[string]any{"type": "string"},
+					"compose_file":   map[string]any{"type": "string"},
+					"db_service":     map[string]any{"type": "string"},
+					"db_volume":      map[string]any{"type": "string"},
+					"action":         map[string]any{"type": "string", "enum": []string{"list", "create", "drop"}},
+					"name":           map[string]any{"type": "string"},
+					"role":           map[string]any{"type": "string", "enum": []string{"readwrite", "readonly"}},
+					"password":       map[string]any{"type": "string"},
+					"database":       map[string]any{"type": "string"},
+					"engine":         map[string]any{"type": "string", "enum": []string{"postgres", "mysql", "mongo", "redis"}},
+					"confirm_phrase": map[string]any{"type": "string"},
+				},
+				"required":             []string{"project", "compose_file", "db_service", "action"},
+				"additionalProperties": false,
+			},
+		},
+		Call: func(a map[string]any) (string, bool, error) {
+			if os.Getenv("ENSURE_DOCKER_AUTO") != "0" {
+				if _, err := ensureDockerReady(); err != nil {
+					return "", true, err
+				}
+			}
+			t, err := targetArgs(a)
+			if err != nil {
+				return "", true, err
+			}
+			action, _ := a["action"].(string)
+			kindArg, _ := a["engine"].(string)
+			confirm, _ := a["confirm_phrase"].(string)
+			u := dbUser{}
+			u.Name, _ = a["name"].(string)
+			u.Role, _ = a["role"].(string)
+			u.Password, _ = a["password"].(string)
+			u.Database, _ = a["database"].(string)
+
+			kind, err := detectDBKind(t, kindArg)
+			if err != nil {
+				return "", true, err
+			}
+			d := driverFor(kind)
+			env := readDotenv(os.Getenv("APP_ENV_FILE"))
+			app, admin := d.Creds(env), d.AdminCreds(env)
+			if u.Database == "" {
+				u.Database = app.Database
+			}
+
+			switch action {
+			case "list":
+				names, err := d.Users(t, admin, "list", u)
+				if err != nil {
+					return "", true, err
+				}
+				return j(map[string]any{"engine": kind, "users": names}), false, nil
+			case "create", "drop":
+			default:
+				return "", true, fmt.Errorf("unknown action %q (list|create|drop)", action)
+			}
+
+			if !userName.MatchString(u.Name) {
+				return "", true, fmt.Errorf("invalid user name %q", u.Name)
+			}
+			if u.Database != "" && kind != "redis" {
+				if err := safeDBName(u.Database); err != nil {
+					return "", true, err
+				}
+			}
+			if u.Role == "" {
+				u.Role = "readwrite"
+			}
+			if u.Role != "readwrite" && u.Role != "readonly" {
+				return "", true, fmt.Errorf("unknown role %q (readwrite|readonly)", u.Role)
+			}
+
+			if action == "drop" {
+				if u.Name == app.User || u.Name == admin.User || (kind == "redis" && u.Name == "default") {
+					return "", true, fmt.Errorf("refusing to drop %q: the app or admin user", u.Name)
+				}
+				expect := "DROP USER " + t.Project + "/" + u.Name
+				if confirm != expect {
+					return "", true, fmt.Errorf("confirmation mismatch; expected %q", expect)
+				}
+				if dryRun {
+					return j(map[string]any{"status": "dry-run", "would_drop_user": u.Name}), false, nil
+				}
+				snap, err := safetySnapshot(t, "dbUser drop")
+				if err != nil {
+					return "", true, err
+				}
+				if _, err := d.Users(t, admin, "drop", u); err != nil {
+					return "", true, err
+				}
+				return j(map[string]any{"status": "dropped", "user": u.Name, "safety_snapshot": snapName(snap)}), false, nil
+			}
+
+			generated := u.Password == ""
+			if generated {
+				if u.Password, err = randomPassword(24); err != nil {
+					return "", true, err
+				}
+			}
+			if dryRun {
+				return j(map[string]any{"status": "dry-run", "would_create_user": u.Name, "role": u.Role, "database": u.Database}), false, nil
+			}
+			if _, err := d.Users(t, admin, "create", u); err != nil {
+				return "", true, err
+			}
+			res := map[string]any{"status": "created", "user": u.Name, "role": u.Role, "database": u.Database}
+			if generated {
+				res["password"] = u.Password
+			}
+			return j(res), false, nil
+		},
+	}
+}
+
+// randomPassword returns n random letters and digits (safe in URLs and shells).
+func randomPassword(n int) (string, error) {
+	const alphabet = "abcdefghijkmnopqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	b := make([]byte, n)
+	for i := range b {
+		k, err := rand.Int(rand.Reader, big.NewInt(int64(len(alphabet))))
+		if err != nil {
+			return "", err
+		}
+		b[i] = alphabet[k.Int64()]
+	}
+	return string(b), nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// ---------- Migration tool ----------
+
+func registerMigrateTools() {
+	tools["dbMigrate"] = Tool{
+		Decl: ToolDecl{
+			Name:        "dbMigrate",
+			Description: `Apply versioned SQL migrations (NNN_name.up.sql / NNN_name.down.sql in MIGRATIONS_DIR inside APP_DIR) against db_service; applied versions are tracked in schema_migrations. action: up (all pending, or steps), down (steps, default 1), goto (version; 0 = everything down), status. Anything that runs a down migration is destructive and requires confirm_phrase="MIGRATE DOWN <project>". Optional: dir, engine.`,
+			InputSchema: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"project":        map[string]any{"type": "string"},
+					"compose_file":   map[string]any{"type": "string"},
+					"db_service":     map[string]any{"type": "string"},
+					"db_volume":      map[string]any{"type": "string"},
+					"action":         map[string]any{"type": "string", "enum": []string{"up", "down", "goto", "status"}},
+					"steps":          map[string]any{"type": "integer"},
+					"version":        map[string]any{"type": "integer"},
+					"dir":            map[string]any{"type": "string"},
+					"engine":         map[string]any{"type": "string", "enum": []string{"postgres", "mysql"}},
+					"confirm_phrase": map[string]any{"type": "string"},
+				},
+				"required":             []string{"project", "compose_file", "db_service", "action"},
+				"additionalProperties": false,
+			},
+		},
+		Call: func(a map[string]any) (string, bool, error) {
+			if os.Getenv("ENSURE_DOCKER_AUTO") != "0" {
+				if _, err := ensureDockerReady(); err != nil {
+					return "", true, err
+				}
+			}
+
+			t, err := targetArgs(a)
+			if err != nil {
+				return "", true, err
+			}
+			action, _ := a["action"].(string)
+			stepsF, _ := a["steps"].(float64)
+			versionF, hasVersion := a["version"].(float64)
+			dirArg, _ := a["dir"].(string)
+			kindArg, _ := a["engine"].(string)
+			confirm, _ := a["confirm_phrase"].(string)
+
+			if action == "goto" && !hasVersion {
+				return "", true, errors.New("goto needs a version")
+			}
+			dir, err := migrationsDir(dirArg)
+			if err != nil {
+				return "", true, err
+			}
+			kind, err := detectSQLKind(t, kindArg)
+			if err != nil {
+				return "", true, err
+			}
+			c := credentialsFor(kind, readDotenv(os.Getenv("APP_ENV_FILE")))
+			if err := c.requireDatabase(); err != nil {
+				return "", true, err
+			}
+
+			var snap *snapshotMeta
+			if action == "down" || action == "goto" {
+				applied, err := appliedVersions(t, c)
+				if err != nil {
+					return "", true, err
+				}
+				if migrateDestroys(action, int64(versionF), applied) {
+					expect := "MIGRATE DOWN " + t.Project
+					if confirm != expect {
+						return "", true, fmt.Errorf("confirmation mismatch; expected %q", expect)
+					}
+					if snap, err = safetySnapshot(t, "dbMigrate"); err != nil {
+						return "", true, err
+					}
+				}
+			}
+
+			res, err := migrate(t, c, dir, action, int(stepsF), int64(versionF))
+			if err != nil {
+				return j(res), true, err
+			}
+			if snap != nil {
+				return j(map[string]any{"result": res, "safety_snapshot": snap.Name}), false, nil
+			}
+			return j(res), false, nil
+		},
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// ---------- Query tool ----------
+
+func registerQueryTools() {
+	tools["dbQuery"] = Tool{
+		Decl: ToolDecl{
+			Name:        "dbQuery",
+			Description: `Run one SQL statement against db_service and return {columns, rows} as JSON. For mongo, sql is one mongosh expression (db.users.find({...})); for redis, one redis-cli command (HGETALL user:1). Default mode "read" runs inside a read-only transaction with a row limit (default 100, max 10000) and statement timeout (default 5000 ms); writes fail there. On mongo/redis read mode only allows read commands. mode "write" commits and is destructive: it requires confirm_phrase="WRITE <project>" and takes a safety snapshot first. Optional: limit, timeout_ms, engine, database.`,
+			InputSchema: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"project":        map[string]any{"type": "string"},
+					"compose_file":   map[string]any{"type": "string"},
+					"db_service":     map[string]any{"type": "string"},
+					"db_volume":      map[string]any{"type": "string"},
+					"sql":            map[string]any{"type": "string"},
+					"mode":           map[string]any{"type": "string", "enum": []string{"read", "write"}},
+					"limit":          map[string]any{"type": "integer"},
+					"timeout_ms":     map[string]any{"type": "integer"},
+					"engine":         map[string]any{"type": "string", "enum": []string{"postgres", "mysql", "mongo", "redis"}},
+					"database":       map[string]any{"type": "string"},
+					"confirm_phrase": map[string]any{"type": "string"},
+				},
+				"required":             []string{"project", "compose_file", "db_service", "sql"},
+				"additionalProperties": false,
+			},
+		},
+		Call: func(a map[string]any) (string, bool, error) {
+			if os.Getenv("ENSURE_DOCKER_AUTO") != "0" {
+				if _, err := ensureDockerReady(); err != nil {
+					return "", true, err
+				}
+			}
+
+			t, err := targetArgs(a)
+			if err != nil {
+				return "", true, err
+			}
+			sql, _ := a["sql"].(string)
+			mode, _ := a["mode"].(string)
+			limitF, _ := a["limit"].(float64)
+			toutF, _ := a["timeout_ms"].(float64)
+			kindArg, _ := a["engine"].(string)
+			database, _ := a["database"].(string)
+			confirm, _ := a["confirm_phrase"].(string)
+
+			limit := int(limitF)
+			if limit <= 0 {
+				limit = 100
+			}
+			limit = min(limit, 10000)
+			if toutF <= 0 {
+				toutF = 5000
+			}
+			if mode == "" {
+				mode = "read"
+			}
+			if mode != "read" && mode != "write" {
+				return "", true, fmt.Errorf("unknown mode %q (read|write)", mode)
+			}
+
+			kind, err := detectDBKind(t, kindArg)
+			if err != nil {
+				return "", true, err
+			}
+			d := driverFor(kind)
+			stmt, readOnly, err := d.CheckQuery(sql)
+			if err != nil {
+				return "", true, err
+			}
+			write := mode == "write"
+			if !write && !readOnly {
+				return "", true, fmt.Errorf("not a read-only %s statement; use mode=write with confirm_phrase=%q", kind, "WRITE "+t.Project)
+			}
+
+			c := d.Creds(readDotenv(os.Getenv("APP_ENV_FILE")))
+			if database != "" {
+				c.Database = database
+			}
+			if err := c.requireDatabase(); err != nil {
+				return "", true, err
+			}
+
+			var snap *snapshotMeta
+			if write {
+				expect := "WRITE " + t.Project
+				if confirm != expect {
+					return "", true, fmt.Errorf("confirmation mismatch; expected %q", expect)
+				}
+				if snap, err = safetySnapshot(t, "dbQuery"); err != nil {
+					return "", true, err
+				}
+			}
+
+			res, err := d.Query(t, c, stmt, write, limit, time.Duration(toutF)*time.Millisecond)
+			if err != nil {
+				return "", true, err
+			}
+			if snap != nil {
+				return j(map[string]any{"result": res, "safety_snapshot": snap.Name}), false, nil
+			}
+			return j(res), false, nil
+		},
+	}
+}
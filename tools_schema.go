@@ -0,0 +1,252 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ---------- Schema tool ----------
+
+func registerSchemaTools() {
+	tools["dbSchema"] = Tool{
+		Decl: ToolDecl{
+			Name:        "dbSchema",
+			Description: "Describe the schema of the running DB (Postgres or MySQL): tables with columns (type, nullability, default), indexes, constraints and foreign keys, as JSON. Optional: tables (limit to these names), engine, database.",
+			InputSchema: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"project":      map[string]any{"type": "string"},
+					"compose_file": map[string]any{"type": "string"},
+					"db_service":   map[string]any{"type": "string"},
+					"tables":       map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+					"engine":       map[string]any{"type": "string", "enum": []string{"postgres", "mysql"}},
+					"database":     map[string]any{"type": "string"},
+				},
+				"required":             []string{"project", "compose_file", "db_service"},
+				"additionalProperties": false,
+			},
+		},
+		Call: func(a map[string]any) (string, bool, error) {
+			if os.Getenv("ENSURE_DOCKER_AUTO") != "0" {
+				if _, err := ensureDockerReady(); err != nil {
+					return "", true, err
+				}
+			}
+
+			t, err := targetArgs(a)
+			if err != nil {
+				return "", true, err
+			}
+			kindArg, _ := a["engine"].(string)
+			database, _ := a["database"].(string)
+			c, err := schemaCreds(t, kindArg, database)
+			if err != nil {
+				return "", true, err
+			}
+
+			s, err := introspectSchema(t, c, tablesArg(a))
+			if err != nil {
+				return "", true, err
+			}
+			return j(s), false, nil
+		},
+	}
+
+	tools["dbSchemaDiff"] = Tool{
+		Decl: ToolDecl{
+			Name:        "dbSchemaDiff",
+			Description: "Compare the live DB schema (target) against a base and report added/removed/changed tables, columns, indexes, constraints and foreign keys. against=snapshot (snapshot name, default newest) or dump (file, inside SNAPSHOT_DIR or APP_DIR) start a throwaway DB container from it; against=project compares with another compose project's running DB (other_project, other_compose_file, other_db_service), using this app's credentials; against=profile compares with the running DB of another config profile (profile), with that profile's project, compose file, service and env file. Optional: tables, engine, database.",
+			InputSchema: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"project":            map[string]any{"type": "string"},
+					"compose_file":       map[string]any{"type": "string"},
+					"db_service":         map[string]any{"type": "string"},
+					"db_volume":          map[string]any{"type": "string"},
+					"against":            map[string]any{"type": "string", "enum": []string{"snapshot", "dump", "project", "profile"}},
+					"snapshot":           map[string]any{"type": "string"},
+					"file":               map[string]any{"type": "string"},
+					"compression":        map[string]any{"type": "string", "enum": []string{"none", "gzip", "zstd"}},
+					"other_project":      map[string]any{"type": "string"},
+					"other_compose_file": map[string]any{"type": "string"},
+					"other_db_service":   map[string]any{"type": "string"},
+					"profile":            map[string]any{"type": "string"},
+					"tables":             map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+					"engine":             map[string]any{"type": "string", "enum": []string{"postgres", "mysql"}},
+					"database":           map[string]any{"type": "string"},
+				},
+				"required":             []string{"project", "compose_file", "db_service", "against"},
+				"additionalProperties": false,
+			},
+		},
+		Call: func(a map[string]any) (string, bool, error) {
+			if os.Getenv("ENSURE_DOCKER_AUTO") != "0" {
+				if _, err := ensureDockerReady(); err != nil {
+					return "", true, err
+				}
+			}
+
+			t, err := targetArgs(a)
+			if err != nil {
+				return "", true, err
+			}
+			against, _ := a["against"].(string)
+			snapName, _ := a["snapshot"].(string)
+			file, _ := a["file"].(string)
+			compArg, _ := a["compression"].(string)
+			kindArg, _ := a["engine"].(string)
+			database, _ := a["database"].(string)
+			tables := tablesArg(a)
+			profile, _ := a["profile"].(string)
+
+			// the other project's target, checked up front like the main one
+			var other dbTarget
+			if against == "project" {
+				other = dbTarget{Project: t.Project, ComposeFile: t.ComposeFile, Service: t.Service}
+				if v, _ := a["other_project"].(string); v != "" {
+					other.Project = v
+				}
+				if v, _ := a["other_compose_file"].(string); v != "" {
+					other.ComposeFile = v
+				}
+				if v, _ := a["other_db_service"].(string); v != "" {
+					other.Service = v
+				}
+				if err := safeProject(other.Project); err != nil {
+					return "", true, err
+				}
+				if err := safeComposePath(other.ComposeFile); err != nil {
+					return "", true, err
+				}
+				if err := safeService(other.Service); err != nil {
+					return "", true, err
+				}
+				if other == (dbTarget{Project: t.Project, ComposeFile: t.ComposeFile, Service: t.Service}) {
+					return "", true, fmt.Errorf("other_project/other_compose_file/other_db_service must name a different DB")
+				}
+			}
+			if against == "profile" {
+				if profile == "" {
+					return "", true, fmt.Errorf("against=profile needs profile (see listProfiles)")
+				}
+				if profile == activeProfile {
+					return "", true, fmt.Errorf("profile %q is the active one; name a different profile", profile)
+				}
+				if _, err := profileEnv(profile); err != nil {
+					return "", true, err
+				}
+			}
+
+			c, err := schemaCreds(t, kindArg, database)
+			if err != nil {
+				return "", true, err
+			}
+
+			var base *dbSchema
+			var baseLabel string
+			switch against {
+			case "snapshot":
+				if dryRun {
+					return j(map[string]any{"status": "dry-run", "would_compare": "snapshot " + snapName}), false, nil
+				}
+				var meta *snapshotMeta
+				base, meta, err = snapshotSchema(t, c, snapName, tables)
+				if meta != nil {
+					baseLabel = "snapshot " + meta.Name
+				}
+			case "dump":
+				if file, err = dumpFilePath(t.Project, file); err != nil {
+					return "", true, err
+				}
+				if _, err := os.Stat(file); err != nil {
+					return "", true, err
+				}
+				var comp string
+				if comp, err = compressionFor(file, compArg); err != nil {
+					return "", true, err
+				}
+				if dryRun {
+					return j(map[string]any{"status": "dry-run", "would_compare": "dump " + file}), false, nil
+				}
+				base, err = dumpSchema(t, c, file, comp, tables)
+				baseLabel = "dump " + filepath.Base(file)
+			case "project":
+				baseLabel = "project " + other.Project
+				base, err = introspectSchema(other, c, tables)
+			case "profile":
+				baseLabel = "profile " + profile
+				base, err = profileSchema(profile, kindArg, database, tables)
+			default:
+				return "", true, fmt.Errorf("unknown against %q (snapshot|dump|project|profile)", against)
+			}
+			if err != nil {
+				return "", true, err
+			}
+			if base == nil {
+				return "", true, fmt.Errorf("no base schema read (against=%s)", against)
+			}
+
+			live, err := introspectSchema(t, c, tables)
+			if err != nil {
+				return "", true, err
+			}
+			d := diffSchemas(base, live)
+			d.Base, d.Target = baseLabel, "project "+t.Project
+			return j(d), false, nil
+		},
+	}
+}
+
+// profileSchema reads the schema of another profile's running DB: its project,
+// compose file, service, engine and credentials come from that profile.
+func profileSchema(name, kindArg, database string, tables []string) (*dbSchema, error) {
+	var s *dbSchema
+	err := withProfileEnv(name, func() error {
+		t := dbTarget{Project: currentProject(), ComposeFile: os.Getenv("COMPOSE_FILE"), Service: os.Getenv("DB_SERVICE")}
+		if err := safeProject(t.Project); err != nil {
+			return err
+		}
+		if err := safeComposePath(t.ComposeFile); err != nil {
+			return err
+		}
+		if err := safeService(t.Service); err != nil {
+			return err
+		}
+		c, err := schemaCreds(t, kindArg, database)
+		if err != nil {
+			return err
+		}
+		s, err = introspectSchema(t, c, tables)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("profile %s: %w", name, err)
+	}
+	return s, nil
+}
+
+// schemaCreds resolves engine + credentials for the schema tools.
+func schemaCreds(t dbTarget, kindArg, database string) (dbCreds, error) {
+	kind, err := detectSQLKind(t, kindArg)
+	if err != nil {
+		return dbCreds{}, err
+	}
+	c := credentialsFor(kind, readDotenv(os.Getenv("APP_ENV_FILE")))
+	if database != "" {
+		c.Database = database
+	}
+	return c, c.requireDatabase()
+}
+
+func tablesArg(a map[string]any) []string {
+	var tables []string
+	if l, ok := a["tables"].([]any); ok {
+		for _, v := range l {
+			if s, ok := v.(string); ok {
+				tables = append(tables, s)
+			}
+		}
+	}
+	return tables
+}
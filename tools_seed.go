@@ -0,0 +1,72 @@
+package main
+
+import (
+	"os"
+)
+
+// ---------- Seed pipeline tool ----------
+
+func registerSeedTools() {
+	tools["dbSeed"] = Tool{
+		Decl: ToolDecl{
+			Name:        "dbSeed",
+			Description: "Run the declarative seed pipeline from SEED_FILE (default seeds.yaml in APP_DIR): ordered sql / csv (into a table) / exec (inside db_service) / host (script in APP_DIR) steps with per-step timeouts. sql and csv steps need postgres or mysql; on mongo and redis use exec (mongosh, redis-cli) or host steps. Reports rows inserted per step and stops at the first failing step. Optional: seed_file, steps (run only these step names), engine.",
+			InputSchema: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"project":      map[string]any{"type": "string"},
+					"compose_file": map[string]any{"type": "string"},
+					"db_service":   map[string]any{"type": "string"},
+					"seed_file":    map[string]any{"type": "string"},
+					"steps":        map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+					"engine":       map[string]any{"type": "string", "enum": []string{"postgres", "mysql", "mongo", "redis"}},
+				},
+				"required":             []string{"project", "compose_file", "db_service"},
+				"additionalProperties": false,
+			},
+		},
+		Call: func(a map[string]any) (string, bool, error) {
+			if os.Getenv("ENSURE_DOCKER_AUTO") != "0" {
+				if _, err := ensureDockerReady(); err != nil {
+					return "", true, err
+				}
+			}
+
+			t, err := targetArgs(a)
+			if err != nil {
+				return "", true, err
+			}
+			fileArg, _ := a["seed_file"].(string)
+			kindArg, _ := a["engine"].(string)
+			var only []string
+			if l, ok := a["steps"].([]any); ok {
+				for _, v := range l {
+					if s, ok := v.(string); ok {
+						only = append(only, s)
+					}
+				}
+			}
+
+			path, err := seedPath(fileArg)
+			if err != nil {
+				return "", true, err
+			}
+			sf, err := loadSeedFile(path)
+			if err != nil {
+				return "", true, err
+			}
+			kind, err := detectDBKind(t, kindArg)
+			if err != nil {
+				return "", true, err
+			}
+			c := credentialsFor(kind, readDotenv(os.Getenv("APP_ENV_FILE")))
+			if err := c.requireDatabase(); err != nil {
+				return "", true, err
+			}
+
+			results, err := runSeeds(t, c, sf, only)
+			res := map[string]any{"seed_file": path, "steps": results}
+			return j(res), err != nil, err
+		},
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// ---------- Snapshot tools ----------
+
+func registerSnapshotTools() {
+	tools["dbSnapshot"] = Tool{
+		Decl: ToolDecl{
+			Name:        "dbSnapshot",
+			Description: "Save the DB volume (<project>_<db_volume>) to a local tar.gz snapshot with metadata (image, time, git commit of APP_DIR). Briefly stops db_service. Optional: name (defaults to a timestamp).",
+			InputSchema: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"project":      map[string]any{"type": "string"},
+					"compose_file": map[string]any{"type": "string"},
+					"db_service":   map[string]any{"type": "string"},
+					"db_volume":    map[string]any{"type": "string"},
+					"name":         map[string]any{"type": "string"},
+				},
+				"required":             []string{"project", "compose_file", "db_service"},
+				"additionalProperties": false,
+			},
+		},
+		Call: func(a map[string]any) (string, bool, error) {
+			if os.Getenv("ENSURE_DOCKER_AUTO") != "0" {
+				if _, err := ensureDockerReady(); err != nil {
+					return "", true, err
+				}
+			}
+
+			t, err := targetArgs(a)
+			if err != nil {
+				return "", true, err
+			}
+			name, _ := a["name"].(string)
+
+			if dryRun {
+				return j(map[string]string{"status": "dry-run", "would_snapshot": t.Project + "_" + t.Volume, "dir": snapshotDir(t.Project)}), false, nil
+			}
+			meta, err := takeSnapshot(t, name, "manual", false)
+			if err != nil {
+				return "", true, err
+			}
+			return j(meta), false, nil
+		},
+	}
+
+	tools["dbSnapshotList"] = Tool{
+		Decl: ToolDecl{
+			Name:        "dbSnapshotList",
+			Description: "List saved DB snapshots for a project, newest first. Required: project.",
+			InputSchema: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"project": map[string]any{"type": "string"},
+				},
+				"required":             []string{"project"},
+				"additionalProperties": false,
+			},
+		},
+		Call: func(a map[string]any) (string, bool, error) {
+			project := a["project"].(string)
+			if err := safeProject(project); err != nil {
+				return "", true, err
+			}
+			list, err := listSnapshots(project)
+			if err != nil {
+				return "", true, err
+			}
+			return j(map[string]any{"snapshots": list}), false, nil
+		},
+	}
+
+	tools["dbRestore"] = Tool{
+		Decl: ToolDecl{
+			Name:        "dbRestore",
+			Description: `Destructive: replace the DB volume with a saved snapshot, then start db_service and wait until healthy. Current data is lost. Requires confirm_phrase="RESTORE <project>". Optional: name (defaults to the newest snapshot).`,
+			InputSchema: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"project":        map[string]any{"type": "string"},
+					"compose_file":   map[string]any{"type": "string"},
+					"db_service":     map[string]any{"type": "string"},
+					"db_volume":      map[string]any{"type": "string"},
+					"name":           map[string]any{"type": "string"},
+					"confirm_phrase": map[string]any{"type": "string"},
+				},
+				"required":             []string{"project", "compose_file", "db_service", "confirm_phrase"},
+				"additionalProperties": false,
+			},
+		},
+		Call: func(a map[string]any) (string, bool, error) {
+			if os.Getenv("ENSURE_DOCKER_AUTO") != "0" {
+				if _, err := ensureDockerReady(); err != nil {
+					return "", true, err
+				}
+			}
+
+			t, err := targetArgs(a)
+			if err != nil {
+				return "", true, err
+			}
+			name, _ := a["name"].(string)
+			confirm, _ := a["confirm_phrase"].(string)
+
+			expect := "RESTORE " + t.Project
+			if confirm != expect {
+				return "", true, fmt.Errorf("confirmation mismatch; expected %q", expect)
+			}
+
+			if dryRun {
+				meta, err := findSnapshot(t.Project, name)
+				if err != nil {
+					return "", true, err
+				}
+				return j(map[string]any{"status": "dry-run", "would_restore": meta}), false, nil
+			}
+			// resolve the target first: the safety snapshot would otherwise become "newest"
+			target, err := findSnapshot(t.Project, name)
+			if err != nil {
+				return "", true, err
+			}
+			snap, err := safetySnapshot(t, "dbRestore", target.Name)
+			if err != nil {
+				return "", true, err
+			}
+			meta, health, err := restoreSnapshot(t, target.Name)
+			res := map[string]any{"snapshot": meta, "health": health, "safety_snapshot": snapName(snap)}
+			if err != nil {
+				return j(res), true, err
+			}
+			res["status"] = "restore-complete"
+			return j(res), false, nil
+		},
+	}
+
+	tools["undo"] = Tool{
+		Decl: ToolDecl{
+			Name:        "undo",
+			Description: "Undo the last destructive operation (dbReset, composeDown with remove_volumes, dbRestore, dbLoad) by restoring the safety snapshot taken right before it. The current state is snapshotted first, so undo itself is reversible with dbRestore.",
+			InputSchema: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"project":      map[string]any{"type": "string"},
+					"compose_file": map[string]any{"type": "string"},
+					"db_service":   map[string]any{"type": "string"},
+					"db_volume":    map[string]any{"type": "string"},
+				},
+				"required":             []string{"project", "compose_file", "db_service"},
+				"additionalProperties": false,
+			},
+		},
+		Call: func(a map[string]any) (string, bool, error) {
+			if os.Getenv("ENSURE_DOCKER_AUTO") != "0" {
+				if _, err := ensureDockerReady(); err != nil {
+					return "", true, err
+				}
+			}
+
+			t, err := targetArgs(a)
+			if err != nil {
+				return "", true, err
+			}
+			target, err := lastUndoable(t.Project)
+			if err != nil {
+				return "", true, err
+			}
+			if dryRun {
+				return j(map[string]any{"status": "dry-run", "would_restore": target}), false, nil
+			}
+
+			snap, err := safetySnapshot(t, "undo", target.Name)
+			if err != nil {
+				return "", true, err
+			}
+			meta, health, err := restoreSnapshot(t, target.Name)
+			res := map[string]any{"restored": meta, "health": health, "safety_snapshot": snapName(snap)}
+			if err != nil {
+				return j(res), true, err
+			}
+			res["status"] = "undo-complete"
+			return j(res), false, nil
+		},
+	}
+}